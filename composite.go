@@ -0,0 +1,86 @@
+// composite.go
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	rf "github.com/meinside/rss-feeds-go"
+)
+
+const (
+	compositeFeedItemsLimit = 100 // max number of merged items (shared by all source feeds)
+)
+
+// merge cached items of the source feeds of given `compositeFeed`
+//
+// returns merged items (deduplicated by link and GUID, newest first, at most `compositeFeedItemsLimit`)
+// and a client for publishing them.
+// (all cached items of the source feeds are merged before being limited, so that a source with many items
+// cannot crowd older items of the others out of the merged window)
+func compositeFeedItems(compositeFeed configCompositeFeed, feeds []*feed) (items []rf.CachedItem, client *rf.Client, err error) {
+	seenGUIDs, seenLinks := map[string]bool{}, map[string]bool{}
+	for _, f := range feeds {
+		if !slices.Contains(compositeFeed.FeedNames, f.conf.Name) {
+			continue
+		}
+		if client == nil {
+			client = f.client
+		}
+
+		var cached []rf.CachedItem
+		if cached, err = f.store.cachedItems(compositeFeed.DropItemsWithFailedSummaries); err != nil {
+			return nil, nil, fmt.Errorf("failed to list cached items of '%s': %w", f.conf.Name, err)
+		}
+		for _, item := range cached {
+			if seenGUIDs[item.GUID] || (item.Link != "" && seenLinks[item.Link]) {
+				continue
+			}
+			seenGUIDs[item.GUID] = true
+			if item.Link != "" {
+				seenLinks[item.Link] = true
+			}
+			items = append(items, item)
+		}
+	}
+	if client == nil {
+		return nil, nil, fmt.Errorf("no source feed is available for composite feed '%s'", compositeFeed.Name)
+	}
+
+	sortItemsByPublishDate(items)
+
+	if len(items) > compositeFeedItemsLimit {
+		items = items[:compositeFeedItemsLimit]
+	}
+
+	return items, client, nil
+}
+
+// list all cached items (read or not), without the ones with failed summaries if `dropFailed` is true
+func (s *feedStore) cachedItems(dropFailed bool) (items []rf.CachedItem, err error) {
+	tx := s.db.Model(&rf.CachedItem{}).Order("created_at DESC")
+	if dropFailed {
+		tx = tx.Where("instr(summary, ?) = 0", rf.ErrorPrefixSummaryFailedWithError)
+	}
+	err = tx.Find(&items).Error
+	return items, err
+}
+
+// sort given items by their publish dates (newest first)
+//
+// items without a parsable publish date are sorted by their creation times.
+func sortItemsByPublishDate(items []rf.CachedItem) {
+	slices.SortStableFunc(items, func(a, b rf.CachedItem) int {
+		return itemPublishTime(b).Compare(itemPublishTime(a))
+	})
+}
+
+// get the publish time of given item, (or its creation time if not parsable)
+func itemPublishTime(item rf.CachedItem) time.Time {
+	if t, err := time.Parse(time.RFC3339, item.PublishDate); err == nil {
+		return t
+	}
+	return item.CreatedAt
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	rf "github.com/meinside/rss-feeds-go"
+)
+
+func TestCompositeFeedItems(t *testing.T) {
+	client1, store1 := newTestFeedStore(t)
+	client2, store2 := newTestFeedStore(t)
+	client3, store3 := newTestFeedStore(t)
+
+	insertTestCachedItems(t, store1,
+		rf.CachedItem{GUID: "hn-1", Link: "https://example.com/a", Title: "a (hn)", PublishDate: "2026-01-01T00:00:00Z"},
+		rf.CachedItem{GUID: "hn-2", Link: "https://example.com/b", Title: "b", PublishDate: "2026-01-03T00:00:00Z"},
+	)
+	insertTestCachedItems(t, store2,
+		rf.CachedItem{GUID: "lb-1", Link: "https://example.com/a", Title: "a (lobsters)", PublishDate: "2026-01-02T00:00:00Z"},
+		rf.CachedItem{GUID: "lb-2", Link: "https://example.com/c", Title: "c", PublishDate: "2026-01-02T00:00:00Z"},
+		rf.CachedItem{GUID: "lb-3", Link: "https://example.com/d", Title: "failed", Summary: rf.ErrorPrefixSummaryFailedWithError},
+	)
+	insertTestCachedItems(t, store3,
+		rf.CachedItem{GUID: "other", Link: "https://example.com/e", Title: "e"},
+	)
+
+	feeds := []*feed{
+		{conf: configRSSFeed{Name: "hn"}, client: client1, store: store1},
+		{conf: configRSSFeed{Name: "lobsters"}, client: client2, store: store2},
+		{conf: configRSSFeed{Name: "other"}, client: client3, store: store3},
+	}
+
+	items, client, err := compositeFeedItems(configCompositeFeed{
+		Name:                         "merged",
+		FeedNames:                    []string{"hn", "lobsters"},
+		DropItemsWithFailedSummaries: true,
+	}, feeds)
+	if err != nil {
+		t.Fatalf("compositeFeedItems() error: %s", err)
+	}
+	if client == nil {
+		t.Error("expected a client for publishing")
+	}
+
+	guids := []string{}
+	for _, item := range items {
+		guids = append(guids, item.GUID)
+	}
+	if want := []string{"hn-2", "lb-2", "hn-1"}; !slices.Equal(guids, want) {
+		t.Errorf("expected items %v, got %v", want, guids)
+	}
+
+	if _, _, err := compositeFeedItems(configCompositeFeed{Name: "none", FeedNames: []string{"none"}}, feeds); err == nil {
+		t.Error("expected error for no source feed, got nil")
+	}
+}
+
+func TestSortItemsByPublishDate(t *testing.T) {
+	now := time.Now()
+
+	items := []rf.CachedItem{
+		{GUID: "old", PublishDate: "2026-01-01T00:00:00Z"},
+		{GUID: "unparsable", PublishDate: "not a date"},
+		{GUID: "new", PublishDate: "2026-02-01T00:00:00Z"},
+	}
+	items[1].CreatedAt = now
+
+	sortItemsByPublishDate(items)
+
+	if items[0].GUID != "unparsable" || items[1].GUID != "new" || items[2].GUID != "old" {
+		t.Errorf("unexpected order: %v", items)
+	}
+}
+
+func TestCompositeFeedItems_Limit(t *testing.T) {
+	client1, store1 := newTestFeedStore(t)
+	client2, store2 := newTestFeedStore(t)
+
+	// (a source with many items, and another with an item published in the middle of them)
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	many := []rf.CachedItem{}
+	for i := range 150 {
+		many = append(many, rf.CachedItem{GUID: fmt.Sprintf("many-%d", i), PublishDate: base.Add(time.Duration(i) * time.Hour).Format(time.RFC3339)})
+	}
+	insertTestCachedItems(t, store1, many...)
+	insertTestCachedItems(t, store2, rf.CachedItem{GUID: "one", PublishDate: base.Add(75*time.Hour + 30*time.Minute).Format(time.RFC3339)})
+
+	items, _, err := compositeFeedItems(configCompositeFeed{Name: "merged", FeedNames: []string{"many", "one"}}, []*feed{
+		{conf: configRSSFeed{Name: "many"}, client: client1, store: store1},
+		{conf: configRSSFeed{Name: "one"}, client: client2, store: store2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != compositeFeedItemsLimit || items[0].GUID != "many-149" || items[len(items)-1].GUID != "many-51" ||
+		!slices.ContainsFunc(items, func(item rf.CachedItem) bool { return item.GUID == "one" }) {
+		t.Errorf("unexpected merged items: %d items, from %s to %s", len(items), items[0].GUID, items[len(items)-1].GUID)
+	}
+}
@@ -5,7 +5,12 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
 
 	rf "github.com/meinside/rss-feeds-go"
 )
@@ -16,6 +21,26 @@ const (
 
 	defaultFetchFeedsIntervalSeconds = 60 * 3 // = 3 minutes
 	defaultFetchFeedsTimeoutSeconds  = 60 * 1 // = 1 minute
+
+	defaultFetchFeedsMinIntervalSeconds = 60 * 1  // = 1 minute
+	defaultFetchFeedsMaxIntervalSeconds = 60 * 60 // = 1 hour
+
+	defaultMaxConcurrentTicks   = 2
+	defaultMaxConcurrentScrapes = 1
+	defaultMaxItemsPerTick      = 20
+	defaultTickJitterSeconds    = 30
+	defaultScrapperMaxPages     = 100
+
+	defaultCrawlDelaySeconds     = 1.0
+	defaultMaxConnectionsPerHost = 2
+
+	defaultMaxExtractedTextBytes = 100 * 1024 // = 100KB
+
+	defaultRetryFailedSummariesMaxAttempts     = 5
+	defaultRetryFailedSummariesIntervalSeconds = 60 * 10 // = 10 minutes
+
+	defaultModelFailureThreshold = 3
+	defaultModelCooldownSeconds  = 60 * 10 // = 10 minutes
 )
 
 // config struct
@@ -34,8 +59,60 @@ type config struct {
 	FetchFeedsTimeoutSeconds  int             `json:"fetch_feeds_timeout_seconds,omitempty"`
 	PermittedUserAgents       []string        `json:"permitted_user_agents,omitempty"`
 
+	// Bounds of adaptive polling intervals of each source
+	FetchFeedsMinIntervalSeconds int `json:"fetch_feeds_min_interval_seconds,omitempty"`
+	FetchFeedsMaxIntervalSeconds int `json:"fetch_feeds_max_interval_seconds,omitempty"`
+
+	// Scheduling of feed processing (shared by all feeds)
+	MaxConcurrentTicks   int `json:"max_concurrent_ticks,omitempty"`
+	MaxConcurrentScrapes int `json:"max_concurrent_scrapes,omitempty"` // = size of the scrapper pool
+	ScrapperMaxPages     int `json:"scrapper_max_pages,omitempty"`     // scrappers are recycled after this many pages
+	MaxItemsPerTick      int `json:"max_items_per_tick,omitempty"`     // rest are deferred to the next tick
+	TickJitterSeconds    int `json:"tick_jitter_seconds,omitempty"`
+
+	// Politeness of requests to each host (shared by all feeds)
+	UserAgent             *string `json:"user_agent,omitempty"`
+	CrawlDelaySeconds     float64 `json:"crawl_delay_seconds,omitempty"`      // minimum spacing of requests to the same host
+	MaxConnectionsPerHost int     `json:"max_connections_per_host,omitempty"` // concurrent connections to the same host
+	RespectRobotsTxt      bool    `json:"respect_robots_txt,omitempty"`       // skip disallowed items, and honour crawl delays of robots.txt
+
+	// Max size of texts extracted from linked contents (eg. pdf documents) for summarizing
+	MaxExtractedTextBytes int `json:"max_extracted_text_bytes,omitempty"`
+
+	// Retries of failed summaries
+	RetryFailedSummariesMaxAttempts     int `json:"retry_failed_summaries_max_attempts,omitempty"`     // including the first attempt (1 = no retry)
+	RetryFailedSummariesIntervalSeconds int `json:"retry_failed_summaries_interval_seconds,omitempty"` // doubled on each retry
+
+	// Search feeds (virtual feeds of search results)
+	SearchFeeds []configSearchFeed `json:"search_feeds,omitempty"`
+
+	// Composite feeds (merged feeds of other feeds)
+	CompositeFeeds []configCompositeFeed `json:"composite_feeds,omitempty"`
+
 	// RSS server port
 	RSSServerPort int `json:"rss_server_port"`
+
+	// Token for admin endpoints (disabled if not set)
+	AdminToken *string `json:"admin_token,omitempty"`
+
+	// Daily budget of each api key (shared by all feeds, summarization is paused when exceeded)
+	APIKeyDailyBudget *configBudget `json:"api_key_daily_budget,omitempty"`
+
+	// Health of models (`google_ai_models` are tried in order, and failing ones are skipped for a while)
+	ModelFailureThreshold int `json:"model_failure_threshold,omitempty"` // consecutive errors or safety blocks before skipping a model
+	ModelCooldownSeconds  int `json:"model_cooldown_seconds,omitempty"`  // duration of skipping a failing model
+
+	// Prices of models for usage reports (model name or its prefix => price)
+	ModelPrices map[string]configModelPrice `json:"model_prices,omitempty"`
+}
+
+// configPublish struct (values for publishing RSS xml)
+type configPublish struct {
+	PublishTitle       *string `json:"publish_title,omitempty"`
+	PublishLink        *string `json:"publish_link,omitempty"`
+	PublishDescription *string `json:"publish_description,omitempty"`
+	PublishAuthor      *string `json:"publish_author,omitempty"`
+	PublishEmail       *string `json:"publish_email,omitempty"`
 }
 
 // configRSSFeed struct
@@ -45,15 +122,218 @@ type configRSSFeed struct {
 	ServePath     string   `json:"serve_path"`
 	FeedURLs      []string `json:"feed_urls"`
 
-	PublishTitle       *string `json:"publish_title,omitempty"`
-	PublishLink        *string `json:"publish_link,omitempty"`
-	PublishDescription *string `json:"publish_description,omitempty"`
-	PublishAuthor      *string `json:"publish_author,omitempty"`
-	PublishEmail       *string `json:"publish_email,omitempty"`
+	configPublish
+
+	DropItemsWithFailedSummaries bool `json:"drop_items_with_failed_summaries,omitempty"`
+	ClusterSimilarItems          bool `json:"cluster_similar_items,omitempty"`
+
+	// Schedule (cron expression, instead of adaptive polling) and quiet hours (no summarization)
+	Schedule   *string           `json:"schedule,omitempty"`
+	Timezone   *string           `json:"timezone,omitempty"` // IANA name (default: local)
+	QuietHours *configQuietHours `json:"quiet_hours,omitempty"`
+
+	// Summarize discussions (comments on Hacker News, Lobsters, and Reddit) of items too
+	SummarizeDiscussions *configDiscussions `json:"summarize_discussions,omitempty"`
+
+	// Custom prompt of summaries (instead of the default one of rss-feeds-go)
+	SummaryPrompt *configSummaryPrompt `json:"summary_prompt,omitempty"`
+
+	// Backend of summaries (default: Google Gemini API with `google_ai_api_keys`)
+	Summarizer *configSummarizer `json:"summarizer,omitempty"`
+
+	// Daily budget of Google Gemini API usages of this feed (summarization is paused when exceeded)
+	DailyBudget *configBudget `json:"daily_budget,omitempty"`
+
+	// Tags of summarized items (generated along with summaries, and published as `<category>` elements)
+	Tags *configTags `json:"tags,omitempty"`
+
+	// Translate titles which were left untranslated by summaries (original titles are kept in descriptions)
+	TranslateTitles bool `json:"translate_titles,omitempty"`
+}
+
+// configTags struct (free-form tags if `Allowed` is empty)
+type configTags struct {
+	Allowed []string `json:"allowed,omitempty"`
+	MaxTags int      `json:"max_tags,omitempty"` // (default: 3)
+}
+
+// configModelPrice struct (prices per million tokens, in any currency)
+type configModelPrice struct {
+	InputPerMillionTokens  float64 `json:"input_per_million_tokens"`
+	OutputPerMillionTokens float64 `json:"output_per_million_tokens"` // (including thoughts)
+}
+
+// configBudget struct (limits of api usages in a day, 0 for no limit)
+type configBudget struct {
+	MaxRequests int64 `json:"max_requests,omitempty"`
+	MaxTokens   int64 `json:"max_tokens,omitempty"` // input + output tokens
+}
+
+// configSummarizer struct (or just a string of its provider)
+type configSummarizer struct {
+	Provider string  `json:"provider"`           // "gemini" (default), "openai" (OpenAI-compatible chat completions API), or "extractive" (local, no api calls)
+	BaseURL  string  `json:"base_url,omitempty"` // eg. "http://localhost:8080/v1" (for "openai")
+	Model    string  `json:"model,omitempty"`    // (for "openai")
+	APIKey   *string `json:"api_key,omitempty"`  // (for "openai", optional for local servers)
+}
+
+// configSummaryPrompt struct
+//
+// `Template` is a text/template with fields: .Title, .URL, .Content, .Language, .Length, and .Format
+// (.Length and .Format are instructions for the configured `Length` and `Format`).
+type configSummaryPrompt struct {
+	Template *string `json:"template,omitempty"` // default: `defaultSummaryPromptTemplate`
+	Length   string  `json:"length,omitempty"`   // "short", "medium", or "long" (default: "medium")
+	Format   string  `json:"format,omitempty"`   // "paragraphs", "bullet_points", "tldr", or "key_numbers" (default: "paragraphs")
+}
+
+// configDiscussions struct (limits of comments for summarizing discussions, defaults for missing ones)
+type configDiscussions struct {
+	MaxDepth    int `json:"max_depth,omitempty"`    // 1 for top-level comments only
+	MaxComments int `json:"max_comments,omitempty"` // in order of appearance
+	MaxBytes    int `json:"max_bytes,omitempty"`
+}
+
+// configQuietHours struct (HH:MM, wraps around midnight if `To` is earlier than `From`)
+type configQuietHours struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// configSearchFeed struct
+//
+// items of a search feed are the union of matches of `Query`
+// across the caches of `FeedNames` (or all feeds if empty).
+type configSearchFeed struct {
+	Name      string   `json:"name"`
+	ServePath string   `json:"serve_path"`
+	Query     string   `json:"query"`
+	FeedNames []string `json:"feed_names,omitempty"`
+
+	configPublish
 
 	DropItemsWithFailedSummaries bool `json:"drop_items_with_failed_summaries,omitempty"`
 }
 
+// configCompositeFeed struct
+//
+// items of a composite feed are merged from the caches of `FeedNames`.
+type configCompositeFeed struct {
+	Name      string   `json:"name"`
+	ServePath string   `json:"serve_path"`
+	FeedNames []string `json:"feed_names"`
+
+	configPublish
+
+	DropItemsWithFailedSummaries bool `json:"drop_items_with_failed_summaries,omitempty"`
+}
+
+// get the timezone, schedule, and quiet hours of the feed (nil for missing ones)
+func (f configRSSFeed) scheduling() (location *time.Location, schedule *cronSchedule, quiet *quietHours, err error) {
+	location = time.Local
+	if f.Timezone != nil {
+		if location, err = time.LoadLocation(*f.Timezone); err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid 'timezone' of '%s': %w", f.Name, err)
+		}
+	}
+	if f.Schedule != nil {
+		if schedule, err = parseCronSchedule(*f.Schedule, location); err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid 'schedule' of '%s': %w", f.Name, err)
+		}
+	}
+	if f.QuietHours != nil {
+		if quiet, err = parseQuietHours(f.QuietHours.From, f.QuietHours.To, location); err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid 'quiet_hours' of '%s': %w", f.Name, err)
+		}
+	}
+	return location, schedule, quiet, nil
+}
+
+// unmarshal the summarizer config from an object or a string (eg. "extractive")
+func (s *configSummarizer) UnmarshalJSON(data []byte) error {
+	var provider string
+	if err := json.Unmarshal(data, &provider); err == nil {
+		*s = configSummarizer{Provider: provider}
+		return nil
+	}
+
+	type plain configSummarizer // (without this method)
+	return json.Unmarshal(data, (*plain)(s))
+}
+
+// get the provider of the summarizer (default: "gemini")
+func (s configSummarizer) provider() string {
+	if s.Provider == "" {
+		return summarizerProviderGemini
+	}
+	return s.Provider
+}
+
+// validate the summarizer config
+func (s configSummarizer) validate() error {
+	switch s.provider() {
+	case summarizerProviderGemini, summarizerProviderExtractive:
+		return nil
+	case summarizerProviderOpenAI:
+		if s.BaseURL == "" || s.Model == "" {
+			return fmt.Errorf("'base_url' and 'model' are required for provider '%s'", s.Provider)
+		}
+		if u, err := url.Parse(s.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid 'base_url': %s", s.BaseURL)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown provider '%s'", s.Provider)
+	}
+}
+
+// validate the budget config
+func (b configBudget) validate() error {
+	if b.MaxRequests < 0 || b.MaxTokens < 0 {
+		return fmt.Errorf("'max_requests' and 'max_tokens' must not be negative")
+	}
+	return nil
+}
+
+// validate the tags config
+func (t configTags) validate() error {
+	if t.MaxTags < 0 {
+		return fmt.Errorf("'max_tags' must not be negative")
+	}
+	if slices.ContainsFunc(t.Allowed, func(tag string) bool {
+		return strings.TrimSpace(tag) == ""
+	}) {
+		return fmt.Errorf("'allowed' must not contain empty tags")
+	}
+	return nil
+}
+
+// check if the feed is summarized with Google Gemini API
+func (f configRSSFeed) usesGemini() bool {
+	return f.Summarizer == nil || f.Summarizer.provider() == summarizerProviderGemini
+}
+
+// get values for publishing, (default values for missing ones)
+func (p configPublish) values() (title, link, description, author, email string) {
+	title, link, description, author, email = defaultPublishTitle, defaultPublishLink, defaultPublishDescription, defaultPublishAuthor, defaultPublishEmail
+	if p.PublishTitle != nil {
+		title = *p.PublishTitle
+	}
+	if p.PublishLink != nil {
+		link = *p.PublishLink
+	}
+	if p.PublishDescription != nil {
+		description = *p.PublishDescription
+	}
+	if p.PublishAuthor != nil {
+		author = *p.PublishAuthor
+	}
+	if p.PublishEmail != nil {
+		email = *p.PublishEmail
+	}
+	return title, link, description, author, email
+}
+
 // read config from given `filepath`
 func readConfig(filepath string) (conf config, err error) {
 	var bytes []byte
@@ -61,7 +341,7 @@ func readConfig(filepath string) (conf config, err error) {
 		if bytes, err = rf.StandardizeJSON(bytes); err == nil {
 			if err = json.Unmarshal(bytes, &conf); err == nil {
 				// validate required fields
-				if conf.GoogleAIAPIKey == nil && len(conf.GoogleAIAPIKeys) == 0 {
+				if conf.GoogleAIAPIKey == nil && len(conf.GoogleAIAPIKeys) == 0 && slices.ContainsFunc(conf.RSSFeeds, configRSSFeed.usesGemini) {
 					return conf, fmt.Errorf("at least one of 'google_ai_api_key' or 'google_ai_api_keys' is required")
 				}
 				if conf.DBFilesDirectory == "" {
@@ -70,6 +350,72 @@ func readConfig(filepath string) (conf config, err error) {
 				if len(conf.RSSFeeds) == 0 {
 					return conf, fmt.Errorf("'rss_feeds' must contain at least one entry")
 				}
+				servePaths := map[string]string{searchServePath: "(search)"}
+				feedNames := map[string]bool{}
+				for _, feed := range conf.RSSFeeds {
+					if err = checkServePath(servePaths, feed.Name, feed.ServePath); err != nil {
+						return conf, err
+					}
+					if _, _, _, err = feed.scheduling(); err != nil {
+						return conf, err
+					}
+					if feed.Summarizer != nil {
+						if err = feed.Summarizer.validate(); err != nil {
+							return conf, fmt.Errorf("invalid 'summarizer' of '%s': %w", feed.Name, err)
+						}
+					}
+					if feed.SummaryPrompt != nil {
+						if _, err = newSummaryPrompt(*feed.SummaryPrompt); err != nil {
+							return conf, fmt.Errorf("invalid 'summary_prompt' of '%s': %w", feed.Name, err)
+						}
+					}
+					if feed.DailyBudget != nil {
+						if err = feed.DailyBudget.validate(); err != nil {
+							return conf, fmt.Errorf("invalid 'daily_budget' of '%s': %w", feed.Name, err)
+						}
+					}
+					if feed.Tags != nil {
+						if err = feed.Tags.validate(); err != nil {
+							return conf, fmt.Errorf("invalid 'tags' of '%s': %w", feed.Name, err)
+						}
+					}
+					if feed.TranslateTitles && feed.Summarizer != nil && feed.Summarizer.provider() == summarizerProviderExtractive {
+						return conf, fmt.Errorf("'translate_titles' of '%s' is not supported with provider '%s'", feed.Name, summarizerProviderExtractive)
+					}
+					feedNames[feed.Name] = true
+				}
+				for _, searchFeed := range conf.SearchFeeds {
+					if err = checkServePath(servePaths, searchFeed.Name, searchFeed.ServePath); err != nil {
+						return conf, err
+					}
+					if strings.TrimSpace(searchFeed.Query) == "" {
+						return conf, fmt.Errorf("'query' of search feed '%s' is required", searchFeed.Name)
+					}
+					if err = checkFeedNames(feedNames, searchFeed.Name, searchFeed.FeedNames); err != nil {
+						return conf, err
+					}
+				}
+				for _, compositeFeed := range conf.CompositeFeeds {
+					if err = checkServePath(servePaths, compositeFeed.Name, compositeFeed.ServePath); err != nil {
+						return conf, err
+					}
+					if len(compositeFeed.FeedNames) == 0 {
+						return conf, fmt.Errorf("'feed_names' of composite feed '%s' must contain at least one entry", compositeFeed.Name)
+					}
+					if err = checkFeedNames(feedNames, compositeFeed.Name, compositeFeed.FeedNames); err != nil {
+						return conf, err
+					}
+				}
+				if conf.APIKeyDailyBudget != nil {
+					if err = conf.APIKeyDailyBudget.validate(); err != nil {
+						return conf, fmt.Errorf("invalid 'api_key_daily_budget': %w", err)
+					}
+				}
+				for model, price := range conf.ModelPrices {
+					if price.InputPerMillionTokens < 0 || price.OutputPerMillionTokens < 0 {
+						return conf, fmt.Errorf("prices of model '%s' in 'model_prices' must not be negative", model)
+					}
+				}
 				if conf.RSSServerPort <= 0 {
 					return conf, fmt.Errorf("'rss_server_port' must be a positive number")
 				}
@@ -87,6 +433,57 @@ func readConfig(filepath string) (conf config, err error) {
 				if conf.FetchFeedsTimeoutSeconds <= 0 {
 					conf.FetchFeedsTimeoutSeconds = defaultFetchFeedsTimeoutSeconds
 				}
+				if conf.FetchFeedsMinIntervalSeconds <= 0 {
+					conf.FetchFeedsMinIntervalSeconds = min(defaultFetchFeedsMinIntervalSeconds, conf.FetchFeedsIntervalSeconds)
+				}
+				if conf.FetchFeedsMaxIntervalSeconds <= 0 {
+					conf.FetchFeedsMaxIntervalSeconds = max(defaultFetchFeedsMaxIntervalSeconds, conf.FetchFeedsIntervalSeconds)
+				}
+				if conf.FetchFeedsIntervalSeconds < conf.FetchFeedsMinIntervalSeconds ||
+					conf.FetchFeedsIntervalSeconds > conf.FetchFeedsMaxIntervalSeconds {
+					return conf, fmt.Errorf(
+						"'fetch_feeds_interval_seconds'(%d) must be between 'fetch_feeds_min_interval_seconds'(%d) and 'fetch_feeds_max_interval_seconds'(%d)",
+						conf.FetchFeedsIntervalSeconds,
+						conf.FetchFeedsMinIntervalSeconds,
+						conf.FetchFeedsMaxIntervalSeconds,
+					)
+				}
+				if conf.MaxConcurrentTicks <= 0 {
+					conf.MaxConcurrentTicks = defaultMaxConcurrentTicks
+				}
+				if conf.MaxConcurrentScrapes <= 0 {
+					conf.MaxConcurrentScrapes = defaultMaxConcurrentScrapes
+				}
+				if conf.ScrapperMaxPages <= 0 {
+					conf.ScrapperMaxPages = defaultScrapperMaxPages
+				}
+				if conf.MaxItemsPerTick <= 0 {
+					conf.MaxItemsPerTick = defaultMaxItemsPerTick
+				}
+				if conf.TickJitterSeconds <= 0 {
+					conf.TickJitterSeconds = defaultTickJitterSeconds
+				}
+				if conf.CrawlDelaySeconds <= 0 {
+					conf.CrawlDelaySeconds = defaultCrawlDelaySeconds
+				}
+				if conf.MaxConnectionsPerHost <= 0 {
+					conf.MaxConnectionsPerHost = defaultMaxConnectionsPerHost
+				}
+				if conf.MaxExtractedTextBytes <= 0 {
+					conf.MaxExtractedTextBytes = defaultMaxExtractedTextBytes
+				}
+				if conf.RetryFailedSummariesMaxAttempts <= 0 {
+					conf.RetryFailedSummariesMaxAttempts = defaultRetryFailedSummariesMaxAttempts
+				}
+				if conf.RetryFailedSummariesIntervalSeconds <= 0 {
+					conf.RetryFailedSummariesIntervalSeconds = defaultRetryFailedSummariesIntervalSeconds
+				}
+				if conf.ModelFailureThreshold <= 0 {
+					conf.ModelFailureThreshold = defaultModelFailureThreshold
+				}
+				if conf.ModelCooldownSeconds <= 0 {
+					conf.ModelCooldownSeconds = defaultModelCooldownSeconds
+				}
 
 				return conf, nil
 			}
@@ -95,3 +492,26 @@ func readConfig(filepath string) (conf config, err error) {
 
 	return conf, err
 }
+
+// check if given `servePath` does not conflict with already-used `servePaths`, and mark it as used
+func checkServePath(servePaths map[string]string, name, servePath string) error {
+	p := path.Join("/", servePath)
+	if strings.HasPrefix(p+"/", adminServePathPrefix) {
+		return fmt.Errorf("'serve_path' of '%s' conflicts with the reserved path: %s", name, adminServePathPrefix)
+	}
+	if used, exists := servePaths[p]; exists {
+		return fmt.Errorf("'serve_path' of '%s' conflicts with that of '%s': %s", name, used, p)
+	}
+	servePaths[p] = name
+	return nil
+}
+
+// check if all `names` referred by `name` are in `feedNames`
+func checkFeedNames(feedNames map[string]bool, name string, names []string) error {
+	for _, n := range names {
+		if !feedNames[n] {
+			return fmt.Errorf("'%s' refers to an unknown feed: '%s'", name, n)
+		}
+	}
+	return nil
+}
@@ -76,6 +76,33 @@ func TestReadConfig_Defaults(t *testing.T) {
 	if conf.FetchFeedsTimeoutSeconds != defaultFetchFeedsTimeoutSeconds {
 		t.Errorf("expected timeout %d, got %d", defaultFetchFeedsTimeoutSeconds, conf.FetchFeedsTimeoutSeconds)
 	}
+	if conf.MaxConcurrentTicks != defaultMaxConcurrentTicks || conf.MaxConcurrentScrapes != defaultMaxConcurrentScrapes {
+		t.Errorf("expected concurrency limits %d/%d, got %d/%d", defaultMaxConcurrentTicks, defaultMaxConcurrentScrapes, conf.MaxConcurrentTicks, conf.MaxConcurrentScrapes)
+	}
+	if conf.MaxItemsPerTick != defaultMaxItemsPerTick {
+		t.Errorf("expected max items per tick %d, got %d", defaultMaxItemsPerTick, conf.MaxItemsPerTick)
+	}
+	if conf.TickJitterSeconds != defaultTickJitterSeconds {
+		t.Errorf("expected tick jitter %d, got %d", defaultTickJitterSeconds, conf.TickJitterSeconds)
+	}
+	if conf.CrawlDelaySeconds != defaultCrawlDelaySeconds || conf.MaxConnectionsPerHost != defaultMaxConnectionsPerHost {
+		t.Errorf("expected politeness %v/%d, got %v/%d", defaultCrawlDelaySeconds, defaultMaxConnectionsPerHost, conf.CrawlDelaySeconds, conf.MaxConnectionsPerHost)
+	}
+	if conf.MaxExtractedTextBytes != defaultMaxExtractedTextBytes {
+		t.Errorf("expected max extracted text bytes %d, got %d", defaultMaxExtractedTextBytes, conf.MaxExtractedTextBytes)
+	}
+	if conf.UserAgent != nil || conf.RespectRobotsTxt {
+		t.Errorf("expected no user agent and robots.txt not respected by default")
+	}
+	if conf.RetryFailedSummariesMaxAttempts != defaultRetryFailedSummariesMaxAttempts {
+		t.Errorf("expected max attempts %d, got %d", defaultRetryFailedSummariesMaxAttempts, conf.RetryFailedSummariesMaxAttempts)
+	}
+	if conf.RetryFailedSummariesIntervalSeconds != defaultRetryFailedSummariesIntervalSeconds {
+		t.Errorf("expected retry interval %d, got %d", defaultRetryFailedSummariesIntervalSeconds, conf.RetryFailedSummariesIntervalSeconds)
+	}
+	if conf.ModelFailureThreshold != defaultModelFailureThreshold || conf.ModelCooldownSeconds != defaultModelCooldownSeconds {
+		t.Errorf("expected model failure threshold %d and cooldown %d, got %d and %d", defaultModelFailureThreshold, defaultModelCooldownSeconds, conf.ModelFailureThreshold, conf.ModelCooldownSeconds)
+	}
 }
 
 func TestReadConfig_InvalidPath(t *testing.T) {
@@ -181,3 +208,430 @@ func TestReadConfig_SingleAPIKey(t *testing.T) {
 		t.Errorf("expected single API key, got %v", conf.GoogleAIAPIKey)
 	}
 }
+
+func TestReadConfig_ReservedServePath(t *testing.T) {
+	content := `{
+		"google_ai_api_keys": ["key1"],
+		"db_files_dir": "/tmp",
+		"rss_feeds": [{"name":"t","cache_filename":"t.db","serve_path":"search","feed_urls":["https://example.com/rss"]}],
+		"rss_server_port": 8080
+	}`
+	path := writeTestConfig(t, content)
+
+	_, err := readConfig(path)
+	if err == nil {
+		t.Fatal("expected error for reserved serve_path, got nil")
+	}
+	if !strings.Contains(err.Error(), "serve_path") {
+		t.Errorf("unexpected error message: %s", err)
+	}
+}
+
+func TestReadConfig_DuplicateServePath(t *testing.T) {
+	content := `{
+		"google_ai_api_keys": ["key1"],
+		"db_files_dir": "/tmp",
+		"rss_feeds": [
+			{"name":"t1","cache_filename":"t1.db","serve_path":"/t","feed_urls":["https://example.com/rss"]},
+			{"name":"t2","cache_filename":"t2.db","serve_path":"t","feed_urls":["https://example.com/rss"]}
+		],
+		"rss_server_port": 8080
+	}`
+	path := writeTestConfig(t, content)
+
+	_, err := readConfig(path)
+	if err == nil {
+		t.Fatal("expected error for duplicated serve_path, got nil")
+	}
+	if !strings.Contains(err.Error(), "serve_path") {
+		t.Errorf("unexpected error message: %s", err)
+	}
+}
+
+func TestReadConfig_SearchFeeds(t *testing.T) {
+	tests := []struct {
+		name       string
+		searchFeed string
+		wantErr    string
+	}{
+		{
+			name:       "valid",
+			searchFeed: `{"name":"cve","serve_path":"/cve","query":"CVE","feed_names":["t"]}`,
+		},
+		{
+			name:       "missing query",
+			searchFeed: `{"name":"cve","serve_path":"/cve"}`,
+			wantErr:    "query",
+		},
+		{
+			name:       "unknown feed",
+			searchFeed: `{"name":"cve","serve_path":"/cve","query":"CVE","feed_names":["unknown"]}`,
+			wantErr:    "unknown",
+		},
+		{
+			name:       "conflicting serve path",
+			searchFeed: `{"name":"cve","serve_path":"/t","query":"CVE"}`,
+			wantErr:    "serve_path",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestConfig(t, `{
+				"google_ai_api_keys": ["key1"],
+				"db_files_dir": "/tmp",
+				"rss_feeds": [{"name":"t","cache_filename":"t.db","serve_path":"/t","feed_urls":["https://example.com/rss"]}],
+				"search_feeds": [`+tt.searchFeed+`],
+				"rss_server_port": 8080
+			}`)
+
+			conf, err := readConfig(path)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("readConfig() error: %s", err)
+				}
+				if len(conf.SearchFeeds) != 1 || conf.SearchFeeds[0].Query != "CVE" {
+					t.Errorf("unexpected search feeds: %v", conf.SearchFeeds)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestConfigPublishValues(t *testing.T) {
+	title, link, description, author, email := configPublish{}.values()
+	if title != defaultPublishTitle || link != defaultPublishLink || description != defaultPublishDescription ||
+		author != defaultPublishAuthor || email != defaultPublishEmail {
+		t.Errorf("unexpected default values: %s, %s, %s, %s, %s", title, link, description, author, email)
+	}
+
+	title, _, _, _, _ = configPublish{PublishTitle: new("custom")}.values()
+	if title != "custom" {
+		t.Errorf("expected custom title, got %s", title)
+	}
+}
+
+func TestReadConfig_CompositeFeeds(t *testing.T) {
+	tests := []struct {
+		name          string
+		compositeFeed string
+		wantErr       string
+	}{
+		{
+			name:          "valid",
+			compositeFeed: `{"name":"all","serve_path":"/all","feed_names":["t"]}`,
+		},
+		{
+			name:          "missing feed names",
+			compositeFeed: `{"name":"all","serve_path":"/all"}`,
+			wantErr:       "feed_names",
+		},
+		{
+			name:          "unknown feed",
+			compositeFeed: `{"name":"all","serve_path":"/all","feed_names":["unknown"]}`,
+			wantErr:       "unknown",
+		},
+		{
+			name:          "conflicting serve path",
+			compositeFeed: `{"name":"all","serve_path":"/search","feed_names":["t"]}`,
+			wantErr:       "serve_path",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestConfig(t, `{
+				"google_ai_api_keys": ["key1"],
+				"db_files_dir": "/tmp",
+				"rss_feeds": [{"name":"t","cache_filename":"t.db","serve_path":"/t","feed_urls":["https://example.com/rss"]}],
+				"composite_feeds": [`+tt.compositeFeed+`],
+				"rss_server_port": 8080
+			}`)
+
+			conf, err := readConfig(path)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("readConfig() error: %s", err)
+				}
+				if len(conf.CompositeFeeds) != 1 || len(conf.CompositeFeeds[0].FeedNames) != 1 {
+					t.Errorf("unexpected composite feeds: %v", conf.CompositeFeeds)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestReadConfig_AdminServePath(t *testing.T) {
+	content := `{
+		"google_ai_api_keys": ["key1"],
+		"db_files_dir": "/tmp",
+		"rss_feeds": [{"name":"t","cache_filename":"t.db","serve_path":"/admin/feed","feed_urls":["https://example.com/rss"]}],
+		"rss_server_port": 8080
+	}`
+	path := writeTestConfig(t, content)
+
+	_, err := readConfig(path)
+	if err == nil {
+		t.Fatal("expected error for reserved admin serve_path, got nil")
+	}
+	if !strings.Contains(err.Error(), "serve_path") {
+		t.Errorf("unexpected error message: %s", err)
+	}
+}
+
+func TestReadConfig_FetchIntervals(t *testing.T) {
+	tests := []struct {
+		name      string
+		intervals string
+		wantMin   int
+		wantMax   int
+		wantErr   bool
+	}{
+		{name: "defaults", intervals: `"fetch_feeds_interval_seconds": 180`, wantMin: defaultFetchFeedsMinIntervalSeconds, wantMax: defaultFetchFeedsMaxIntervalSeconds},
+		{name: "short interval", intervals: `"fetch_feeds_interval_seconds": 30`, wantMin: 30, wantMax: defaultFetchFeedsMaxIntervalSeconds},
+		{name: "long interval", intervals: `"fetch_feeds_interval_seconds": 7200`, wantMin: defaultFetchFeedsMinIntervalSeconds, wantMax: 7200},
+		{name: "custom", intervals: `"fetch_feeds_interval_seconds": 600, "fetch_feeds_min_interval_seconds": 300, "fetch_feeds_max_interval_seconds": 86400`, wantMin: 300, wantMax: 86400},
+		{name: "out of bounds", intervals: `"fetch_feeds_interval_seconds": 600, "fetch_feeds_max_interval_seconds": 300`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestConfig(t, `{
+				"google_ai_api_keys": ["key1"],
+				"db_files_dir": "/tmp",
+				"rss_feeds": [{"name":"t","cache_filename":"t.db","serve_path":"/t","feed_urls":["https://example.com/rss"]}],
+				`+tt.intervals+`,
+				"rss_server_port": 8080
+			}`)
+
+			conf, err := readConfig(path)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "fetch_feeds_interval_seconds") {
+					t.Errorf("expected error for intervals out of bounds, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readConfig() error: %s", err)
+			}
+			if conf.FetchFeedsMinIntervalSeconds != tt.wantMin || conf.FetchFeedsMaxIntervalSeconds != tt.wantMax {
+				t.Errorf("expected bounds [%d, %d], got [%d, %d]", tt.wantMin, tt.wantMax, conf.FetchFeedsMinIntervalSeconds, conf.FetchFeedsMaxIntervalSeconds)
+			}
+		})
+	}
+}
+
+func TestReadConfig_Scheduling(t *testing.T) {
+	tests := []struct {
+		name       string
+		scheduling string
+		wantErr    string
+	}{
+		{name: "none", scheduling: ``},
+		{name: "valid", scheduling: `, "schedule": "*/30 9-18 * * 1-5", "timezone": "Asia/Seoul", "quiet_hours": {"from": "22:00", "to": "07:00"}`},
+		{name: "invalid schedule", scheduling: `, "schedule": "every hour"`, wantErr: "schedule"},
+		{name: "invalid timezone", scheduling: `, "timezone": "Mars/Olympus"`, wantErr: "timezone"},
+		{name: "invalid quiet hours", scheduling: `, "quiet_hours": {"from": "22:00"}`, wantErr: "quiet_hours"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestConfig(t, `{
+				"google_ai_api_keys": ["key1"],
+				"db_files_dir": "/tmp",
+				"rss_feeds": [{"name":"t","cache_filename":"t.db","serve_path":"/t","feed_urls":["https://example.com/rss"]`+tt.scheduling+`}],
+				"rss_server_port": 8080
+			}`)
+
+			_, err := readConfig(path)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("readConfig() error: %s", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestReadConfig_SummaryPrompt(t *testing.T) {
+	tests := []struct {
+		name    string
+		prompt  string
+		wantErr string
+	}{
+		{name: "none", prompt: ``},
+		{name: "default template", prompt: `, "summary_prompt": {"length": "short", "format": "bullet_points"}`},
+		{name: "custom template", prompt: `, "summary_prompt": {"template": "Summarize '{{.Title}}' in {{.Language}}, {{.Format}}:\n\n{{.Content}}"}`},
+		{name: "invalid template", prompt: `, "summary_prompt": {"template": "{{.Content"}`, wantErr: "summary_prompt"},
+		{name: "unknown field", prompt: `, "summary_prompt": {"template": "{{.Body}}"}`, wantErr: "summary_prompt"},
+		{name: "without content", prompt: `, "summary_prompt": {"template": "Summarize {{.URL}}"}`, wantErr: "Content"},
+		{name: "unknown length", prompt: `, "summary_prompt": {"length": "tiny"}`, wantErr: "length"},
+		{name: "unknown format", prompt: `, "summary_prompt": {"format": "haiku"}`, wantErr: "format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestConfig(t, `{
+				"google_ai_api_keys": ["key1"],
+				"db_files_dir": "/tmp",
+				"rss_feeds": [{"name":"t","cache_filename":"t.db","serve_path":"/t","feed_urls":["https://example.com/rss"]`+tt.prompt+`}],
+				"rss_server_port": 8080
+			}`)
+
+			_, err := readConfig(path)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("readConfig() error: %s", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestReadConfig_Summarizer(t *testing.T) {
+	tests := []struct {
+		name       string
+		apiKeys    string
+		summarizer string
+		wantErr    string
+	}{
+		{name: "default", apiKeys: `"google_ai_api_keys": ["key1"],`},
+		{name: "gemini", apiKeys: `"google_ai_api_keys": ["key1"],`, summarizer: `, "summarizer": {"provider": "gemini"}`},
+		{name: "gemini without api keys", summarizer: `, "summarizer": {"provider": "gemini"}`, wantErr: "google_ai_api_key"},
+		{name: "openai without api keys", summarizer: `, "summarizer": {"provider": "openai", "base_url": "http://localhost:8080/v1", "model": "local"}`},
+		{name: "openai without model", summarizer: `, "summarizer": {"provider": "openai", "base_url": "http://localhost:8080/v1"}`, wantErr: "model"},
+		{name: "openai with invalid base url", summarizer: `, "summarizer": {"provider": "openai", "base_url": "localhost:8080", "model": "local"}`, wantErr: "base_url"},
+		{name: "unknown provider", apiKeys: `"google_ai_api_keys": ["key1"],`, summarizer: `, "summarizer": {"provider": "claude"}`, wantErr: "provider"},
+		{name: "extractive without api keys", summarizer: `, "summarizer": "extractive"`},
+		{name: "extractive in an object", summarizer: `, "summarizer": {"provider": "extractive"}`},
+		{name: "unknown provider in a string", apiKeys: `"google_ai_api_keys": ["key1"],`, summarizer: `, "summarizer": "lexrank"`, wantErr: "provider"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestConfig(t, `{
+				`+tt.apiKeys+`
+				"db_files_dir": "/tmp",
+				"rss_feeds": [{"name":"t","cache_filename":"t.db","serve_path":"/t","feed_urls":["https://example.com/rss"]`+tt.summarizer+`}],
+				"rss_server_port": 8080
+			}`)
+
+			_, err := readConfig(path)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("readConfig() error: %s", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestReadConfig_DailyBudgets(t *testing.T) {
+	tests := []struct {
+		name    string
+		global  string
+		feed    string
+		wantErr string
+	}{
+		{name: "no budgets"},
+		{name: "valid budgets", global: `"api_key_daily_budget": {"max_requests": 100},`, feed: `, "daily_budget": {"max_tokens": 100000}`},
+		{name: "negative key budget", global: `"api_key_daily_budget": {"max_requests": -1},`, wantErr: "api_key_daily_budget"},
+		{name: "negative feed budget", feed: `, "daily_budget": {"max_tokens": -1}`, wantErr: "daily_budget"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestConfig(t, `{
+				"google_ai_api_keys": ["key1"],
+				`+tt.global+`
+				"db_files_dir": "/tmp",
+				"rss_feeds": [{"name":"t","cache_filename":"t.db","serve_path":"/t","feed_urls":["https://example.com/rss"]`+tt.feed+`}],
+				"rss_server_port": 8080
+			}`)
+
+			_, err := readConfig(path)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("readConfig() error: %s", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestReadConfig_Tags(t *testing.T) {
+	tests := []struct {
+		name    string
+		feed    string
+		wantErr string
+	}{
+		{name: "free-form tags", feed: `, "tags": {}`},
+		{name: "allowed tags", feed: `, "tags": {"allowed": ["security", "ai"], "max_tags": 2}`},
+		{name: "negative max tags", feed: `, "tags": {"max_tags": -1}`, wantErr: "max_tags"},
+		{name: "empty allowed tag", feed: `, "tags": {"allowed": ["security", " "]}`, wantErr: "empty tags"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestConfig(t, `{
+				"google_ai_api_keys": ["key1"],
+				"db_files_dir": "/tmp",
+				"rss_feeds": [{"name":"t","cache_filename":"t.db","serve_path":"/t","feed_urls":["https://example.com/rss"]`+tt.feed+`}],
+				"rss_server_port": 8080
+			}`)
+
+			_, err := readConfig(path)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("readConfig() error: %s", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestReadConfig_TranslateTitles(t *testing.T) {
+	tests := []struct {
+		name    string
+		feed    string
+		wantErr string
+	}{
+		{name: "with rss-feeds-go", feed: `, "translate_titles": true`},
+		{name: "with openai", feed: `, "translate_titles": true, "summarizer": {"provider": "openai", "base_url": "http://localhost:8081/v1", "model": "m"}`},
+		{name: "with extractive", feed: `, "translate_titles": true, "summarizer": "extractive"`, wantErr: "translate_titles"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestConfig(t, `{
+				"google_ai_api_keys": ["key1"],
+				"db_files_dir": "/tmp",
+				"rss_feeds": [{"name":"t","cache_filename":"t.db","serve_path":"/t","feed_urls":["https://example.com/rss"]`+tt.feed+`}],
+				"rss_server_port": 8080
+			}`)
+
+			_, err := readConfig(path)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("readConfig() error: %s", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
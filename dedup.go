@@ -0,0 +1,325 @@
+// dedup.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	rf "github.com/meinside/rss-feeds-go"
+)
+
+// query parameters for tracking, which are stripped from canonicalized urls
+var _trackingQueryParams = []string{
+	`fbclid`,
+	`gclid`,
+	`igshid`,
+}
+
+// prefixes of query parameters for tracking, which are stripped from canonicalized urls
+var _trackingQueryParamPrefixes = []string{
+	`utm_`,
+	`mc_`,
+}
+
+// host suffix of google amp caches (eg. example-com.cdn.ampproject.org/c/s/example.com/a/amp)
+const ampCacheHostSuffix = `.cdn.ampproject.org`
+
+// host labels for mobile/amp versions, which are stripped from canonicalized urls
+var _mobileHostLabels = []string{
+	`www`,
+	`m`,
+	`mobile`,
+	`amp`,
+}
+
+// cachedLink struct (canonicalized link of a cached item)
+type cachedLink struct {
+	CanonicalURL string `gorm:"primaryKey"`
+	GUID         string `gorm:"index"`
+
+	CreatedAt time.Time
+}
+
+// discussionLink struct (duplicated item which is (or will be) merged into a cached item)
+type discussionLink struct {
+	GUID       string `gorm:"primaryKey"` // guid of the duplicated item
+	CachedGUID string `gorm:"index"`      // guid of the cached item which it is merged into
+	Label      string
+	Link       string
+	Merged     bool // whether the link was appended to the cached item
+
+	CreatedAt time.Time
+}
+
+// duplicatedItem struct (an item which duplicates another one)
+type duplicatedItem struct {
+	item *gofeed.Item
+
+	guid  string // guid of the item which it duplicates
+	label string // label of `link`
+	link  string // link to be appended to the item which it duplicates
+}
+
+// canonicalize given url for detecting duplicated items
+//
+// (lowercased host without www/mobile/amp labels, no tracking parameters, no trailing `/amp` path, no trailing slashes, no fragment;
+// urls of amp caches are canonicalized to their original ones)
+func canonicalURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return strings.TrimSpace(raw)
+	}
+
+	// amp cache (eg. /c/s/example.com/a for https://example.com/a)
+	if strings.HasSuffix(strings.ToLower(u.Hostname()), ampCacheHostSuffix) {
+		if _, original, found := strings.Cut(strings.TrimPrefix(u.EscapedPath(), "/"), "/"); found {
+			scheme := "http"
+			if after, secure := strings.CutPrefix(original, "s/"); secure {
+				scheme, original = "https", after
+			}
+			if original != "" {
+				original = scheme + "://" + original
+				if u.RawQuery != "" {
+					original += "?" + u.RawQuery
+				}
+				return canonicalURL(original)
+			}
+		}
+	}
+
+	// scheme
+	if u.Scheme == "http" {
+		u.Scheme = "https"
+	}
+
+	// host
+	labels := strings.Split(strings.ToLower(u.Hostname()), ".")
+	for len(labels) > 2 && slices.Contains(_mobileHostLabels, labels[0]) {
+		labels = labels[1:]
+	}
+	if len(labels) > 3 && slices.Contains(_mobileHostLabels, labels[1]) { // eg. en.m.wikipedia.org
+		labels = append(labels[:1], labels[2:]...)
+	}
+	host := strings.Join(labels, ".")
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+	u.Host = host
+
+	// path
+	p := strings.TrimRight(u.EscapedPath(), "/")
+	if trimmed, isAMP := strings.CutSuffix(p, "/amp"); isAMP {
+		p = strings.TrimRight(trimmed, "/")
+	}
+	u.RawPath, u.Path = "", ""
+	if unescaped, err := url.PathUnescape(p); err == nil {
+		u.Path = unescaped
+	}
+
+	// query
+	query := u.Query()
+	for key := range query {
+		lowered := strings.ToLower(key)
+		if slices.Contains(_trackingQueryParams, lowered) ||
+			slices.ContainsFunc(_trackingQueryParamPrefixes, func(prefix string) bool {
+				return strings.HasPrefix(lowered, prefix)
+			}) {
+			query.Del(key)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	// fragment
+	u.Fragment, u.RawFragment = "", ""
+
+	return u.String()
+}
+
+// get the discussion link of given item (eg. community comments)
+func discussionLinkOf(item *gofeed.Item) string {
+	if len(item.Links) > 1 {
+		return item.Links[1]
+	}
+	if item.GUID != item.Link &&
+		(strings.HasPrefix(item.GUID, "https://") || strings.HasPrefix(item.GUID, "http://")) {
+		return item.GUID
+	}
+	return item.Link
+}
+
+// drop duplicated items from given feeds `fs`
+//
+// items are duplicated when their canonicalized links are already cached,
+// or shared with a preceding item of `fs`. Dropped items are recorded in the store (and returned as `duplicates`)
+// for merging them into the cached ones with `mergeDuplicates`, whenever they get cached.
+func dedupeFeedItems(fs []gofeed.Feed, store *feedStore) (deduped []gofeed.Feed, duplicates []duplicatedItem) {
+	seen := map[string]string{} // canonicalized link => guid
+	for _, f := range fs {
+		f.Items = slices.DeleteFunc(slices.Clone(f.Items), func(item *gofeed.Item) bool {
+			if item.Link == "" {
+				return false
+			}
+
+			// already merged into a cached item
+			if merged, err := store.isMergedDuplicate(item.GUID); err != nil {
+				log.Printf("# failed to check merged item '%s': %s", item.GUID, err)
+			} else if merged {
+				return true
+			}
+
+			canonical := canonicalURL(item.Link)
+			duplicated := duplicatedItem{
+				item:  item,
+				label: "Also discussed at",
+				link:  discussionLinkOf(item),
+			}
+
+			if guid, exists := seen[canonical]; exists {
+				duplicated.guid = guid
+				duplicates = append(duplicates, duplicated)
+				return true
+			}
+			seen[canonical] = item.GUID
+
+			if guid, cached, err := store.cachedGUIDOf(canonical); err != nil {
+				log.Printf("# failed to check cached link '%s': %s", canonical, err)
+			} else if cached {
+				duplicated.guid = guid
+				duplicates = append(duplicates, duplicated)
+				return true
+			}
+
+			return false
+		})
+		deduped = append(deduped, f)
+	}
+
+	if err := store.recordDuplicates(duplicates); err != nil {
+		log.Printf("# failed to record duplicated items: %s", err)
+	}
+
+	return deduped, duplicates
+}
+
+// record given duplicated items, to be merged into the items which they duplicate with `mergeDuplicates`
+func (s *feedStore) recordDuplicates(duplicates []duplicatedItem) error {
+	var errs []error
+	for _, duplicated := range duplicates {
+		if duplicated.guid == duplicated.item.GUID {
+			continue
+		}
+		if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&discussionLink{
+			GUID:       duplicated.item.GUID,
+			CachedGUID: duplicated.guid,
+			Label:      duplicated.label,
+			Link:       duplicated.link,
+		}).Error; err != nil {
+			errs = append(errs, fmt.Errorf("failed to record duplicated item '%s': %w", duplicated.item.GUID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// save canonicalized links of given cached items
+func (s *feedStore) saveCachedLinks(items []rf.CachedItem) error {
+	var errs []error
+	for _, item := range items {
+		if item.Link == "" {
+			continue
+		}
+		link := cachedLink{
+			CanonicalURL: canonicalURL(item.Link),
+			GUID:         item.GUID,
+		}
+		if err := s.db.Where(cachedLink{CanonicalURL: link.CanonicalURL}).FirstOrCreate(&link).Error; err != nil {
+			errs = append(errs, fmt.Errorf("failed to save cached link of '%s': %w", item.GUID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// get the guid of the cached item with given canonicalized link
+func (s *feedStore) cachedGUIDOf(canonical string) (guid string, exists bool, err error) {
+	var link cachedLink
+	if err = s.db.Where("canonical_url = ?", canonical).First(&link).Error; err == nil {
+		return link.GUID, true, nil
+	} else if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", false, nil
+	}
+	return "", false, err
+}
+
+// check if an item with given `guid` was already recorded as a duplicate of another item
+func (s *feedStore) isMergedDuplicate(guid string) (merged bool, err error) {
+	var count int64
+	err = s.db.Model(&discussionLink{}).Where("guid = ?", guid).Count(&count).Error
+	return count > 0, err
+}
+
+// merge recorded duplicated items into the cached items which they duplicate
+//
+// links of the duplicated items are appended to the descriptions of the cached items.
+// (items whose cached counterparts do not exist yet will be merged on later ticks)
+func (s *feedStore) mergeDuplicates() error {
+	var links []discussionLink
+	if err := s.db.Where("merged = ? AND cached_guid IN (SELECT guid FROM cached_items)", false).Order("created_at").Find(&links).Error; err != nil {
+		return fmt.Errorf("failed to list duplicated items: %w", err)
+	}
+
+	var errs []error
+	merged := []string{}
+	for _, link := range links {
+		if err := s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&discussionLink{}).Where("guid = ?", link.GUID).Update("merged", true).Error; err != nil {
+				return err
+			}
+			return tx.Exec(
+				`UPDATE cached_items SET description = COALESCE(description, '') || ?, updated_at = ? WHERE guid = ?`,
+				fmt.Sprintf(`<p>%[1]s: <a href="%[2]s">%[2]s</a></p>`, link.Label, html.EscapeString(link.Link)),
+				time.Now(),
+				link.CachedGUID,
+			).Error
+		}); err != nil {
+			errs = append(errs, fmt.Errorf("failed to merge item '%s' into '%s': %w", link.GUID, link.CachedGUID, err))
+		} else if !slices.Contains(merged, link.CachedGUID) {
+			merged = append(merged, link.CachedGUID)
+		}
+	}
+
+	// (re-indexed with their merged descriptions)
+	if err := s.indexItems(merged); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// check if an item with given `guid` is cached
+func (s *feedStore) isCached(guid string) (cached bool, err error) {
+	var count int64
+	err = s.db.Table("cached_items").Where("guid = ?", guid).Count(&count).Error
+	return count > 0, err
+}
+
+// delete links of items which were deleted from the cache
+//
+// (duplicated items whose counterparts were never cached are deleted after the days of ignoring old items)
+func (s *feedStore) pruneLinks() error {
+	return errors.Join(
+		s.db.Where("guid NOT IN (SELECT guid FROM cached_items)").Delete(&cachedLink{}).Error,
+		s.db.Where("cached_guid NOT IN (SELECT guid FROM cached_items) AND (merged = ? OR created_at < ?)",
+			true,
+			time.Now().AddDate(0, 0, -int(ignoreItemsPublishedBeforeDays)),
+		).Delete(&discussionLink{}).Error,
+	)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+
+	rf "github.com/meinside/rss-feeds-go"
+)
+
+func TestCanonicalURL(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{raw: "https://example.com/a/", want: "https://example.com/a"},
+		{raw: "http://www.example.com/a", want: "https://example.com/a"},
+		{raw: "https://EXAMPLE.com/a?utm_source=hn&utm_medium=rss&id=3", want: "https://example.com/a?id=3"},
+		{raw: "https://example.com/a?fbclid=xyz#section", want: "https://example.com/a"},
+		{raw: "https://m.example.com/news/a", want: "https://example.com/news/a"},
+		{raw: "https://en.m.wikipedia.org/wiki/Go", want: "https://en.wikipedia.org/wiki/Go"},
+		{raw: "https://example.com/a?mc_cid=1&mc_eid=2&gclid=3&igshid=4", want: "https://example.com/a"},
+		{raw: "https://example.com/news/a/amp", want: "https://example.com/news/a"},
+		{raw: "https://example.com/news/a/amp/", want: "https://example.com/news/a"},
+		{raw: "https://example-com.cdn.ampproject.org/c/s/example.com/news/a/amp", want: "https://example.com/news/a"},
+		{raw: "https://example-com.cdn.ampproject.org/c/example.com/news/a?utm_source=x", want: "https://example.com/news/a"},
+
+		// not stripped
+		{raw: "https://github.com/a/b/tree?ref=main", want: "https://github.com/a/b/tree?ref=main"},
+		{raw: "https://example.com/news/a?amp=1", want: "https://example.com/news/a?amp=1"},
+		{raw: "https://example.com/blog/amp/intro", want: "https://example.com/blog/amp/intro"},
+		{raw: "https://example.com/amp/news/a/", want: "https://example.com/amp/news/a"},
+		{raw: "https://example.com/news/a.amp", want: "https://example.com/news/a.amp"},
+		{raw: "https://example.com/news/champ", want: "https://example.com/news/champ"},
+		{raw: "https://example.com/a?id=1&ref_src=twsrc", want: "https://example.com/a?id=1&ref_src=twsrc"},
+		{raw: "https://example.com:8080/a", want: "https://example.com:8080/a"},
+		{raw: "https://m.co/a", want: "https://m.co/a"},
+		{raw: "not a url", want: "not a url"},
+	}
+
+	for _, tt := range tests {
+		if got := canonicalURL(tt.raw); got != tt.want {
+			t.Errorf("canonicalURL(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestDiscussionLinkOf(t *testing.T) {
+	tests := []struct {
+		name string
+		item gofeed.Item
+		want string
+	}{
+		{
+			name: "second link",
+			item: gofeed.Item{Link: "https://example.com/a", Links: []string{"https://example.com/a", "https://news.ycombinator.com/item?id=1"}},
+			want: "https://news.ycombinator.com/item?id=1",
+		},
+		{
+			name: "guid as url",
+			item: gofeed.Item{Link: "https://example.com/a", GUID: "https://lobste.rs/s/abc"},
+			want: "https://lobste.rs/s/abc",
+		},
+		{
+			name: "link",
+			item: gofeed.Item{Link: "https://example.com/a", GUID: "tag:example.com,2026:a"},
+			want: "https://example.com/a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := discussionLinkOf(&tt.item); got != tt.want {
+				t.Errorf("discussionLinkOf() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDedupeAndMergeFeedItems(t *testing.T) {
+	client, store := newTestFeedStore(t)
+
+	// already cached item
+	cached := rf.CachedItem{GUID: "https://blog.example.com/a", Link: "https://blog.example.com/a", Description: "original"}
+	insertTestCachedItems(t, store, cached)
+	if err := store.saveCachedLinks([]rf.CachedItem{cached}); err != nil {
+		t.Fatal(err)
+	}
+
+	hnDuplicate := &gofeed.Item{GUID: "https://news.ycombinator.com/item?id=1", Link: "https://blog.example.com/a/?utm_source=hn"}
+	hnNew := &gofeed.Item{GUID: "https://news.ycombinator.com/item?id=2", Link: "https://example.com/b"}
+	lobstersNew := &gofeed.Item{GUID: "https://lobste.rs/s/b", Link: "http://www.example.com/b/"}
+	noLink := &gofeed.Item{GUID: "no-link"}
+
+	feeds := []gofeed.Feed{
+		{Items: []*gofeed.Item{hnDuplicate, hnNew}},
+		{Items: []*gofeed.Item{lobstersNew, noLink}},
+	}
+
+	deduped, duplicates := dedupeFeedItems(feeds, store)
+
+	if numItems(deduped) != 2 || deduped[0].Items[0] != hnNew || deduped[1].Items[0] != noLink {
+		t.Errorf("unexpected deduped items: %v", deduped)
+	}
+	if len(duplicates) != 2 ||
+		duplicates[0].item != hnDuplicate || duplicates[0].guid != cached.GUID ||
+		duplicates[1].item != lobstersNew || duplicates[1].guid != hnNew.GUID {
+		t.Errorf("unexpected duplicates: %v", duplicates)
+	}
+	if len(feeds[0].Items) != 2 {
+		t.Errorf("expected given feeds to be untouched, got %v", feeds[0].Items)
+	}
+
+	// duplicates are recorded, even before their counterparts are cached
+	if err := store.mergeDuplicates(); err != nil {
+		t.Fatalf("mergeDuplicates() error: %s", err)
+	}
+	if merged, err := store.isMergedDuplicate(lobstersNew.GUID); err != nil || !merged {
+		t.Errorf("expected the duplicate to be recorded, got %v (%v)", merged, err)
+	}
+
+	// (summarized and) cached the new item on a later tick
+	if deduped, duplicates := dedupeFeedItems([]gofeed.Feed{{Items: []*gofeed.Item{lobstersNew}}}, store); numItems(deduped) != 0 || len(duplicates) != 0 {
+		t.Errorf("expected the recorded duplicate to be dropped silently, got %v, %v", deduped, duplicates)
+	}
+	insertTestCachedItems(t, store, rf.CachedItem{GUID: hnNew.GUID, Link: hnNew.Link})
+	if err := store.saveCachedLinks(client.ListCachedItems(false)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.mergeDuplicates(); err != nil {
+		t.Fatalf("mergeDuplicates() error: %s", err)
+	}
+	// merging twice should not append links again
+	if err := store.mergeDuplicates(); err != nil {
+		t.Fatalf("mergeDuplicates() error: %s", err)
+	}
+
+	for _, item := range client.ListCachedItems(true) {
+		switch item.GUID {
+		case cached.GUID:
+			if !strings.HasPrefix(item.Description, "original") ||
+				strings.Count(item.Description, "https://news.ycombinator.com/item?id=1") != 2 { // href + text
+				t.Errorf("unexpected description of merged item: %s", item.Description)
+			}
+		case hnNew.GUID:
+			if strings.Count(item.Description, "https://lobste.rs/s/b") != 2 {
+				t.Errorf("unexpected description of merged item: %s", item.Description)
+			}
+		}
+	}
+
+	// (re-indexed with their merged descriptions)
+	if results, err := store.search("lobste", 10); err != nil || len(results) != 1 || results[0].GUID != hnNew.GUID {
+		t.Errorf("expected the merged item to be re-indexed, got %v (%v)", results, err)
+	}
+
+	// merged items are dropped on later ticks
+	deduped, duplicates = dedupeFeedItems([]gofeed.Feed{{Items: []*gofeed.Item{hnDuplicate, lobstersNew}}}, store)
+	if numItems(deduped) != 0 || len(duplicates) != 0 {
+		t.Errorf("expected merged items to be dropped silently, got %v, %v", deduped, duplicates)
+	}
+}
+
+func TestFeedStorePruneLinks(t *testing.T) {
+	_, store := newTestFeedStore(t)
+
+	if err := store.saveCachedLinks([]rf.CachedItem{{GUID: "deleted", Link: "https://example.com/deleted"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.recordDuplicates([]duplicatedItem{{item: &gofeed.Item{GUID: "pending"}, guid: "deferred", link: "https://example.com/pending"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.pruneLinks(); err != nil {
+		t.Fatalf("pruneLinks() error: %s", err)
+	}
+	if _, exists, err := store.cachedGUIDOf("https://example.com/deleted"); err != nil || exists {
+		t.Errorf("expected link to be pruned, got %v (%v)", exists, err)
+	}
+	// (duplicates of items which are not cached yet are kept)
+	if merged, err := store.isMergedDuplicate("pending"); err != nil || !merged {
+		t.Errorf("expected the pending duplicate to be kept, got %v (%v)", merged, err)
+	}
+}
@@ -0,0 +1,402 @@
+// discussion.go
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmcdole/gofeed"
+
+	rf "github.com/meinside/rss-feeds-go"
+)
+
+const (
+	defaultDiscussionMaxDepth    = 3
+	defaultDiscussionMaxComments = 50
+	defaultDiscussionMaxBytes    = 20 * 1024 // = 20KB
+
+	discussionFetchTimeout = 30 * time.Second
+	maxDiscussionBodyBytes = 10 * 1024 * 1024 // 10MB
+
+	discussionSectionHeader = "### What commenters are saying"
+
+	discussionPromptFormat = `Summarize what commenters are saying in the following comments on '%[2]s' (%[3]s) in %[1]s language, as a markdown list of a few bullet points.
+Focus on their opinions, and where they agree or disagree, not on the content of the item itself.
+
+<comments>
+%[4]s
+</comments>`
+)
+
+// errUnsupportedDiscussion is returned for links which are not of supported discussion sites
+var errUnsupportedDiscussion = errors.New("not a supported discussion")
+
+// trailing line of summaries appended by rss-feeds-go
+var _summarizedWithLine = regexp.MustCompile(`\n*\(summarized with [^\n]*\)\s*$`)
+
+// get the limits of discussions (defaults for missing ones)
+func (d configDiscussions) limits() (maxDepth, maxComments, maxBytes int) {
+	maxDepth, maxComments, maxBytes = d.MaxDepth, d.MaxComments, d.MaxBytes
+	if maxDepth <= 0 {
+		maxDepth = defaultDiscussionMaxDepth
+	}
+	if maxComments <= 0 {
+		maxComments = defaultDiscussionMaxComments
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultDiscussionMaxBytes
+	}
+	return maxDepth, maxComments, maxBytes
+}
+
+// discussionComment struct
+type discussionComment struct {
+	author string
+	text   string
+	depth  int // 0 for top-level comments
+}
+
+// fetch comments of given discussion `link` (Hacker News, Lobsters, or Reddit), in order of appearance
+func fetchDiscussion(ctx context.Context, polite *politeness, link string) (comments []discussionComment, err error) {
+	fetchURL, parse, err := discussionSourceOf(link)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.ReadCloser
+	if body, err = fetchDiscussionBody(ctx, polite, fetchURL); err != nil {
+		return nil, err
+	}
+	defer func() { _ = body.Close() }()
+	return parse(body)
+}
+
+// get the url to fetch comments of given discussion `link` from, and the parser of them
+//
+// returns `errUnsupportedDiscussion` if `link` is not of supported discussion sites.
+func discussionSourceOf(link string) (fetchURL string, parse func(io.Reader) ([]discussionComment, error), err error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", nil, err
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	switch {
+	case host == "news.ycombinator.com" && u.Path == "/item" && u.Query().Get("id") != "":
+		return link, parseHackerNewsComments, nil
+	case host == "lobste.rs" && strings.HasPrefix(u.Path, "/s/"):
+		id, _, _ := strings.Cut(strings.TrimPrefix(u.Path, "/s/"), "/")
+		return fmt.Sprintf("%s://%s/s/%s.json", u.Scheme, u.Host, id), parseLobstersComments, nil
+	case (host == "reddit.com" || host == "old.reddit.com") && strings.Contains(u.Path, "/comments/"):
+		return "https://old.reddit.com" + strings.TrimSuffix(u.Path, "/") + "/.json?raw_json=1", parseRedditComments, nil
+	}
+	return "", nil, errUnsupportedDiscussion
+}
+
+// fetch the body of given discussion url (must be closed after use)
+func fetchDiscussionBody(ctx context.Context, polite *politeness, link string) (io.ReadCloser, error) {
+	ctx, cancel := context.WithTimeout(ctx, discussionFetchTimeout)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", polite.userAgentOr(fetchUserAgent))
+
+	resp, err := polite.httpClient().Do(req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to fetch discussion: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("http error %d", resp.StatusCode)
+	}
+
+	return &cancelingBody{
+		Reader: io.LimitReader(resp.Body, maxDiscussionBodyBytes),
+		closer: resp.Body,
+		cancel: cancel,
+	}, nil
+}
+
+// cancelingBody struct (cancels its context on close)
+type cancelingBody struct {
+	io.Reader
+	closer io.Closer
+	cancel context.CancelFunc
+}
+
+// Close implements io.Closer
+func (b *cancelingBody) Close() error {
+	defer b.cancel()
+	return b.closer.Close()
+}
+
+// parse comments of a Hacker News item page
+func parseHackerNewsComments(r io.Reader) (comments []discussionComment, err error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse hacker news page: %w", err)
+	}
+
+	doc.Find("tr.athing.comtr").Each(func(_ int, row *goquery.Selection) {
+		text := row.Find(".commtext").First()
+		text.Find(".reply").Remove()
+		if text.Length() == 0 { // (deleted or flagged)
+			return
+		}
+
+		depth := 0
+		if indent, exists := row.Find("td.ind").Attr("indent"); exists {
+			depth, _ = strconv.Atoi(indent)
+		} else if width, exists := row.Find("td.ind img").Attr("width"); exists {
+			if w, err := strconv.Atoi(width); err == nil {
+				depth = w / 40
+			}
+		}
+
+		comments = append(comments, discussionComment{
+			author: strings.TrimSpace(row.Find(".hnuser").First().Text()),
+			text:   normalizeSpaces(text.Text()),
+			depth:  depth,
+		})
+	})
+	return comments, nil
+}
+
+// parse comments of a Lobsters story (json)
+func parseLobstersComments(r io.Reader) (comments []discussionComment, err error) {
+	var story struct {
+		Comments []struct {
+			Comment        string          `json:"comment"` // (html)
+			CommentPlain   string          `json:"comment_plain"`
+			Depth          *int            `json:"depth"`
+			IndentLevel    *int            `json:"indent_level"` // (starts from 1)
+			CommentingUser json.RawMessage `json:"commenting_user"`
+			IsDeleted      bool            `json:"is_deleted"`
+		} `json:"comments"`
+	}
+	if err = json.NewDecoder(r).Decode(&story); err != nil {
+		return nil, fmt.Errorf("failed to parse lobsters story: %w", err)
+	}
+
+	for _, c := range story.Comments {
+		if c.IsDeleted {
+			continue
+		}
+
+		text := c.CommentPlain
+		if text == "" {
+			if doc, err := goquery.NewDocumentFromReader(strings.NewReader(c.Comment)); err == nil {
+				text = doc.Text()
+			}
+		}
+
+		depth := 0
+		if c.Depth != nil {
+			depth = *c.Depth
+		} else if c.IndentLevel != nil {
+			depth = max(*c.IndentLevel-1, 0)
+		}
+
+		// (commenting user is a name, or an object of the user)
+		var author string
+		if err := json.Unmarshal(c.CommentingUser, &author); err != nil {
+			var user struct {
+				Username string `json:"username"`
+			}
+			_ = json.Unmarshal(c.CommentingUser, &user)
+			author = user.Username
+		}
+
+		if text = normalizeSpaces(text); text != "" {
+			comments = append(comments, discussionComment{author: author, text: text, depth: depth})
+		}
+	}
+	return comments, nil
+}
+
+// redditListing struct
+type redditListing struct {
+	Data struct {
+		Children []struct {
+			Kind string `json:"kind"`
+			Data struct {
+				Author  string          `json:"author"`
+				Body    string          `json:"body"`
+				Depth   int             `json:"depth"`
+				Replies json.RawMessage `json:"replies"` // (a listing, or an empty string)
+			} `json:"data"`
+		} `json:"children"`
+	} `json:"data"`
+}
+
+// parse comments of a Reddit post (json)
+func parseRedditComments(r io.Reader) (comments []discussionComment, err error) {
+	var listings []redditListing // [post, comments]
+	if err = json.NewDecoder(r).Decode(&listings); err != nil {
+		return nil, fmt.Errorf("failed to parse reddit comments: %w", err)
+	}
+	if len(listings) < 2 {
+		return nil, nil
+	}
+
+	var walk func(listing redditListing)
+	walk = func(listing redditListing) {
+		for _, child := range listing.Data.Children {
+			if child.Kind != "t1" { // (skip "load more comments")
+				continue
+			}
+			if text := normalizeSpaces(child.Data.Body); text != "" && text != "[deleted]" && text != "[removed]" {
+				comments = append(comments, discussionComment{author: child.Data.Author, text: text, depth: child.Data.Depth})
+			}
+
+			var replies redditListing
+			if err := json.Unmarshal(child.Data.Replies, &replies); err == nil {
+				walk(replies)
+			}
+		}
+	}
+	walk(listings[1])
+
+	return comments, nil
+}
+
+// format given comments as a text (as a thread with indentations), within the limits
+func formatDiscussion(comments []discussionComment, maxDepth, maxComments, maxBytes int) (text string, num int) {
+	var sb strings.Builder
+	for _, c := range comments {
+		if c.depth >= maxDepth {
+			continue
+		}
+		if num >= maxComments {
+			break
+		}
+
+		line := fmt.Sprintf("%s- %s: %s\n", strings.Repeat("  ", c.depth), c.author, c.text)
+		if sb.Len()+len(line) > maxBytes {
+			if num == 0 { // (at least one comment)
+				sb.WriteString(truncateText(line, maxBytes))
+				num++
+			}
+			break
+		}
+		sb.WriteString(line)
+		num++
+	}
+	return sb.String(), num
+}
+
+// summarize discussions of given items of feed `f`, and append them to the cached summaries of the items
+//
+// formatted comments are summarized with a prompt for comments (with the summarizer of the feed, or Google Gemini API),
+// and only the appended sections are saved.
+func summarizeDiscussions(ctx context.Context, f *feed, fs []gofeed.Feed, conf config) {
+	if f.conf.SummarizeDiscussions == nil {
+		return
+	}
+	maxDepth, maxComments, maxBytes := f.conf.SummarizeDiscussions.limits()
+
+	var s summarizer = f.gemini
+	if f.summarizer != nil {
+		s = f.summarizer
+	}
+
+	summarized := 0
+	for _, feed := range fs {
+		for _, item := range feed.Items {
+			link := discussionLinkOf(item)
+			if link == "" {
+				continue
+			}
+			if cached, err := f.store.cachedItemsOf([]string{item.GUID}); err != nil || len(cached) == 0 || isFailedSummary(cached[0].Summary) {
+				continue
+			}
+
+			comments, err := fetchDiscussion(ctx, f.polite, link)
+			if err != nil {
+				if conf.Verbose && !errors.Is(err, errUnsupportedDiscussion) {
+					log.Printf(">>> failed to fetch discussion of '%s' (%s): %s", item.Title, link, err)
+				}
+				continue
+			}
+			text, num := formatDiscussion(comments, maxDepth, maxComments, maxBytes)
+			if num == 0 {
+				continue
+			}
+
+			// (wait between generations, for not hitting rate limits)
+			if summarized > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(s.interval()):
+				}
+			}
+			summarized++
+
+			if conf.Verbose {
+				log.Printf(">>> summarizing %d comment(s) of '%s' (%s)", num, item.Title, link)
+			}
+
+			genCtx, cancel := context.WithTimeout(ctx, promptSummaryTimeout)
+			_, _, summary, _, err := s.generate(genCtx, summaryRequest{
+				title:   item.Title,
+				url:     link,
+				content: text,
+				prompt:  fmt.Sprintf(discussionPromptFormat, *conf.DesiredLanguage, item.Title, link, text),
+			})
+			cancel()
+			if err != nil {
+				log.Printf("# failed to summarize discussion of '%s': %s", item.Title, err)
+				continue
+			}
+
+			if err := f.store.appendDiscussionSummary(item.GUID, summary); err != nil {
+				log.Printf("# failed to append summary of discussion to '%s': %s", item.GUID, err)
+			}
+		}
+	}
+}
+
+// append given summary of a discussion to the cached summary of `guid` (before its trailing line)
+func (s *feedStore) appendDiscussionSummary(guid, discussion string) error {
+	cached, err := s.cachedItemsOf([]string{guid})
+	if err != nil {
+		return err
+	}
+	if len(cached) == 0 {
+		return fmt.Errorf("no such cached item: '%s'", guid)
+	}
+	summary := cached[0].Summary
+
+	section := "\n\n" + discussionSectionHeader + "\n\n" + strings.TrimSpace(discussion)
+	if loc := _summarizedWithLine.FindStringIndex(summary); loc != nil {
+		summary = summary[:loc[0]] + section + summary[loc[0]:]
+	} else {
+		summary += section
+	}
+
+	if err := s.db.Model(&rf.CachedItem{}).Where("guid = ?", guid).Updates(map[string]any{
+		"summary":    summary,
+		"updated_at": time.Now(),
+	}).Error; err != nil {
+		return err
+	}
+	return s.indexItems([]string{guid})
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"gorm.io/gorm"
+
+	rf "github.com/meinside/rss-feeds-go"
+)
+
+const testHackerNewsHTML = `<html><body><table>
+<tr class="athing comtr" id="1"><td><table><tr>
+	<td class="ind" indent="0"><img src="s.gif" height="1" width="0"></td>
+	<td class="default"><span class="comhead"><a class="hnuser">alice</a></span>
+	<div class="comment"><div class="commtext c00">Top-level <i>comment</i>.<p>Second paragraph.</p></div><div class="reply"><a>reply</a></div></div></td>
+</tr></table></td></tr>
+<tr class="athing comtr" id="2"><td><table><tr>
+	<td class="ind" indent="1"><img src="s.gif" height="1" width="40"></td>
+	<td class="default"><span class="comhead"><a class="hnuser">bob</a></span>
+	<div class="comment"><div class="commtext c00">A reply.</div></div></td>
+</tr></table></td></tr>
+<tr class="athing comtr" id="3"><td><table><tr>
+	<td class="ind" indent="0"></td>
+	<td class="default"><div class="comment">[flagged]</div></td>
+</tr></table></td></tr>
+</table></body></html>`
+
+const testLobstersJSON = `{"comments": [
+	{"comment": "<p>html comment</p>", "comment_plain": "plain comment", "depth": 0, "commenting_user": "carol"},
+	{"comment": "<p>nested <b>reply</b></p>", "indent_level": 2, "commenting_user": {"username": "dave"}},
+	{"comment": "", "depth": 0, "is_deleted": true, "commenting_user": "eve"}
+]}`
+
+const testRedditJSON = `[
+	{"kind": "Listing", "data": {"children": [{"kind": "t3", "data": {"author": "op", "body": ""}}]}},
+	{"kind": "Listing", "data": {"children": [
+		{"kind": "t1", "data": {"author": "frank", "body": "first", "depth": 0, "replies": {"kind": "Listing", "data": {"children": [
+			{"kind": "t1", "data": {"author": "grace", "body": "nested", "depth": 1, "replies": ""}},
+			{"kind": "more", "data": {}}
+		]}}}},
+		{"kind": "t1", "data": {"author": "[deleted]", "body": "[removed]", "depth": 0, "replies": ""}},
+		{"kind": "t1", "data": {"author": "heidi", "body": "second", "depth": 0, "replies": ""}}
+	]}}
+]`
+
+func TestParseDiscussionComments(t *testing.T) {
+	hn, err := parseHackerNewsComments(strings.NewReader(testHackerNewsHTML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lobsters, err := parseLobstersComments(strings.NewReader(testLobstersJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reddit, err := parseRedditComments(strings.NewReader(testRedditJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		comments []discussionComment
+		want     []discussionComment
+	}{
+		{
+			name:     "hacker news",
+			comments: hn,
+			want: []discussionComment{
+				{author: "alice", text: "Top-level comment.Second paragraph.", depth: 0},
+				{author: "bob", text: "A reply.", depth: 1},
+			},
+		},
+		{
+			name:     "lobsters",
+			comments: lobsters,
+			want: []discussionComment{
+				{author: "carol", text: "plain comment", depth: 0},
+				{author: "dave", text: "nested reply", depth: 1},
+			},
+		},
+		{
+			name:     "reddit",
+			comments: reddit,
+			want: []discussionComment{
+				{author: "frank", text: "first", depth: 0},
+				{author: "grace", text: "nested", depth: 1},
+				{author: "heidi", text: "second", depth: 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		if len(tt.comments) != len(tt.want) {
+			t.Errorf("[%s] expected %d comments, got %+v", tt.name, len(tt.want), tt.comments)
+			continue
+		}
+		for i, want := range tt.want {
+			if tt.comments[i] != want {
+				t.Errorf("[%s] comment %d = %+v, want %+v", tt.name, i, tt.comments[i], want)
+			}
+		}
+	}
+}
+
+func TestFormatDiscussion(t *testing.T) {
+	comments := []discussionComment{
+		{author: "a", text: "top 1", depth: 0},
+		{author: "b", text: "reply 1", depth: 1},
+		{author: "c", text: "reply 2", depth: 2},
+		{author: "d", text: "top 2", depth: 0},
+	}
+
+	tests := []struct {
+		maxDepth, maxComments, maxBytes int
+		want                            string
+		wantNum                         int
+	}{
+		{maxDepth: 3, maxComments: 10, maxBytes: 1000, want: "- a: top 1\n  - b: reply 1\n    - c: reply 2\n- d: top 2\n", wantNum: 4},
+		{maxDepth: 1, maxComments: 10, maxBytes: 1000, want: "- a: top 1\n- d: top 2\n", wantNum: 2},
+		{maxDepth: 3, maxComments: 2, maxBytes: 1000, want: "- a: top 1\n  - b: reply 1\n", wantNum: 2},
+		{maxDepth: 3, maxComments: 10, maxBytes: 26, want: "- a: top 1\n  - b: reply 1\n", wantNum: 2},
+	}
+
+	for _, tt := range tests {
+		if got, num := formatDiscussion(comments, tt.maxDepth, tt.maxComments, tt.maxBytes); got != tt.want || num != tt.wantNum {
+			t.Errorf("formatDiscussion(%d, %d, %d) = %q (%d), want %q (%d)", tt.maxDepth, tt.maxComments, tt.maxBytes, got, num, tt.want, tt.wantNum)
+		}
+	}
+
+	if maxDepth, maxComments, maxBytes := (configDiscussions{MaxDepth: 1}).limits(); maxDepth != 1 ||
+		maxComments != defaultDiscussionMaxComments || maxBytes != defaultDiscussionMaxBytes {
+		t.Errorf("unexpected limits: %d, %d, %d", maxDepth, maxComments, maxBytes)
+	}
+}
+
+func TestFetchDiscussion_Unsupported(t *testing.T) {
+	for _, link := range []string{
+		"https://example.com/article",
+		"https://news.ycombinator.com/news",
+		"https://www.reddit.com/r/golang/",
+	} {
+		if _, err := fetchDiscussion(context.Background(), nil, link); !errors.Is(err, errUnsupportedDiscussion) {
+			t.Errorf("expected errUnsupportedDiscussion for '%s', got %v", link, err)
+		}
+	}
+}
+
+func TestAppendDiscussionSummary(t *testing.T) {
+	_, store := newTestFeedStore(t)
+
+	before := time.Now()
+	insertTestCachedItems(t, store,
+		rf.CachedItem{GUID: "with-trailer", Summary: "Article summary.\n\n(summarized with **model**, 2026-01-01 00:00:00 (Thu) UTC)", Model: gorm.Model{UpdatedAt: before.Add(-time.Hour)}},
+		rf.CachedItem{GUID: "without-trailer", Summary: "Article summary.", Model: gorm.Model{UpdatedAt: before.Add(-time.Hour)}},
+	)
+
+	for _, guid := range []string{"with-trailer", "without-trailer"} {
+		if err := store.appendDiscussionSummary(guid, "Comments summary.\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.appendDiscussionSummary("missing", "Comments summary."); err == nil {
+		t.Error("expected error for a missing item, got nil")
+	}
+
+	items, err := store.cachedItemsOf([]string{"with-trailer", "without-trailer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"with-trailer":    "Article summary.\n\n" + discussionSectionHeader + "\n\nComments summary.\n\n(summarized with **model**, 2026-01-01 00:00:00 (Thu) UTC)",
+		"without-trailer": "Article summary.\n\n" + discussionSectionHeader + "\n\nComments summary.",
+	}
+	for _, item := range items {
+		if item.Summary != expected[item.GUID] {
+			t.Errorf("unexpected summary of '%s': %q", item.GUID, item.Summary)
+		}
+		if item.UpdatedAt.Before(before) {
+			t.Errorf("expected updated_at of '%s' to be touched, got %s", item.GUID, item.UpdatedAt)
+		}
+	}
+}
+
+// rewriteTransport is a http.RoundTripper which sends all requests to a test server
+type rewriteTransport struct {
+	target *url.URL
+}
+
+// RoundTrip implements http.RoundTripper
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = t.target.Scheme, t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestSummarizeDiscussions(t *testing.T) {
+	discussions := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = io.WriteString(w, testHackerNewsHTML)
+	}))
+	defer discussions.Close()
+	target, _ := url.Parse(discussions.URL)
+	transport := http.DefaultClient.Transport
+	http.DefaultClient.Transport = rewriteTransport{target: target}
+	defer func() { http.DefaultClient.Transport = transport }()
+
+	_, store := newTestFeedStore(t)
+	insertTestCachedItems(t, store, rf.CachedItem{GUID: "1", Summary: "Article summary.\n\n(summarized with **model1**, 2026-01-01 00:00:00 (Thu) UTC)"})
+
+	conf := config{
+		GoogleAIModels:  []string{"model1"},
+		DesiredLanguage: new("Korean"),
+		RSSFeeds:        []configRSSFeed{{Name: "test", SummarizeDiscussions: &configDiscussions{}}},
+	}
+	usage := newUsageAccountant(conf, []string{"key1"})
+	server := newTestGeminiServer(t)
+	f := &feed{
+		conf:   conf.RSSFeeds[0],
+		store:  store,
+		usage:  usage,
+		gemini: newTestGeminiSummarizer(usage, server),
+	}
+
+	link := "https://news.ycombinator.com/item?id=1"
+	fs := []gofeed.Feed{{Items: []*gofeed.Item{
+		{GUID: "1", Title: "Article", Link: "https://example.com/article", Links: []string{"https://example.com/article", link}},
+		{GUID: "2", Title: "Uncached", Link: "https://example.com/uncached", Links: []string{"https://example.com/uncached", link}},
+	}}}
+	summarizeDiscussions(withUsageFeed(context.Background(), "test"), f, fs, conf)
+
+	// (summarized with the prompt for comments, only for the cached item)
+	if len(server.bodies) != 1 || !strings.Contains(server.bodies[0], "what commenters are saying") || !strings.Contains(server.bodies[0], "alice: Top-level comment") {
+		t.Errorf("expected the prompt for comments, got: %v", server.bodies)
+	}
+	items, err := store.cachedItemsOf([]string{"1", "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Summary != "Article summary.\n\n"+discussionSectionHeader+"\n\nSummarized.\n\n(summarized with **model1**, 2026-01-01 00:00:00 (Thu) UTC)" {
+		t.Errorf("unexpected cached items: %+v", items)
+	}
+}
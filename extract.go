@@ -0,0 +1,340 @@
+// extract.go
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/yuin/goldmark"
+	"golang.org/x/net/html"
+)
+
+const (
+	contentFetchTimeout   = 60 * time.Second
+	maxContentBodyBytes   = 20 * 1024 * 1024 // 20MB
+	maxPDFDocumentBytes   = 15 * 1024 * 1024 // 15MB (requests of Google Gemini API with inline documents are limited to 20MB, after base64 encoding)
+	minReadableTextLength = 200              // shorter texts are not considered as readable contents
+	minParagraphLength    = 25               // shorter paragraphs are not scored
+)
+
+// elements which never contain readable contents
+var _unreadableElements = []string{
+	"script", "style", "noscript", "template", "iframe", "svg", "canvas",
+	"form", "button", "input", "select", "textarea",
+	"nav", "header", "footer", "aside", "menu", "dialog",
+	`link[rel="stylesheet"]`,
+}
+
+// class names and ids which (un)likely contain readable contents
+var (
+	_positiveHints = regexp.MustCompile(`(?i)article|body|content|entry|main|page|post|story|text|blog`)
+	_negativeHints = regexp.MustCompile(`(?i)comment|meta|footer|footnote|sidebar|sponsor|share|social|promo|related|banner|combx|masthead|menu|nav|popup|subscribe|newsletter|widget|\bads?\b`)
+)
+
+// get the readable (main) text of given html document
+//
+// paragraphs are scored by their lengths and commas, and their scores are added to their parents (and halves to grandparents).
+// then the container with the best score (weighted by class names/ids and link density) is chosen as the main content.
+func extractReadableText(doc *goquery.Document) string {
+	doc.Find(strings.Join(_unreadableElements, ", ")).Remove()
+
+	scores := map[*html.Node]float64{}
+	candidates := []*goquery.Selection{}
+	addScore := func(s *goquery.Selection, score float64) {
+		if s.Length() == 0 || goquery.NodeName(s) == "html" {
+			return
+		}
+		node := s.Get(0)
+		if _, exists := scores[node]; !exists {
+			scores[node] = initialScoreOf(s)
+			candidates = append(candidates, s)
+		}
+		scores[node] += score
+	}
+
+	doc.Find("p, pre, td, blockquote").Each(func(_ int, s *goquery.Selection) {
+		text := normalizeSpaces(s.Text())
+		if len(text) < minParagraphLength {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ",")) + math.Min(float64(len(text))/100, 3)
+
+		parent := s.Parent()
+		addScore(parent, score)
+		addScore(parent.Parent(), score/2)
+	})
+
+	var best *goquery.Selection
+	bestScore := 0.0
+	for _, candidate := range candidates {
+		score := scores[candidate.Get(0)] * (1 - linkDensityOf(candidate))
+		if best == nil || score > bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+	if best == nil {
+		best = doc.Find("body")
+	}
+
+	if text := blockTextOf(best); len(text) >= minReadableTextLength {
+		return text
+	}
+	return normalizeLines(best.Text())
+}
+
+// initial score of given candidate by its tag name, class name and id
+func initialScoreOf(s *goquery.Selection) (score float64) {
+	switch goquery.NodeName(s) {
+	case "article", "main":
+		score += 10
+	case "div":
+		score += 5
+	case "pre", "td", "blockquote":
+		score += 3
+	case "ol", "ul", "dl", "dd", "dt", "li", "form":
+		score -= 3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		score -= 5
+	}
+
+	for _, attr := range []string{"class", "id"} {
+		if value, exists := s.Attr(attr); exists && value != "" {
+			if _negativeHints.MatchString(value) {
+				score -= 25
+			}
+			if _positiveHints.MatchString(value) {
+				score += 25
+			}
+		}
+	}
+	return score
+}
+
+// ratio of link texts in the text of given selection
+func linkDensityOf(s *goquery.Selection) float64 {
+	textLength := len(normalizeSpaces(s.Text()))
+	if textLength == 0 {
+		return 0
+	}
+	linkLength := 0
+	s.Find("a").Each(func(_ int, a *goquery.Selection) {
+		linkLength += len(normalizeSpaces(a.Text()))
+	})
+	return float64(linkLength) / float64(textLength)
+}
+
+// text of block elements in given selection, separated by empty lines
+func blockTextOf(s *goquery.Selection) string {
+	const blocks = "h1, h2, h3, h4, h5, h6, p, pre, blockquote, li"
+
+	texts := []string{}
+	s.Find(blocks).Each(func(_ int, block *goquery.Selection) {
+		if block.ParentsFiltered("p, pre, blockquote, li").Length() > 0 {
+			return // (already included in its parent's text)
+		}
+		if text := normalizeSpaces(block.Text()); text != "" {
+			texts = append(texts, text)
+		}
+	})
+	return strings.Join(texts, "\n\n")
+}
+
+// collapse all whitespaces in given text into single spaces
+func normalizeSpaces(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// collapse whitespaces of each line in given text, and drop empty lines
+func normalizeLines(text string) string {
+	lines := []string{}
+	for line := range strings.SplitSeq(text, "\n") {
+		if line = normalizeSpaces(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// errSkippedContent is returned for contents which are not to be extracted
+var errSkippedContent = errors.New("content not to be extracted")
+
+// media type of given content, from its `Content-Type` header, or sniffed from its url and leading bytes
+func sniffContentType(header, link string, head []byte) string {
+	mediaType, _, _ := mime.ParseMediaType(header)
+	switch mediaType {
+	case "", "text/plain", "application/octet-stream", "binary/octet-stream": // (generic ones)
+	default:
+		return mediaType
+	}
+
+	if u, err := url.Parse(link); err == nil {
+		switch strings.ToLower(path.Ext(u.Path)) {
+		case ".pdf":
+			return "application/pdf"
+		case ".md", ".markdown":
+			return "text/markdown"
+		case ".txt":
+			return "text/plain"
+		}
+	}
+
+	if mediaType != "text/plain" {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(head))
+	}
+	return mediaType
+}
+
+// fetch given `link` over plain http (politely), and extract its text by its (sniffed) content type
+//
+// html documents are extracted in a readability-style manner when `withHTML` is true (or `errSkippedContent` is returned),
+// pdf documents are extracted as texts when `withPDF` is true (or returned as they are in `document`, for models which read them by themselves),
+// and markdown and plain texts are always extracted as texts.
+// extracted texts are truncated to `maxTextBytes` (no limit if <= 0), and pdf documents larger than `maxPDFDocumentBytes` are not read.
+func fetchContentText(ctx context.Context, polite *politeness, link string, withHTML, withPDF bool, maxTextBytes int) (text, mediaType string, document []byte, err error) {
+	ctx, cancel := context.WithTimeout(ctx, contentFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", polite.userAgentOr(fetchUserAgent))
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/pdf,text/markdown,text/plain;q=0.9,*/*;q=0.8")
+
+	resp, err := polite.httpClient().Do(req)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("failed to fetch: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", nil, fmt.Errorf("http error %d", resp.StatusCode)
+	}
+
+	// sniff the content type, (without reading the body of html documents which are not to be extracted)
+	body := bufio.NewReader(io.LimitReader(resp.Body, maxContentBodyBytes))
+	if mediaType = sniffContentType(resp.Header.Get("Content-Type"), link, nil); !isHTMLContent(mediaType) {
+		head, _ := body.Peek(512)
+		mediaType = sniffContentType(resp.Header.Get("Content-Type"), link, head)
+	}
+
+	switch {
+	case isHTMLContent(mediaType):
+		if !withHTML {
+			return "", mediaType, nil, errSkippedContent
+		}
+		var doc *goquery.Document
+		if doc, err = goquery.NewDocumentFromReader(body); err != nil {
+			return "", mediaType, nil, fmt.Errorf("failed to parse html: %w", err)
+		}
+		text = extractReadableText(doc)
+	case mediaType == "application/pdf":
+		var data []byte
+		if data, err = io.ReadAll(io.LimitReader(body, maxPDFDocumentBytes+1)); err != nil {
+			return "", mediaType, nil, fmt.Errorf("failed to read pdf: %w", err)
+		} else if len(data) > maxPDFDocumentBytes {
+			return "", mediaType, nil, fmt.Errorf("pdf document is larger than %d bytes", maxPDFDocumentBytes)
+		}
+		if !withPDF {
+			return "", mediaType, data, nil
+		}
+		if text, err = extractPDFText(data, maxTextBytes); err != nil {
+			return "", mediaType, nil, fmt.Errorf("failed to extract text from pdf: %w", err)
+		}
+	case mediaType == "text/markdown" || mediaType == "text/x-markdown":
+		var data []byte
+		if data, err = io.ReadAll(body); err != nil {
+			return "", mediaType, nil, fmt.Errorf("failed to read markdown: %w", err)
+		}
+		if text, err = markdownText(data); err != nil {
+			return "", mediaType, nil, fmt.Errorf("failed to convert markdown: %w", err)
+		}
+	case mediaType == "text/plain":
+		var data []byte
+		if data, err = io.ReadAll(body); err != nil {
+			return "", mediaType, nil, fmt.Errorf("failed to read text: %w", err)
+		}
+		text = normalizeParagraphs(strings.ToValidUTF8(string(data), ""))
+	default:
+		return "", mediaType, nil, fmt.Errorf("not an extractable content type: '%s'", mediaType)
+	}
+
+	if len(text) < minReadableTextLength {
+		return "", mediaType, nil, fmt.Errorf("extracted text is too short (%d bytes)", len(text))
+	}
+	return truncateText(text, maxTextBytes), mediaType, nil, nil
+}
+
+// check if given link is of a YouTube video
+func isYouTubeLink(link string) bool {
+	if u, err := url.Parse(link); err == nil {
+		switch strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.") {
+		case "youtube.com", "m.youtube.com", "youtu.be":
+			return true
+		}
+	}
+	return false
+}
+
+// check if given media type is of html documents
+func isHTMLContent(mediaType string) bool {
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// get the plain text of given markdown document
+func markdownText(data []byte) (string, error) {
+	var buf bytes.Buffer
+	if err := goldmark.Convert(data, &buf); err != nil {
+		return "", err
+	}
+	doc, err := goquery.NewDocumentFromReader(&buf)
+	if err != nil {
+		return "", err
+	}
+	return blockTextOf(doc.Selection), nil
+}
+
+// trim spaces of each line in given text, and collapse consecutive empty lines into one
+func normalizeParagraphs(text string) string {
+	lines := []string{}
+	empty := true
+	for line := range strings.SplitSeq(text, "\n") {
+		line = normalizeSpaces(line)
+		if line == "" {
+			if !empty {
+				lines = append(lines, "")
+			}
+			empty = true
+			continue
+		}
+		lines = append(lines, line)
+		empty = false
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// truncate given text to `maxBytes` bytes (at a rune boundary, no limit if <= 0)
+func truncateText(text string, maxBytes int) string {
+	if maxBytes <= 0 || len(text) <= maxBytes {
+		return text
+	}
+	for maxBytes > 0 && !utf8.RuneStart(text[maxBytes]) {
+		maxBytes--
+	}
+	return text[:maxBytes] + "\n\n(truncated)"
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmcdole/gofeed"
+)
+
+var testArticleParagraph = strings.Repeat("This is the main content of the article, which is long enough to be scored. ", 3)
+
+var testArticleHTML = `<html>
+<head><title>Test</title><style>body { color: red; }</style></head>
+<body>
+	<nav><a href="/">Home</a> <a href="/about">About</a></nav>
+	<div class="sidebar">
+		<p>Subscribe to our newsletter, and follow us on social media, for more news like this.</p>
+		<ul><li><a href="/1">Related article number one</a></li><li><a href="/2">Related article number two</a></li></ul>
+	</div>
+	<div class="post-content">
+		<h1>Headline</h1>
+		<p>` + testArticleParagraph + `</p>
+		<p>` + testArticleParagraph + `</p>
+		<script>alert("hello");</script>
+		<ul><li>First point</li><li>Second point</li></ul>
+	</div>
+	<footer><p>Copyright, all rights reserved, by the publisher of this site.</p></footer>
+</body>
+</html>`
+
+func TestExtractReadableText(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(testArticleHTML))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := extractReadableText(doc)
+	for _, expected := range []string{"Headline", strings.TrimSpace(testArticleParagraph), "First point"} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("expected '%s' in readable text: %s", expected, text)
+		}
+	}
+	for _, unexpected := range []string{"newsletter", "Related article", "Copyright", "alert", "About", "color: red"} {
+		if strings.Contains(text, unexpected) {
+			t.Errorf("unexpected '%s' in readable text: %s", unexpected, text)
+		}
+	}
+}
+
+func TestFetchContentText_HTML(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/article", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = io.WriteString(w, testArticleHTML)
+	})
+	mux.HandleFunc("/short", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = io.WriteString(w, "<html><body><p>too short</p></body></html>")
+	})
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	if text, _, _, err := fetchContentText(context.Background(), nil, server.URL+"/article", true, true, 0); err != nil {
+		t.Errorf("expected readable text, got error: %s", err)
+	} else if !strings.Contains(text, "Headline") {
+		t.Errorf("unexpected readable text: %s", text)
+	}
+
+	for _, path := range []string{"/short", "/json", "/missing"} {
+		if _, _, _, err := fetchContentText(context.Background(), nil, server.URL+path, true, true, 0); err == nil {
+			t.Errorf("expected error for '%s', got nil", path)
+		}
+	}
+}
+
+func TestSummarizeItemWithRF_ExtractedText(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/article", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = io.WriteString(w, testArticleHTML)
+	})
+	mux.HandleFunc("/paper", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		_, _ = w.Write(makeTestPDF(t, "BT /F1 12 Tf (A paper) Tj ET", false, ""))
+	})
+	articles := httptest.NewServer(mux)
+	defer articles.Close()
+
+	_, store := newTestFeedStore(t)
+
+	conf := config{
+		GoogleAIModels:  []string{"model1"},
+		DesiredLanguage: new("Korean"),
+		RSSFeeds:        []configRSSFeed{{Name: "test"}},
+	}
+	usage := newUsageAccountant(conf, []string{"key1"})
+	prompt, err := newSummaryPrompt(configSummaryPrompt{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newTestGeminiServer(t)
+	f := &feed{
+		conf:   conf.RSSFeeds[0],
+		store:  store,
+		usage:  usage,
+		prompt: prompt,
+		gemini: newTestGeminiSummarizer(usage, server),
+	}
+
+	// (readable text of the html document is extracted without a scrapper, and summarized with the default prompt)
+	item := &gofeed.Item{GUID: "1", Title: "Article", Link: articles.URL + "/article"}
+	model, title, summary, _, err := summarizeItemWithRF(withUsageFeed(context.Background(), "test"), f, item, nil, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model != "model1" || title != "Translated" || !strings.HasPrefix(summary, "Summarized.\n\n(summarized with **model1**") {
+		t.Errorf("unexpected summary: %s, %s, %s", model, title, summary)
+	}
+	if len(server.bodies) != 1 || !strings.Contains(server.bodies[0], "main content of the article") || !strings.Contains(server.bodies[0], item.Link) {
+		t.Errorf("expected the extracted text in the prompt, got: %v", server.bodies)
+	}
+
+	// (pdf documents are passed to the model as they are)
+	item = &gofeed.Item{GUID: "2", Title: "Paper", Link: articles.URL + "/paper"}
+	if model, _, _, _, err := summarizeItemWithRF(withUsageFeed(context.Background(), "test"), f, item, nil, conf); err != nil || model != "model1" {
+		t.Fatalf("unexpected result: %s, %v", model, err)
+	}
+	if len(server.bodies) != 2 || !strings.Contains(server.bodies[1], attachedDocumentContent) || !strings.Contains(server.bodies[1], `"mimeType":"application/pdf"`) {
+		t.Errorf("expected the pdf document in the request, got: %v", server.bodies)
+	}
+}
+
+func TestIsYouTubeLink(t *testing.T) {
+	tests := []struct {
+		link string
+		want bool
+	}{
+		{link: "https://www.youtube.com/watch?v=abc", want: true},
+		{link: "https://youtu.be/abc", want: true},
+		{link: "https://m.youtube.com/watch?v=abc", want: true},
+		{link: "https://example.com/youtube.com", want: false},
+		{link: "not a url", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isYouTubeLink(tt.link); got != tt.want {
+			t.Errorf("isYouTubeLink(%q) = %v, want %v", tt.link, got, tt.want)
+		}
+	}
+}
+
+func TestSniffContentType(t *testing.T) {
+	tests := []struct {
+		header string
+		link   string
+		head   []byte
+		want   string
+	}{
+		{header: "application/pdf", link: "https://example.com/paper", want: "application/pdf"},
+		{header: "text/html; charset=utf-8", link: "https://example.com/paper.pdf", want: "text/html"},
+		{header: "application/octet-stream", link: "https://example.com/paper.PDF?download=1", want: "application/pdf"},
+		{header: "", link: "https://example.com/README.md", want: "text/markdown"},
+		{header: "text/plain; charset=utf-8", link: "https://example.com/README.md", want: "text/markdown"},
+		{header: "text/plain", link: "https://example.com/page", head: []byte("<html>"), want: "text/plain"},
+		{header: "", link: "https://example.com/notes.txt", want: "text/plain"},
+		{header: "", link: "https://example.com/download", head: []byte("%PDF-1.7\n"), want: "application/pdf"},
+		{header: "binary/octet-stream", link: "https://example.com/page", head: []byte("<!DOCTYPE html><html>"), want: "text/html"},
+	}
+
+	for _, tt := range tests {
+		if got := sniffContentType(tt.header, tt.link, tt.head); got != tt.want {
+			t.Errorf("sniffContentType(%q, %q) = %q, want %q", tt.header, tt.link, got, tt.want)
+		}
+	}
+}
+
+func TestFetchContentText_NonHTML(t *testing.T) {
+	paragraph := strings.Repeat("Some plain words for testing extraction. ", 10)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/paper", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(makeTestPDF(t, "BT /F1 12 Tf ("+paragraph+") Tj ET", true, ""))
+	})
+	mux.HandleFunc("/large.pdf", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("%PDF-1.4\n"))
+		_, _ = w.Write(make([]byte, maxPDFDocumentBytes))
+	})
+	mux.HandleFunc("/README.md", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "# Title\n\nSome **bold** and [linked](https://example.com) words.\n\n"+paragraph+"\n\n```\ncode block\n```\n")
+	})
+	mux.HandleFunc("/notes", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(w, "  first line  \n\n\n\n"+paragraph+"\n")
+	})
+	mux.HandleFunc("/article", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = io.WriteString(w, testArticleHTML)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		path          string
+		wantMediaType string
+		want          []string
+		unwanted      []string
+	}{
+		{path: "/paper", wantMediaType: "application/pdf", want: []string{strings.TrimSpace(paragraph)}},
+		{path: "/README.md", wantMediaType: "text/markdown", want: []string{"Title", "Some bold and linked words.", "code block"}, unwanted: []string{"**", "](", "```"}},
+		{path: "/notes", wantMediaType: "text/plain", want: []string{"first line\n\nSome plain words"}},
+	}
+
+	for _, tt := range tests {
+		text, mediaType, _, err := fetchContentText(context.Background(), nil, server.URL+tt.path, false, true, 0)
+		if err != nil {
+			t.Errorf("failed to extract text of '%s': %s", tt.path, err)
+			continue
+		}
+		if mediaType != tt.wantMediaType {
+			t.Errorf("expected media type '%s' for '%s', got '%s'", tt.wantMediaType, tt.path, mediaType)
+		}
+		for _, expected := range tt.want {
+			if !strings.Contains(text, expected) {
+				t.Errorf("expected '%s' in text of '%s', got: %q", expected, tt.path, text)
+			}
+		}
+		for _, unexpected := range tt.unwanted {
+			if strings.Contains(text, unexpected) {
+				t.Errorf("unexpected '%s' in text of '%s', got: %q", unexpected, tt.path, text)
+			}
+		}
+	}
+
+	// html documents are left to scrappers
+	if _, _, _, err := fetchContentText(context.Background(), nil, server.URL+"/article", false, true, 0); !errors.Is(err, errSkippedContent) {
+		t.Errorf("expected errSkippedContent, got %v", err)
+	}
+
+	// extracted texts are truncated
+	if text, _, _, err := fetchContentText(context.Background(), nil, server.URL+"/paper", false, true, 100); err != nil || len(text) > 100+len("\n\n(truncated)") || !strings.HasSuffix(text, "(truncated)") {
+		t.Errorf("expected a truncated text, got %q, %v", text, err)
+	}
+
+	// too large pdf documents are not read
+	for _, withPDF := range []bool{true, false} {
+		if _, _, document, err := fetchContentText(context.Background(), nil, server.URL+"/large.pdf", false, withPDF, 0); err == nil || document != nil {
+			t.Errorf("expected error for a too large pdf document, got %d bytes, %v", len(document), err)
+		}
+	}
+
+	// pdf documents are returned as they are, for models which read them by themselves
+	if text, _, document, err := fetchContentText(context.Background(), nil, server.URL+"/paper", true, false, 0); err != nil || text != "" || !bytes.HasPrefix(document, []byte("%PDF-")) {
+		t.Errorf("expected the pdf document, got %q, %d bytes, %v", text, len(document), err)
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	if got := truncateText("short", 10); got != "short" {
+		t.Errorf("unexpected truncated text: %q", got)
+	}
+	if got := truncateText("long text", 0); got != "long text" {
+		t.Errorf("expected no truncation, got %q", got)
+	}
+	if got := truncateText("한글입니다", 4); !strings.HasPrefix(got, "한\n") || !utf8.ValidString(got) {
+		t.Errorf("expected truncation at a rune boundary, got %q", got)
+	}
+}
@@ -0,0 +1,232 @@
+// extractive.go
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	extractiveModelName = "extractive (TextRank)"
+
+	textRankDamping       = 0.85
+	textRankMaxIterations = 100
+	textRankTolerance     = 1e-6
+
+	minExtractiveSentenceLength = 20   // in runes
+	maxExtractiveSentenceLength = 1000 // in runes
+	maxExtractiveSentences      = 500  // (ranked in O(n^2))
+)
+
+// number of extracted sentences for lengths of summaries
+var _extractiveSentences = map[string]int{
+	"short":  3,
+	"medium": 5,
+	"long":   10,
+}
+
+// extractiveSummarizer struct
+//
+// summarizes contents locally by extracting their most central sentences with TextRank.
+// (no api calls, so titles and summaries are not translated)
+type extractiveSummarizer struct {
+	numSentences int
+	format       string
+}
+
+// create a new extractive summarizer for given length and format of summaries
+func newExtractiveSummarizer(length, format string) *extractiveSummarizer {
+	if length == "" {
+		length = defaultSummaryLength
+	}
+	if format == "" {
+		format = defaultSummaryFormat
+	}
+	return &extractiveSummarizer{
+		numSentences: _extractiveSentences[length],
+		format:       format,
+	}
+}
+
+// generate a summary with sentences extracted from the content of given request (the title is kept as it is)
+//
+// tags are the allowed ones which appear in the content. (no free-form tags)
+func (e *extractiveSummarizer) generate(ctx context.Context, req summaryRequest) (model, title, summary string, tags []string, err error) {
+	sentences := splitSentences(req.content)
+	if len(sentences) == 0 {
+		return extractiveModelName, "", "", nil, fmt.Errorf("no sentence to extract")
+	}
+
+	candidates := sentences
+	if e.format == "key_numbers" {
+		if withNumbers := slices.DeleteFunc(slices.Clone(sentences), func(s string) bool {
+			return !strings.ContainsFunc(s, unicode.IsDigit)
+		}); len(withNumbers) > 0 {
+			candidates = withNumbers
+		}
+	}
+
+	scores := textRank(candidates)
+
+	// pick the top-ranked sentences,
+	indices := make([]int, len(candidates))
+	for i := range indices {
+		indices[i] = i
+	}
+	slices.SortStableFunc(indices, func(a, b int) int {
+		if scores[a] > scores[b] {
+			return -1
+		} else if scores[a] < scores[b] {
+			return 1
+		}
+		return 0
+	})
+	top := indices[0]
+	indices = indices[:min(e.numSentences, len(indices))]
+
+	// and list them in their original order
+	slices.Sort(indices)
+	extracted := []string{}
+	for _, i := range indices {
+		extracted = append(extracted, candidates[i])
+	}
+
+	switch e.format {
+	case "bullet_points", "key_numbers":
+		summary = "- " + strings.Join(extracted, "\n- ")
+	case "tldr":
+		rest := slices.DeleteFunc(extracted, func(s string) bool { return s == candidates[top] })
+		summary = "**TL;DR**: " + candidates[top]
+		if len(rest) > 0 {
+			summary += "\n\n" + strings.Join(rest, " ")
+		}
+	default:
+		summary = strings.Join(extracted, " ")
+	}
+
+	if req.tagging != nil {
+		tags = req.tagging.match(req.title + "\n" + req.content)
+	}
+
+	return extractiveModelName, req.title, summary, tags, nil
+}
+
+// interval between summaries of items (no need to wait)
+func (e *extractiveSummarizer) interval() time.Duration {
+	return 0
+}
+
+// split given text into sentences
+func splitSentences(text string) (sentences []string) {
+	for line := range strings.SplitSeq(text, "\n") {
+		var sb strings.Builder
+		runes := []rune(strings.TrimSpace(line))
+		for i, r := range runes {
+			sb.WriteRune(r)
+
+			// (end of a sentence: terminal punctuations followed by a space, or at the end of the line)
+			if strings.ContainsRune(".!?。！？", r) && (i == len(runes)-1 || unicode.IsSpace(runes[i+1])) {
+				sentences = appendSentence(sentences, sb.String())
+				sb.Reset()
+			}
+		}
+		sentences = appendSentence(sentences, sb.String())
+
+		if len(sentences) >= maxExtractiveSentences {
+			return sentences[:maxExtractiveSentences]
+		}
+	}
+	return sentences
+}
+
+// append given sentence if its length is in range
+func appendSentence(sentences []string, sentence string) []string {
+	sentence = strings.TrimSpace(sentence)
+	if length := utf8.RuneCountInString(sentence); length >= minExtractiveSentenceLength && length <= maxExtractiveSentenceLength {
+		return append(sentences, sentence)
+	}
+	return sentences
+}
+
+// get the set of (lowercased) words in given sentence
+func wordsOf(sentence string) map[string]bool {
+	words := map[string]bool{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(sentence), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if utf8.RuneCountInString(word) > 1 {
+			words[word] = true
+		}
+	}
+	return words
+}
+
+// rank given sentences with TextRank (PageRank over a graph of sentences weighted by their word overlaps)
+func textRank(sentences []string) (scores []float64) {
+	n := len(sentences)
+
+	words := make([]map[string]bool, n)
+	for i, sentence := range sentences {
+		words[i] = wordsOf(sentence)
+	}
+
+	// similarities of sentences
+	weights := make([][]float64, n)
+	sums := make([]float64, n)
+	for i := range n {
+		weights[i] = make([]float64, n)
+	}
+	for i := range n {
+		for j := i + 1; j < n; j++ {
+			common := 0
+			for word := range words[i] {
+				if words[j][word] {
+					common++
+				}
+			}
+			if common == 0 {
+				continue
+			}
+			norm := math.Log(float64(len(words[i]))) + math.Log(float64(len(words[j])))
+			if norm <= 0 {
+				norm = 1
+			}
+			weights[i][j] = float64(common) / norm
+			weights[j][i] = weights[i][j]
+			sums[i] += weights[i][j]
+			sums[j] += weights[i][j]
+		}
+	}
+
+	// iterate until converged
+	scores = make([]float64, n)
+	for i := range scores {
+		scores[i] = 1
+	}
+	for range textRankMaxIterations {
+		next := make([]float64, n)
+		delta := 0.0
+		for i := range n {
+			rank := 0.0
+			for j := range n {
+				if weights[j][i] > 0 {
+					rank += weights[j][i] / sums[j] * scores[j]
+				}
+			}
+			next[i] = (1 - textRankDamping) + textRankDamping*rank
+			delta += math.Abs(next[i] - scores[i])
+		}
+		scores = next
+		if delta < textRankTolerance {
+			break
+		}
+	}
+	return scores
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const testExtractiveText = `Go is an open source programming language supported by Google.
+The Go programming language makes it easy to build simple, reliable, and efficient software! Go has a garbage collector.
+Many companies use the Go programming language for cloud software and services.
+The weather was nice yesterday, so we went to the beach.
+In 2024, Go was used by 3 million developers? Nobody knows.
+Short one.`
+
+func TestSplitSentences(t *testing.T) {
+	sentences := splitSentences(testExtractiveText + "\nVersion 1.26 of Go was released in February, with 10 new features.")
+
+	expected := []string{
+		"Go is an open source programming language supported by Google.",
+		"The Go programming language makes it easy to build simple, reliable, and efficient software!",
+		"Go has a garbage collector.",
+		"Many companies use the Go programming language for cloud software and services.",
+		"The weather was nice yesterday, so we went to the beach.",
+		"In 2024, Go was used by 3 million developers?",
+		"Version 1.26 of Go was released in February, with 10 new features.",
+	}
+	if len(sentences) != len(expected) {
+		t.Fatalf("expected %d sentences, got %q", len(expected), sentences)
+	}
+	for i, sentence := range expected {
+		if sentences[i] != sentence {
+			t.Errorf("sentence %d = %q, want %q", i, sentences[i], sentence)
+		}
+	}
+}
+
+func TestTextRank(t *testing.T) {
+	sentences := splitSentences(testExtractiveText)
+	scores := textRank(sentences)
+
+	// sentences about the go programming language are more central than the one about the weather
+	weather := 4
+	for _, i := range []int{0, 1, 3} {
+		if scores[i] <= scores[weather] {
+			t.Errorf("expected '%s' (%f) to be ranked higher than '%s' (%f)", sentences[i], scores[i], sentences[weather], scores[weather])
+		}
+	}
+}
+
+func TestExtractiveSummarizer_Generate(t *testing.T) {
+	tests := []struct {
+		length, format string
+		check          func(summary string) bool
+	}{
+		{length: "short", format: "", check: func(s string) bool {
+			return !strings.HasPrefix(s, "- ") && len(splitSentences(s)) == 3 && !strings.Contains(s, "weather")
+		}},
+		{length: "", format: "bullet_points", check: func(s string) bool {
+			return strings.HasPrefix(s, "- ") && strings.Count(s, "\n- ") == 4
+		}},
+		{length: "short", format: "key_numbers", check: func(s string) bool {
+			return s == "- In 2024, Go was used by 3 million developers?"
+		}},
+		{length: "short", format: "tldr", check: func(s string) bool {
+			return strings.HasPrefix(s, "**TL;DR**: ") && strings.Count(s, "\n\n") == 1
+		}},
+	}
+
+	for _, tt := range tests {
+		model, title, summary, _, err := newExtractiveSummarizer(tt.length, tt.format).generate(context.Background(), summaryRequest{
+			title:   "Title",
+			content: testExtractiveText,
+		})
+		if err != nil {
+			t.Errorf("[%s/%s] failed to generate: %s", tt.length, tt.format, err)
+			continue
+		}
+		if model != extractiveModelName || title != "Title" || !tt.check(summary) {
+			t.Errorf("[%s/%s] unexpected summary: %s, %s, %q", tt.length, tt.format, model, title, summary)
+		}
+	}
+
+	if _, _, _, _, err := newExtractiveSummarizer("", "").generate(context.Background(), summaryRequest{content: "too short"}); err == nil {
+		t.Error("expected error for a content without sentences, got nil")
+	}
+}
+
+func TestSummarizeAndCache_Extractive(t *testing.T) {
+	articles := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = io.WriteString(w, testArticleHTML)
+	}))
+	defer articles.Close()
+
+	// (no api keys at all)
+	path := writeTestConfig(t, `{
+		"db_files_dir": "`+t.TempDir()+`",
+		"rss_feeds": [{
+			"name": "t",
+			"cache_filename": "t.db",
+			"serve_path": "/t",
+			"feed_urls": ["https://example.com/rss"],
+			"summarizer": "extractive"
+		}],
+		"rss_server_port": 8080
+	}`)
+	conf, err := readConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := newFeed(conf, conf.RSSFeeds[0], newUsageAccountant(conf, apiKeysOf(conf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.store.close() }()
+
+	link := articles.URL + "/article"
+	items := []*gofeed.Item{
+		{GUID: "1", Title: "Article", Link: link, Links: []string{link}},
+		{GUID: "2", Title: "Another", Link: link, Links: []string{link}},
+	}
+	if deferred, err := summarizeAndCache(context.Background(), f, []gofeed.Feed{{Items: items}}, nil, conf); err != nil || len(deferred) > 0 {
+		t.Fatalf("unexpected result: %v, %v", deferred, err)
+	}
+
+	cached := f.client.ListCachedItems(false)
+	if len(cached) != 2 {
+		t.Fatalf("expected 2 cached items, got %d", len(cached))
+	}
+	for _, item := range cached {
+		if !strings.Contains(item.Summary, "main content of the article") ||
+			!strings.Contains(item.Summary, "(summarized with **"+extractiveModelName+"**") ||
+			isFailedSummary(item.Summary) {
+			t.Errorf("unexpected summary: %s", item.Summary)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+// fallback.go
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/genai"
+	"gorm.io/gorm/clause"
+
+	gt "github.com/meinside/gemini-things-go"
+	rf "github.com/meinside/rss-feeds-go"
+)
+
+const (
+	modelStatusOK      = "ok"
+	modelStatusFailing = "failing"
+	modelStatusSkipped = "skipped"
+)
+
+// finish reasons of blocked generations
+var _blockedFinishReasons = []genai.FinishReason{
+	genai.FinishReasonSafety,
+	genai.FinishReasonRecitation,
+	genai.FinishReasonBlocklist,
+	genai.FinishReasonProhibitedContent,
+	genai.FinishReasonSPII,
+}
+
+// modelState struct (health of a model)
+type modelState struct {
+	consecutiveFailures int
+	lastError           string
+	lastFailureAt       time.Time
+	lastSuccessAt       time.Time
+	skippedUntil        time.Time
+}
+
+// modelHealth struct
+//
+// tracks consecutive failures (errors or safety blocks) of models in the order of fallbacks,
+// and skips failing ones for a cooldown.
+type modelHealth struct {
+	models    []string
+	threshold int
+	cooldown  time.Duration
+
+	mu     sync.Mutex
+	states map[string]*modelState
+}
+
+// create a new model health for given `models` (in the order of fallbacks)
+func newModelHealth(models []string, threshold int, cooldown time.Duration) *modelHealth {
+	if threshold <= 0 {
+		threshold = defaultModelFailureThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = defaultModelCooldownSeconds * time.Second
+	}
+	return &modelHealth{
+		models:    models,
+		threshold: threshold,
+		cooldown:  cooldown,
+		states:    map[string]*modelState{},
+	}
+}
+
+// get the state of given model (should be called with the lock held)
+func (h *modelHealth) stateOf(model string) *modelState {
+	state, exists := h.states[model]
+	if !exists {
+		state = &modelState{}
+		h.states[model] = state
+	}
+	return state
+}
+
+// mark given model as succeeded at `now`
+func (h *modelHealth) succeeded(model string, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	state := h.stateOf(model)
+	state.consecutiveFailures = 0
+	state.lastSuccessAt = now
+	state.skippedUntil = time.Time{}
+}
+
+// mark given model as failed at `now`, and skip it if it failed too many times in a row
+//
+// (failures are not reset when skipping, so a model which fails again after it is skipped is skipped again)
+func (h *modelHealth) failed(model, reason string, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	state := h.stateOf(model)
+	state.consecutiveFailures++
+	state.lastError = reason
+	state.lastFailureAt = now
+	if state.consecutiveFailures >= h.threshold {
+		state.skippedUntil = now.Add(h.cooldown)
+	}
+}
+
+// check if given model is skipped at `now`, and until when
+func (h *modelHealth) skipped(model string, now time.Time) (until time.Time, skipped bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if state, exists := h.states[model]; exists && state.skippedUntil.After(now) {
+		return state.skippedUntil, true
+	}
+	return time.Time{}, false
+}
+
+// check if given error is a quota error of an (api key, model) pair
+//
+// (rss-feeds-go returns `rf.ErrNoAvailableAPIKey` instead, when its only pair hit its quota)
+func isQuotaExceeded(err error) bool {
+	return gt.IsQuotaExceeded(err) || errors.Is(err, rf.ErrNoAvailableAPIKey)
+}
+
+// get the reason of given error, if it is a failure of the model (not of the item),
+// eg. server errors or blocked generations
+func modelFailureOf(err error) (reason string, failed bool) {
+	if ae, isAPIError := gt.APIError(err); isAPIError && ae.Code >= http.StatusInternalServerError {
+		return fmt.Sprintf("http status %d: %s", ae.Code, ae.Message), true
+	}
+	if gt.IsModelOverloaded(err) {
+		return "model is overloaded", true
+	}
+	if strings.Contains(err.Error(), "prompt was blocked due to: ") {
+		return err.Error(), true
+	}
+	for _, finishReason := range _blockedFinishReasons {
+		if strings.Contains(err.Error(), "generation was terminated due to: "+string(finishReason)) {
+			return fmt.Sprintf("generation was blocked due to: %s", finishReason), true
+		}
+	}
+	return "", false
+}
+
+// try `fn` with (api key, model) pairs for the feed of given context, until it succeeds
+//
+// models are tried in the order of fallbacks, each with api keys which are not cooling down or over budgets.
+// (models which are skipped after repeated failures are not tried)
+// usages of the attempts are recorded, pairs which hit their quotas are cooled down,
+// and failures of models are counted for their health, before trying the next model.
+// returns `errNoAvailableGeminiKey` if no pair could be tried, or all of them hit their quotas.
+func (a *usageAccountant) try(ctx context.Context, fn func(combo geminiCombo) (counts usageCounts, err error)) (model string, err error) {
+	name := usageFeedOf(ctx)
+
+	var failure error // (last failure of a model)
+	for _, m := range a.models {
+	keys:
+		for i, apiKey := range a.apiKeys {
+			keyID := a.keyIDs[i]
+			if reason := a.blocked(name, keyID, m, time.Now()); reason != "" {
+				continue
+			}
+			if err = ctx.Err(); err != nil {
+				return model, err
+			}
+			model = m
+
+			counts, err := fn(geminiCombo{apiKey: apiKey, model: m})
+			counts.Requests++
+			now := time.Now()
+
+			if err == nil {
+				a.record(ctx, keyID, m, counts, now)
+				a.health.succeeded(m, now)
+				return m, nil
+			}
+
+			counts.Errors++
+			if isQuotaExceeded(err) {
+				counts.QuotaErrors++
+				a.record(ctx, keyID, m, counts, now)
+				a.cooldown(keyID, m, geminiCooldownOf(err), now)
+				continue
+			}
+			a.record(ctx, keyID, m, counts, now)
+
+			if reason, failed := modelFailureOf(err); failed {
+				a.health.failed(m, reason, now)
+				failure = err
+				break keys // (try the next model)
+			}
+			return m, err
+		}
+	}
+	if failure != nil {
+		return model, failure
+	}
+	return model, errNoAvailableGeminiKey
+}
+
+// modelHealthReport struct (health of a model)
+type modelHealthReport struct {
+	Model               string     `json:"model"`
+	Status              string     `json:"status"`
+	Preferred           bool       `json:"preferred,omitempty"` // (the first available one in the fallbacks, tried first)
+	ConsecutiveFailures int        `json:"consecutive_failures,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastFailureAt       *time.Time `json:"last_failure_at,omitempty"`
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"`
+	SkippedUntil        *time.Time `json:"skipped_until,omitempty"`
+}
+
+// build the health reports of models at `now` (in the order of fallbacks)
+func (h *modelHealth) reports(now time.Time) []modelHealthReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	reports := []modelHealthReport{}
+	for _, model := range h.models {
+		report := modelHealthReport{
+			Model:  model,
+			Status: modelStatusOK,
+		}
+		if state, exists := h.states[model]; exists {
+			report.ConsecutiveFailures = state.consecutiveFailures
+			report.LastError = state.lastError
+			if !state.lastFailureAt.IsZero() {
+				report.LastFailureAt = &state.lastFailureAt
+			}
+			if !state.lastSuccessAt.IsZero() {
+				report.LastSuccessAt = &state.lastSuccessAt
+			}
+			if state.skippedUntil.After(now) {
+				report.Status = modelStatusSkipped
+				report.SkippedUntil = &state.skippedUntil
+			} else if state.consecutiveFailures > 0 {
+				report.Status = modelStatusFailing
+			}
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// summaryModel struct (model which produced the summary of a cached item)
+type summaryModel struct {
+	GUID   string `gorm:"primaryKey"`
+	Model  string `gorm:"index"`
+	Failed bool   // (the model failed to summarize it)
+
+	UpdatedAt time.Time
+}
+
+// save the model which produced (or failed to produce) the summary of the cached item with given `guid`
+//
+// (recorded from the generation which was actually made, not from the summary)
+func (s *feedStore) saveSummaryModel(guid, model string, failed bool) error {
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "guid"}},
+		DoUpdates: clause.AssignmentColumns([]string{"model", "failed", "updated_at"}),
+	}).Create(&summaryModel{
+		GUID:   guid,
+		Model:  model,
+		Failed: failed,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to save model of '%s': %w", guid, err)
+	}
+	return nil
+}
+
+// get the model which produced the summary of the cached item with given `guid`
+func (s *feedStore) summaryModelOf(guid string) (model summaryModel, exists bool) {
+	if err := s.db.Where("guid = ?", guid).First(&model).Error; err == nil {
+		return model, true
+	}
+	return model, false
+}
+
+// count cached items summarized by each model
+func (s *feedStore) summaryModelCounts() (counts map[string]int, err error) {
+	var rows []struct {
+		Model string
+		Count int
+	}
+	if err = s.db.Model(&summaryModel{}).
+		Select("model, count(*) AS count").
+		Where("failed = ?", false).
+		Group("model").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count summary models: %w", err)
+	}
+
+	counts = map[string]int{}
+	for _, row := range rows {
+		counts[row.Model] = row.Count
+	}
+	return counts, nil
+}
+
+// delete models of items which were deleted from the cache
+func (s *feedStore) pruneSummaryModels() error {
+	return s.db.Where("guid NOT IN (SELECT guid FROM cached_items)").Delete(&summaryModel{}).Error
+}
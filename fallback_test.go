@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"google.golang.org/genai"
+
+	rf "github.com/meinside/rss-feeds-go"
+)
+
+func TestModelHealth(t *testing.T) {
+	health := newModelHealth([]string{"model1", "model2"}, 2, time.Minute)
+	now := time.Now()
+
+	// skipped after consecutive failures only
+	health.failed("model1", "http status 500", now)
+	health.succeeded("model1", now)
+	health.failed("model1", "http status 500", now)
+	if _, skipped := health.skipped("model1", now); skipped {
+		t.Error("expected model1 not to be skipped yet")
+	}
+	health.failed("model1", "generation was blocked due to: SAFETY", now)
+	until, skipped := health.skipped("model1", now)
+	if !skipped || !until.Equal(now.Add(time.Minute)) {
+		t.Errorf("expected model1 to be skipped for a minute, got %v, %v", until, skipped)
+	}
+
+	reports := health.reports(now)
+	if len(reports) != 2 || reports[0].Status != modelStatusSkipped || reports[0].ConsecutiveFailures != 2 || !strings.Contains(reports[0].LastError, "SAFETY") || reports[1].Status != modelStatusOK {
+		t.Errorf("unexpected reports: %+v", reports)
+	}
+
+	// available again after the cooldown, and skipped again on the next failure
+	if _, skipped := health.skipped("model1", now.Add(time.Minute)); skipped {
+		t.Error("expected model1 not to be skipped after the cooldown")
+	}
+	if reports := health.reports(now.Add(time.Minute)); reports[0].Status != modelStatusFailing {
+		t.Errorf("expected model1 to be failing, got %+v", reports[0])
+	}
+	health.failed("model1", "http status 503", now.Add(time.Minute))
+	if _, skipped := health.skipped("model1", now.Add(time.Minute)); !skipped {
+		t.Error("expected model1 to be skipped again")
+	}
+
+	// recovered on success
+	health.succeeded("model1", now.Add(2*time.Minute))
+	if _, skipped := health.skipped("model1", now.Add(2*time.Minute)); skipped {
+		t.Error("expected model1 to be recovered")
+	}
+}
+
+func TestModelFailureOf(t *testing.T) {
+	tests := []struct {
+		err        error
+		wantFailed bool
+	}{
+		{err: genai.APIError{Code: http.StatusInternalServerError, Message: "internal error"}, wantFailed: true},
+		{err: fmt.Errorf("wrapped: %w", genai.APIError{Code: http.StatusServiceUnavailable, Message: "The model is overloaded."}), wantFailed: true},
+		{err: genai.APIError{Code: http.StatusBadRequest, Message: "bad request"}, wantFailed: false},
+		{err: fmt.Errorf("generation was terminated due to: %s", genai.FinishReasonSafety), wantFailed: true},
+		{err: fmt.Errorf("generation was terminated due to: %s", genai.FinishReasonMaxTokens), wantFailed: false},
+		{err: fmt.Errorf("prompt was blocked due to: %s", genai.BlockedReasonOther), wantFailed: true},
+		{err: fmt.Errorf("failed to fetch content"), wantFailed: false},
+	}
+
+	for _, tt := range tests {
+		if reason, failed := modelFailureOf(tt.err); failed != tt.wantFailed || failed && reason == "" {
+			t.Errorf("modelFailureOf(%v) = %q, %v, want %v", tt.err, reason, failed, tt.wantFailed)
+		}
+	}
+}
+
+func TestFeedStoreSummaryModels(t *testing.T) {
+	_, store := newTestFeedStore(t)
+
+	insertTestCachedItems(t, store,
+		rf.CachedItem{GUID: "a", Summary: "a"},
+		rf.CachedItem{GUID: "b", Summary: "b"},
+		rf.CachedItem{GUID: "c", Summary: "<p>" + rf.ErrorPrefixSummaryFailedWithError + " [model1]: error</p>"},
+	)
+
+	for _, saved := range []summaryModel{
+		{GUID: "a", Model: "model2", Failed: true},
+		{GUID: "a", Model: "model1"}, // (replaced when summarized again)
+		{GUID: "b", Model: "model2"},
+		{GUID: "c", Model: "model1", Failed: true},
+	} {
+		if err := store.saveSummaryModel(saved.GUID, saved.Model, saved.Failed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if model, exists := store.summaryModelOf("c"); !exists || model.Model != "model1" || !model.Failed {
+		t.Errorf("unexpected model of 'c': %+v, %v", model, exists)
+	}
+	if _, exists := store.summaryModelOf("d"); exists {
+		t.Error("expected no model of 'd'")
+	}
+
+	counts, err := store.summaryModelCounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 2 || counts["model1"] != 1 || counts["model2"] != 1 {
+		t.Errorf("unexpected counts: %v", counts)
+	}
+}
+
+func TestUsageAccountant_TryModelFallbacks(t *testing.T) {
+	conf := config{
+		GoogleAIModels:        []string{"model1", "model2"},
+		ModelFailureThreshold: 2,
+		ModelCooldownSeconds:  60,
+	}
+	usage := newUsageAccountant(conf, []string{"key1", "key2"})
+	ctx := withUsageFeed(context.Background(), "test")
+
+	var attempts []string
+	errs := map[string]error{} // model => error
+	generate := func(combo geminiCombo) (usageCounts, error) {
+		attempts = append(attempts, combo.apiKey+"/"+combo.model)
+		return usageCounts{}, errs[combo.model]
+	}
+
+	// fallback models are not tried while the first one succeeds
+	if model, err := usage.try(ctx, generate); err != nil || model != "model1" || len(attempts) != 1 {
+		t.Errorf("unexpected result: %s, %v, %v", model, err, attempts)
+	}
+
+	// quota errors are retried with the next api key, then with the next model
+	attempts = nil
+	errs["model1"] = genai.APIError{Code: http.StatusTooManyRequests, Message: "You exceeded your current quota.", Status: "RESOURCE_EXHAUSTED"}
+	if model, err := usage.try(ctx, generate); err != nil || model != "model2" || !slices.Equal(attempts, []string{"key1/model1", "key2/model1", "key1/model2"}) {
+		t.Errorf("unexpected result: %s, %v, %v", model, err, attempts)
+	}
+	usage.cooldownUntil = map[keyModel]time.Time{}
+
+	// failures of a model are tried with the next model (without trying the other api keys)
+	attempts = nil
+	errs["model1"] = genai.APIError{Code: http.StatusInternalServerError, Message: "internal error"}
+	if model, err := usage.try(ctx, generate); err != nil || model != "model2" || !slices.Equal(attempts, []string{"key1/model1", "key1/model2"}) {
+		t.Errorf("unexpected result: %s, %v, %v", model, err, attempts)
+	}
+
+	// failures of an item are not retried
+	attempts = nil
+	errs["model1"] = fmt.Errorf("failed to fetch content")
+	if _, err := usage.try(ctx, generate); err == nil || len(attempts) != 1 {
+		t.Errorf("expected the error of the item, got %v, %v", err, attempts)
+	}
+
+	// the first one is skipped after repeated failures, so the next one is tried first
+	errs["model1"] = fmt.Errorf("generation was terminated due to: %s", genai.FinishReasonSafety)
+	_, _ = usage.try(ctx, generate)
+	_, _ = usage.try(ctx, generate)
+	attempts = nil
+	if model, err := usage.try(ctx, generate); err != nil || model != "model2" || !slices.Equal(attempts, []string{"key1/model2"}) {
+		t.Errorf("unexpected result: %s, %v, %v", model, err, attempts)
+	}
+
+	reports := usage.modelReports(time.Now())
+	if len(reports) != 2 || reports[0].Status != modelStatusSkipped || reports[0].Preferred || !reports[1].Preferred || reports[1].LastSuccessAt == nil {
+		t.Errorf("unexpected model reports: %+v", reports)
+	}
+	if ok, _ := usage.available("test", time.Now()); !ok {
+		t.Error("expected to be available with the fallback model")
+	}
+
+	// the last failure is returned when all models failed, and unavailable when all of them are skipped
+	errs["model2"] = genai.APIError{Code: http.StatusInternalServerError, Message: "internal error"}
+	if _, err := usage.try(ctx, generate); err == nil || errors.Is(err, errNoAvailableGeminiKey) {
+		t.Errorf("expected the failure of the model, got %v", err)
+	}
+	_, _ = usage.try(ctx, generate)
+	if ok, reason := usage.available("test", time.Now()); ok || reason == "" {
+		t.Error("expected to be unavailable while all models are skipped")
+	}
+	if _, err := usage.try(ctx, generate); !errors.Is(err, errNoAvailableGeminiKey) {
+		t.Errorf("expected no available model, got %v", err)
+	}
+}
+
+func TestSummarizeItems_ModelFallbacks(t *testing.T) {
+	_, store := newTestFeedStore(t)
+
+	conf := config{
+		GoogleAIModels:  []string{"model1", "model2"},
+		DesiredLanguage: new("Korean"),
+		RSSFeeds:        []configRSSFeed{{Name: "test"}},
+	}
+	usage := newUsageAccountant(conf, []string{"key1"})
+	prompt, err := newSummaryPrompt(configSummaryPrompt{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := newTestGeminiServer(t)
+	server.reply("model1", http.StatusOK, `{"candidates": [{"finishReason": "SAFETY"}]}`)
+	f := &feed{
+		conf:       conf.RSSFeeds[0],
+		store:      store,
+		usage:      usage,
+		prompt:     prompt,
+		summarizer: newTestGeminiSummarizer(usage, server),
+	}
+
+	// (blocked by the first model, so summarized with the next one in order)
+	items := []*gofeed.Item{{GUID: "1", Title: "Original", Description: "description of the item"}}
+	if deferred, err := summarizeItems(withUsageFeed(context.Background(), "test"), f, items, nil, conf); err != nil || len(deferred) > 0 {
+		t.Fatalf("unexpected result: %v, %v", deferred, err)
+	}
+	if requests := server.takeRequests(); !slices.Equal(requests, []string{"key1/model1", "key1/model2"}) {
+		t.Errorf("unexpected requests: %v", requests)
+	}
+
+	cached, err := store.cachedItemsOf([]string{"1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cached) != 1 || !strings.Contains(cached[0].Summary, "(summarized with **model2**") {
+		t.Errorf("unexpected cached items: %+v", cached)
+	}
+	if model, exists := store.summaryModelOf("1"); !exists || model.Model != "model2" || model.Failed {
+		t.Errorf("unexpected model of '1': %+v, %v", model, exists)
+	}
+	if reports := usage.modelReports(time.Now()); reports[0].ConsecutiveFailures != 1 || !strings.Contains(reports[0].LastError, "SAFETY") {
+		t.Errorf("unexpected model reports: %+v", reports)
+	}
+}
@@ -0,0 +1,336 @@
+// fetch.go
+
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const (
+	fetchUserAgent = `Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:147.0) Gecko/20100101 Firefox/147.0`
+
+	maxFeedBodyBytes = 10 * 1024 * 1024 // 10MB
+
+	sourceCircuitBreakerThreshold = 5              // consecutive failures for opening the circuit
+	sourceCircuitOpenDuration     = 1 * time.Hour  // (doubled on each failure while open)
+	maxSourceBackoff              = 24 * time.Hour // max duration of backoffs and open circuits
+)
+
+// statuses of sources
+const (
+	sourceStatusOK            = "ok"              // source is being fetched normally
+	sourceStatusBackingOff    = "backing_off"     // source is skipped until `NextFetchAt`
+	sourceStatusCircuitOpen   = "circuit_open"    // host of the source is skipped until `CircuitOpenUntil`
+	sourceStatusNotYetFetched = "not_yet_fetched" // source was not fetched yet
+)
+
+// sourceState struct (fetch state of a source url of a feed)
+type sourceState struct {
+	URL                 string `gorm:"primaryKey"`
+	Host                string `gorm:"index"`
+	ConsecutiveFailures int
+	LastError           string
+	LastSuccessAt       *time.Time
+	LastFailureAt       *time.Time
+	NextFetchAt         time.Time
+	CircuitOpenUntil    *time.Time
+
+	// validators for conditional requests
+	ETag         string
+	LastModified string
+
+	// adaptive polling interval
+	PollIntervalSeconds int
+
+	UpdatedAt time.Time
+}
+
+// sourceValidators struct (validators of a fetched source url, saved after its items are processed)
+type sourceValidators struct {
+	source       string
+	etag         string
+	lastModified string
+}
+
+// fetchedSource struct (result of fetching a source url)
+type fetchedSource struct {
+	feed         *gofeed.Feed // nil if not modified
+	notModified  bool
+	etag         string
+	lastModified string
+	maxAge       time.Duration // `max-age` of `Cache-Control`
+}
+
+// get the host of given source url
+func sourceHost(source string) string {
+	if u, err := url.Parse(source); err == nil {
+		return u.Host
+	}
+	return source
+}
+
+// fetch states of all sources of the feed store
+func (s *feedStore) sourceStates() (states map[string]sourceState, err error) {
+	var rows []sourceState
+	if err = s.db.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch source states: %w", err)
+	}
+	states = map[string]sourceState{}
+	for _, row := range rows {
+		states[row.URL] = row
+	}
+	return states, nil
+}
+
+// fetch the state of given source url (or a new one if it does not exist)
+func (s *feedStore) sourceState(source string) (state sourceState, err error) {
+	err = s.db.Where(sourceState{URL: source}).Attrs(sourceState{Host: sourceHost(source)}).FirstOrInit(&state).Error
+	return state, err
+}
+
+// record a successful fetch from given source url, and schedule its next poll after `pollInterval`
+//
+// (validators of the fetch are not saved here, but with `saveSourceValidators` after its items are processed)
+func (s *feedStore) recordSourceSuccess(source string, pollInterval time.Duration, now time.Time) error {
+	state, err := s.sourceState(source)
+	if err != nil {
+		return err
+	}
+	state.PollIntervalSeconds = int(pollInterval / time.Second)
+	state.ConsecutiveFailures = 0
+	state.LastError = ""
+	state.LastSuccessAt = &now
+	state.NextFetchAt = now.Add(pollInterval)
+	state.CircuitOpenUntil = nil
+	return s.db.Save(&state).Error
+}
+
+// save given validators of fetched sources, for conditional requests of their next fetches
+//
+// NOTE: should be saved only after the fetched items are summarized and cached (or deferred),
+// or they would not be fetched again (with 304 Not Modified) when lost in between.
+func (s *feedStore) saveSourceValidators(validators []sourceValidators) error {
+	var errs []error
+	for _, v := range validators {
+		if err := s.db.Model(&sourceState{}).Where("url = ?", v.source).Select("ETag", "LastModified").Updates(sourceState{
+			ETag:         v.etag,
+			LastModified: v.lastModified,
+		}).Error; err != nil {
+			errs = append(errs, fmt.Errorf("failed to save validators of source '%s': %w", v.source, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// record a failed fetch from given source url
+//
+// the source is backed off exponentially from `interval`,
+// and its host's circuit is opened after `sourceCircuitBreakerThreshold` consecutive failures.
+func (s *feedStore) recordSourceFailure(source string, fetchErr error, interval time.Duration, now time.Time) error {
+	state, err := s.sourceState(source)
+	if err != nil {
+		return err
+	}
+	state.ConsecutiveFailures++
+	state.LastError = fetchErr.Error()
+	state.LastFailureAt = &now
+	state.NextFetchAt = now.Add(exponentialBackoff(interval, state.ConsecutiveFailures, maxSourceBackoff))
+	if state.ConsecutiveFailures >= sourceCircuitBreakerThreshold {
+		openUntil := now.Add(exponentialBackoff(sourceCircuitOpenDuration, state.ConsecutiveFailures-sourceCircuitBreakerThreshold+1, maxSourceBackoff))
+		state.CircuitOpenUntil = &openUntil
+	}
+	return s.db.Save(&state).Error
+}
+
+// delete states of sources which are not in given `sources`
+func (s *feedStore) pruneSourceStates(sources []string) error {
+	if len(sources) == 0 {
+		return s.db.Where("1 = 1").Delete(&sourceState{}).Error
+	}
+	return s.db.Where("url NOT IN ?", sources).Delete(&sourceState{}).Error
+}
+
+// get the status of given source url at `now`
+func sourceStatus(source string, states map[string]sourceState, now time.Time) string {
+	host := sourceHost(source)
+	for _, state := range states {
+		if state.Host == host && state.CircuitOpenUntil != nil && state.CircuitOpenUntil.After(now) {
+			return sourceStatusCircuitOpen
+		}
+	}
+	if state, exists := states[source]; exists {
+		if state.ConsecutiveFailures > 0 && state.NextFetchAt.After(now) {
+			return sourceStatusBackingOff
+		}
+		return sourceStatusOK
+	}
+	return sourceStatusNotYetFetched
+}
+
+// exponential backoff duration after given number of `attempts`
+func exponentialBackoff(interval time.Duration, attempts int, maxBackoff time.Duration) time.Duration {
+	backoff := interval
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return min(backoff, maxBackoff)
+}
+
+// fetch feeds from the due sources of given feed
+//
+// each source is fetched independently, so a failing source does not block the others.
+// sources which are not due for polling, backing off, or whose hosts' circuits are open, are skipped.
+// (scheduled feeds poll all of their sources on each scheduled time)
+// validators of the modified sources are returned as `validators`, and should be saved after their items are processed.
+func fetchFeeds(ctx context.Context, f *feed, conf config) (fetched []gofeed.Feed, validators []sourceValidators) {
+	states, err := f.store.sourceStates()
+	if err != nil {
+		log.Printf("# failed to fetch source states: %s", err)
+		states = map[string]sourceState{}
+	}
+
+	interval := time.Duration(conf.FetchFeedsIntervalSeconds) * time.Second
+	minInterval := time.Duration(conf.FetchFeedsMinIntervalSeconds) * time.Second
+	maxInterval := time.Duration(conf.FetchFeedsMaxIntervalSeconds) * time.Second
+	timeout := time.Duration(conf.FetchFeedsTimeoutSeconds) * time.Second
+
+	for _, source := range f.conf.FeedURLs {
+		now := time.Now()
+		state := states[source]
+		status := sourceStatus(source, states, now)
+		if status == sourceStatusCircuitOpen || status == sourceStatusBackingOff ||
+			(f.schedule == nil && state.NextFetchAt.After(now)) {
+			if conf.Verbose {
+				log.Printf(">>> skipping source '%s' (%s)", source, status)
+			}
+			continue
+		}
+
+		result, err := fetchSource(ctx, f.polite, source, state.ETag, state.LastModified, timeout)
+		if err == nil {
+			previous := interval
+			if state.PollIntervalSeconds > 0 {
+				previous = time.Duration(state.PollIntervalSeconds) * time.Second
+			}
+			pollInterval := nextPollInterval(result, previous, minInterval, maxInterval, time.Now())
+			if conf.Verbose {
+				log.Printf(">>> polling source '%s' every %s", source, pollInterval)
+			}
+
+			if err := f.store.recordSourceSuccess(source, pollInterval, time.Now()); err != nil {
+				log.Printf("# failed to record success of source '%s': %s", source, err)
+			}
+
+			if result.notModified {
+				if conf.Verbose {
+					log.Printf(">>> source '%s' was not modified", source)
+				}
+				continue
+			}
+
+			result.feed.Items = filterFetchedItems(f.store, result.feed.Items, ignoreItemsPublishedBeforeDays, time.Now(), conf.Verbose)
+			fetched = append(fetched, *result.feed)
+			validators = append(validators, sourceValidators{
+				source:       source,
+				etag:         result.etag,
+				lastModified: result.lastModified,
+			})
+		} else {
+			log.Printf("# failed to fetch feeds from '%s': %s", source, err)
+
+			if err := f.store.recordSourceFailure(source, err, interval, time.Now()); err != nil {
+				log.Printf("# failed to record failure of source '%s': %s", source, err)
+			}
+			if states, err = f.store.sourceStates(); err != nil { // (for circuits opened by this failure)
+				states = map[string]sourceState{}
+			}
+		}
+	}
+
+	return fetched, validators
+}
+
+// fetch and parse a feed from given source url
+//
+// requests are spaced and limited per host with `polite`, and `etag` and `lastModified` are
+// the validators of the last fetch, and sent for a conditional request.
+func fetchSource(ctx context.Context, polite *politeness, source, etag, lastModified string, timeout time.Duration) (result fetchedSource, err error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(ctx, http.MethodGet, source, nil); err != nil {
+		return result, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", polite.userAgentOr(fetchUserAgent))
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	var resp *http.Response
+	if resp, err = polite.httpClient().Do(req); err != nil {
+		return result, fmt.Errorf("failed to fetch feeds: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	result.maxAge = maxAgeOf(resp.Header.Get("Cache-Control"))
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		// keep the validators of the last fetch if they are not sent again
+		result.notModified = true
+		result.etag = cmp.Or(resp.Header.Get("ETag"), etag)
+		result.lastModified = cmp.Or(resp.Header.Get("Last-Modified"), lastModified)
+		return result, nil
+	case http.StatusOK:
+		parser := gofeed.NewParser()
+		parser.KeepOriginalFeed = true // for `<ttl>`
+		if result.feed, err = parser.Parse(io.LimitReader(resp.Body, maxFeedBodyBytes)); err != nil {
+			return result, fmt.Errorf("failed to parse feeds: %w", err)
+		}
+		result.etag = resp.Header.Get("ETag")
+		result.lastModified = resp.Header.Get("Last-Modified")
+		return result, nil
+	default:
+		return result, fmt.Errorf("http error %d", resp.StatusCode)
+	}
+}
+
+// filter out fetched items which are already cached, or published before `ignoreBeforeDays` days
+func filterFetchedItems(store *feedStore, items []*gofeed.Item, ignoreBeforeDays uint, now time.Time, verbose bool) []*gofeed.Item {
+	cutoff := now.Add(-time.Duration(ignoreBeforeDays) * 24 * time.Hour)
+
+	return slices.DeleteFunc(items, func(item *gofeed.Item) bool {
+		if cached, err := store.isCached(item.GUID); err != nil {
+			log.Printf("# failed to check cached item '%s': %s", item.GUID, err)
+		} else if cached {
+			return true
+		}
+
+		if item.PublishedParsed != nil && item.PublishedParsed.Before(cutoff) {
+			if verbose {
+				log.Printf(">>> ignoring item older than %d days: '%s' (%s)", ignoreBeforeDays, item.Title, item.GUID)
+			}
+			return true
+		}
+
+		return false
+	})
+}
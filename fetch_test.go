@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	rf "github.com/meinside/rss-feeds-go"
+)
+
+// RSS xml for testing
+const testRSSXML = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+<channel>
+<title>test</title>
+<item><title>cached</title><link>https://example.com/cached</link><guid>cached</guid></item>
+<item><title>new</title><link>https://example.com/new</link><guid>new</guid></item>
+</channel>
+</rss>`
+
+func TestExponentialBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: time.Minute},
+		{attempts: 2, want: 2 * time.Minute},
+		{attempts: 3, want: 4 * time.Minute},
+		{attempts: 100, want: 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := exponentialBackoff(time.Minute, tt.attempts, 10*time.Minute); got != tt.want {
+			t.Errorf("exponentialBackoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestRecordSourceFailureAndSuccess(t *testing.T) {
+	_, store := newTestFeedStore(t)
+
+	const source = "https://example.com/feed.xml"
+	now := time.Now()
+	interval := time.Minute
+
+	for i := range sourceCircuitBreakerThreshold - 1 {
+		if err := store.recordSourceFailure(source, errors.New("http error 500"), interval, now); err != nil {
+			t.Fatal(err)
+		}
+
+		states, _ := store.sourceStates()
+		if got := sourceStatus(source, states, now); got != sourceStatusBackingOff {
+			t.Errorf("after %d failure(s): expected status %s, got %s", i+1, sourceStatusBackingOff, got)
+		}
+		if got := states[source].NextFetchAt.Sub(now); got != exponentialBackoff(interval, i+1, maxSourceBackoff) {
+			t.Errorf("after %d failure(s): unexpected backoff %s", i+1, got)
+		}
+	}
+
+	// backoff is over
+	states, _ := store.sourceStates()
+	if got := sourceStatus(source, states, now.Add(time.Hour)); got != sourceStatusOK {
+		t.Errorf("expected status %s after backoff, got %s", sourceStatusOK, got)
+	}
+
+	// circuit is opened, also for other sources of the same host
+	if err := store.recordSourceFailure(source, errors.New("http error 500"), interval, now); err != nil {
+		t.Fatal(err)
+	}
+	states, _ = store.sourceStates()
+	for _, s := range []string{source, "https://example.com/other.xml"} {
+		if got := sourceStatus(s, states, now.Add(sourceCircuitOpenDuration-time.Second)); got != sourceStatusCircuitOpen {
+			t.Errorf("expected status %s for %s, got %s", sourceStatusCircuitOpen, s, got)
+		}
+	}
+	if got := sourceStatus("https://example.org/feed.xml", states, now); got != sourceStatusNotYetFetched {
+		t.Errorf("expected status %s for other host, got %s", sourceStatusNotYetFetched, got)
+	}
+	if states[source].LastError != "http error 500" {
+		t.Errorf("unexpected last error: %s", states[source].LastError)
+	}
+
+	// success resets the state
+	if err := store.recordSourceSuccess(source, 0, now); err != nil {
+		t.Fatal(err)
+	}
+	states, _ = store.sourceStates()
+	if got := sourceStatus(source, states, now); got != sourceStatusOK {
+		t.Errorf("expected status %s after success, got %s", sourceStatusOK, got)
+	}
+	if states[source].ConsecutiveFailures != 0 || states[source].LastError != "" {
+		t.Errorf("expected failures to be reset, got %+v", states[source])
+	}
+}
+
+func TestPruneSourceStates(t *testing.T) {
+	_, store := newTestFeedStore(t)
+
+	now := time.Now()
+	for _, source := range []string{"https://a.com/feed", "https://b.com/feed"} {
+		if err := store.recordSourceSuccess(source, 0, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.pruneSourceStates([]string{"https://a.com/feed"}); err != nil {
+		t.Fatal(err)
+	}
+
+	states, _ := store.sourceStates()
+	if _, exists := states["https://b.com/feed"]; exists || len(states) != 1 {
+		t.Errorf("expected only the configured source to remain, got %v", states)
+	}
+}
+
+func TestFetchFeeds(t *testing.T) {
+	client, store := newTestFeedStore(t)
+	insertTestCachedItems(t, store, rf.CachedItem{GUID: "cached"})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, testRSSXML)
+	})
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	f := &feed{
+		conf: configRSSFeed{
+			Name:     "test",
+			FeedURLs: []string{server.URL + "/broken", server.URL + "/ok"},
+		},
+		client: client,
+		store:  store,
+	}
+	conf := config{
+		FetchFeedsIntervalSeconds: 60,
+		FetchFeedsTimeoutSeconds:  10,
+	}
+
+	// a broken source does not block the others
+	fetched, _ := fetchFeeds(context.Background(), f, conf)
+	if len(fetched) != 1 || len(fetched[0].Items) != 1 || fetched[0].Items[0].GUID != "new" {
+		t.Fatalf("expected only the new item of the working source, got %+v", fetched)
+	}
+
+	states, _ := store.sourceStates()
+	if states[server.URL+"/broken"].ConsecutiveFailures != 1 {
+		t.Errorf("expected failure of the broken source to be recorded, got %+v", states[server.URL+"/broken"])
+	}
+	if states[server.URL+"/ok"].LastSuccessAt == nil {
+		t.Errorf("expected success of the working source to be recorded, got %+v", states[server.URL+"/ok"])
+	}
+
+	// the broken source is backing off, so it is not fetched again
+	fetchFeeds(context.Background(), f, conf)
+	states, _ = store.sourceStates()
+	if states[server.URL+"/broken"].ConsecutiveFailures != 1 {
+		t.Errorf("expected the broken source to be skipped, got %+v", states[server.URL+"/broken"])
+	}
+}
+
+func TestFilterFetchedItems(t *testing.T) {
+	_, store := newTestFeedStore(t)
+	insertTestCachedItems(t, store, rf.CachedItem{GUID: "cached"})
+
+	now := time.Now()
+	old := now.AddDate(0, 0, -31)
+	recent := now.AddDate(0, 0, -1)
+
+	items := []*gofeed.Item{
+		{GUID: "cached", PublishedParsed: &recent},
+		{GUID: "old", PublishedParsed: &old},
+		{GUID: "recent", PublishedParsed: &recent},
+		{GUID: "undated"},
+	}
+
+	filtered := filterFetchedItems(store, items, 30, now, false)
+	if len(filtered) != 2 || filtered[0].GUID != "recent" || filtered[1].GUID != "undated" {
+		t.Errorf("unexpected filtered items: %+v", filtered)
+	}
+}
+
+func TestFetchFeedsConditionally(t *testing.T) {
+	client, store := newTestFeedStore(t)
+
+	const etag = `"v1"`
+	numFetched := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		numFetched++
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2026 15:04:05 GMT")
+		_, _ = fmt.Fprint(w, testRSSXML)
+	}))
+	defer server.Close()
+
+	f := &feed{
+		conf:   configRSSFeed{Name: "test", FeedURLs: []string{server.URL}},
+		client: client,
+		store:  store,
+	}
+	conf := config{
+		FetchFeedsIntervalSeconds: 60,
+		FetchFeedsTimeoutSeconds:  10,
+	}
+
+	fetched, validators := fetchFeeds(context.Background(), f, conf)
+	if len(fetched) != 1 || len(validators) != 1 {
+		t.Fatalf("expected a fetched feed with its validators, got %d, %+v", len(fetched), validators)
+	}
+	states, _ := store.sourceStates()
+	if states[server.URL].ETag != "" {
+		t.Errorf("expected validators not to be saved before the items are processed, got %+v", states[server.URL])
+	}
+
+	// (fetched again, as if the fetched items were lost)
+	if fetched, validators = fetchFeeds(context.Background(), f, conf); len(fetched) != 1 {
+		t.Fatalf("expected a fetched feed, got %d", len(fetched))
+	}
+	if err := store.saveSourceValidators(validators); err != nil {
+		t.Fatal(err)
+	}
+	states, _ = store.sourceStates()
+	if states[server.URL].ETag != etag || states[server.URL].LastModified == "" {
+		t.Errorf("expected validators to be saved, got %+v", states[server.URL])
+	}
+
+	// not modified
+	if fetched, validators := fetchFeeds(context.Background(), f, conf); len(fetched) != 0 || len(validators) != 0 {
+		t.Errorf("expected no fetched feeds when not modified, got %d", len(fetched))
+	}
+	if numFetched != 2 {
+		t.Errorf("expected the feed to be downloaded only twice, got %d", numFetched)
+	}
+	states, _ = store.sourceStates()
+	if states[server.URL].ETag != etag || states[server.URL].LastSuccessAt == nil {
+		t.Errorf("expected validators to be kept, got %+v", states[server.URL])
+	}
+}
+
+func TestFetchFeedsNotDue(t *testing.T) {
+	client, store := newTestFeedStore(t)
+
+	numFetched := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		numFetched++
+		_, _ = fmt.Fprint(w, testRSSXML)
+	}))
+	defer server.Close()
+
+	f := &feed{
+		conf:   configRSSFeed{Name: "test", FeedURLs: []string{server.URL}},
+		client: client,
+		store:  store,
+	}
+	conf := config{
+		FetchFeedsIntervalSeconds:    600,
+		FetchFeedsMinIntervalSeconds: 300,
+		FetchFeedsMaxIntervalSeconds: 3600,
+		FetchFeedsTimeoutSeconds:     10,
+	}
+
+	fetchFeeds(context.Background(), f, conf)
+	fetchFeeds(context.Background(), f, conf)
+	if numFetched != 1 {
+		t.Errorf("expected the source to be polled only once before it is due, got %d", numFetched)
+	}
+
+	states, _ := store.sourceStates()
+	state := states[server.URL]
+	if state.PollIntervalSeconds < conf.FetchFeedsMinIntervalSeconds || state.PollIntervalSeconds > conf.FetchFeedsMaxIntervalSeconds {
+		t.Errorf("expected poll interval within bounds, got %d", state.PollIntervalSeconds)
+	}
+	if got := sourceStatus(server.URL, states, time.Now()); got != sourceStatusOK {
+		t.Errorf("expected status %s while waiting for the next poll, got %s", sourceStatusOK, got)
+	}
+}
@@ -0,0 +1,296 @@
+// gemini.go
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/genai"
+
+	gt "github.com/meinside/gemini-things-go"
+)
+
+const (
+	geminiGenerationTimeout = 3 * time.Minute
+	geminiDefaultCooldown   = 60 * time.Second
+
+	geminiFnName             = "translateTitleAndSummarizeContent"
+	geminiFnParamTitle       = "translatedTitle"
+	geminiFnParamSummary     = "summarizedContent"
+	geminiFnDescription      = `Summarize the given content and translate the title referring to the summarized content.`
+	geminiFnParamTitleDesc   = `Translated title of the content.`
+	geminiFnParamSummaryDesc = `Summarized content.`
+	geminiFnParamTags        = "tags"
+)
+
+var errNoAvailableGeminiKey = errors.New("no available api key/model (all in cooldown)")
+
+// geminiCombo struct (a pair of api key and model)
+type geminiCombo struct {
+	apiKey string
+	model  string
+}
+
+// geminiSummarizer struct
+//
+// generates summaries with app-side prompts, trying (api key, model) pairs of the usage accountant
+// with its own http client.
+type geminiSummarizer struct {
+	usage   *usageAccountant
+	baseURL string // (empty for the default one)
+
+	client *http.Client
+}
+
+// create a new gemini summarizer with the api keys and models of given usage accountant
+func newGeminiSummarizer(usage *usageAccountant) *geminiSummarizer {
+	return &geminiSummarizer{
+		usage:  usage,
+		client: &http.Client{Timeout: geminiGenerationTimeout},
+	}
+}
+
+// get the cooldown duration from the `RetryInfo` of given quota error
+func geminiCooldownOf(err error) time.Duration {
+	for _, detail := range gt.ErrDetails(err) {
+		if t, _ := detail["@type"].(string); strings.Contains(t, "RetryInfo") {
+			if delay, ok := detail["retryDelay"].(string); ok {
+				if parsed, err := time.ParseDuration(delay); err == nil && parsed > 0 {
+					return parsed
+				}
+			}
+			break
+		}
+	}
+	return geminiDefaultCooldown
+}
+
+// generate a translated title, a summary, and tags (if requested) with the prompt of given request
+//
+// retried with the next (api key, model) pair on quota errors.
+func (g *geminiSummarizer) generate(ctx context.Context, req summaryRequest) (model, title, summary string, tags []string, err error) {
+	if model, err = g.usage.try(ctx, func(combo geminiCombo) (counts usageCounts, err error) {
+		var result *genai.GenerateContentResponse
+		if result, counts, err = g.generateContent(ctx, combo, req.prompt, req.document, geminiGenerationOptions(req.tagging)); err != nil {
+			return counts, err
+		}
+		title, summary, tags, err = titleAndSummaryOf(result, combo.model, req.tagging)
+		return counts, err
+	}); err != nil {
+		return model, "", "", nil, err
+	}
+	return model, title, summary, tags, nil
+}
+
+// translate given title into `language`
+//
+// retried with the next (api key, model) pair on quota errors.
+func (g *geminiSummarizer) translateTitle(ctx context.Context, title, language string) (translated string, err error) {
+	var model string
+	if model, err = g.usage.try(ctx, func(combo geminiCombo) (counts usageCounts, err error) {
+		var result *genai.GenerateContentResponse
+		if result, counts, err = g.generateContent(ctx, combo, fmt.Sprintf(titleTranslationPromptFormat, language, title), nil, &genai.GenerateContentConfig{}); err != nil {
+			return counts, err
+		}
+		translated, err = textOf(result)
+		return counts, err
+	}); err != nil {
+		return "", err
+	}
+	if translated = cleanTranslatedTitle(translated); translated == "" {
+		return "", fmt.Errorf("translated title was empty [%s]", model)
+	}
+	return translated, nil
+}
+
+// generate tags of given (summarized) `title` and `summary` with `tagging`
+//
+// (for items summarized with rss-feeds-go, which does not generate tags)
+func (g *geminiSummarizer) generateTags(ctx context.Context, title, summary string, tagging *tagging) (tags []string, err error) {
+	if _, err = g.usage.try(ctx, func(combo geminiCombo) (counts usageCounts, err error) {
+		var result *genai.GenerateContentResponse
+		if result, counts, err = g.generateContent(ctx, combo, fmt.Sprintf(tagsPromptFormat, tagging.instruction(), title, summary), nil, &genai.GenerateContentConfig{
+			ResponseMIMEType: "application/json",
+			ResponseSchema: &genai.Schema{
+				Type:  genai.TypeArray,
+				Items: &genai.Schema{Type: genai.TypeString, Enum: tagging.allowed}, // (any tags if not allowed ones)
+			},
+		}); err != nil {
+			return counts, err
+		}
+		var text string
+		if text, err = textOf(result); err == nil {
+			tags = nil
+			if err = json.Unmarshal([]byte(text), &tags); err != nil {
+				err = fmt.Errorf("failed to parse tags: %w", err)
+			}
+		}
+		return counts, err
+	}); err != nil {
+		return nil, err
+	}
+	return tagging.normalize(tags), nil
+}
+
+// interval between summaries of items
+func (g *geminiSummarizer) interval() time.Duration {
+	return summaryIntervalDuration
+}
+
+// generate a response to given `prompt` (and pdf `document`, if any) with given (api key, model) pair and `options`, and count its tokens
+func (g *geminiSummarizer) generateContent(ctx context.Context, combo geminiCombo, prompt string, document []byte, options *genai.GenerateContentConfig) (result *genai.GenerateContentResponse, counts usageCounts, err error) {
+	var client *genai.Client
+	if client, err = genai.NewClient(ctx, &genai.ClientConfig{
+		APIKey:      combo.apiKey,
+		Backend:     genai.BackendGeminiAPI,
+		HTTPClient:  g.client,
+		HTTPOptions: genai.HTTPOptions{BaseURL: g.baseURL},
+	}); err != nil {
+		return nil, counts, fmt.Errorf("failed to initialize gemini client: %w", err)
+	}
+	options.SystemInstruction = genai.NewContentFromText(summarySystemInstruction(), genai.RoleUser)
+
+	parts := []*genai.Part{genai.NewPartFromText(prompt)}
+	if document != nil {
+		parts = append(parts, genai.NewPartFromBytes(document, "application/pdf"))
+	}
+
+	ctxGenerate, cancelGenerate := context.WithTimeout(ctx, geminiGenerationTimeout)
+	defer cancelGenerate()
+	if result, err = client.Models.GenerateContent(ctxGenerate, combo.model, []*genai.Content{genai.NewContentFromParts(parts, genai.RoleUser)}, options); err != nil {
+		return nil, counts, err
+	}
+
+	if result.UsageMetadata != nil {
+		counts.InputTokens = int64(result.UsageMetadata.PromptTokenCount)
+		counts.OutputTokens = int64(result.UsageMetadata.CandidatesTokenCount) + int64(result.UsageMetadata.ThoughtsTokenCount)
+	}
+	if result.PromptFeedback != nil && result.PromptFeedback.BlockReason != "" {
+		return nil, counts, fmt.Errorf("prompt was blocked due to: %s", result.PromptFeedback.BlockReason)
+	}
+	return result, counts, nil
+}
+
+// get a translated title, a summary, and tags (if `tagging` is not nil) from given response of `model`
+func titleAndSummaryOf(result *genai.GenerateContentResponse, model string, tagging *tagging) (title, summary string, tags []string, err error) {
+	var sb strings.Builder
+	for _, candidate := range result.Candidates {
+		if candidate.Content == nil {
+			if candidate.FinishReason != genai.FinishReasonUnspecified {
+				return "", "", nil, fmt.Errorf("generation was terminated due to: %s", candidate.FinishReason)
+			}
+			continue
+		}
+		for _, part := range candidate.Content.Parts {
+			if part.FunctionCall != nil && part.FunctionCall.Name == geminiFnName {
+				if arg, err := gt.FuncArg[string](part.FunctionCall.Args, geminiFnParamTitle); err == nil && arg != nil {
+					title = *arg
+				}
+				if arg, err := gt.FuncArg[string](part.FunctionCall.Args, geminiFnParamSummary); err == nil && arg != nil {
+					sb.WriteString(*arg)
+				}
+				if tagging != nil {
+					tags = append(tags, tagsOfFuncArgs(part.FunctionCall.Args)...)
+				}
+			} else if part.Text != "" && !part.Thought { // (sometimes returned as a text)
+				sb.WriteString(part.Text)
+			}
+		}
+	}
+	if sb.Len() == 0 {
+		return "", "", nil, fmt.Errorf("summarized content was empty [%s]", model)
+	}
+
+	if tagging != nil {
+		tags = tagging.normalize(tags)
+	}
+
+	return title, sb.String(), tags, nil
+}
+
+// get tags from given arguments of a function call
+func tagsOfFuncArgs(args map[string]any) (tags []string) {
+	if values, ok := args[geminiFnParamTags].([]any); ok {
+		for _, value := range values {
+			if tag, ok := value.(string); ok {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// get the text of given response
+func textOf(result *genai.GenerateContentResponse) (text string, err error) {
+	var sb strings.Builder
+	for _, candidate := range result.Candidates {
+		if candidate.Content == nil {
+			if candidate.FinishReason != genai.FinishReasonUnspecified {
+				return "", fmt.Errorf("generation was terminated due to: %s", candidate.FinishReason)
+			}
+			continue
+		}
+		for _, part := range candidate.Content.Parts {
+			if !part.Thought {
+				sb.WriteString(part.Text)
+			}
+		}
+	}
+	return sb.String(), nil
+}
+
+// options for generating a translated title and a summary (and tags, if `tagging` is not nil) with a function call
+func geminiGenerationOptions(tagging *tagging) *genai.GenerateContentConfig {
+	options := &genai.GenerateContentConfig{
+		Tools: []*genai.Tool{
+			{
+				FunctionDeclarations: []*genai.FunctionDeclaration{
+					{
+						Name:        geminiFnName,
+						Description: geminiFnDescription,
+						Parameters: &genai.Schema{
+							Type: genai.TypeObject,
+							Properties: map[string]*genai.Schema{
+								geminiFnParamTitle: {
+									Description: geminiFnParamTitleDesc,
+									Type:        genai.TypeString,
+									Nullable:    new(false),
+								},
+								geminiFnParamSummary: {
+									Description: geminiFnParamSummaryDesc,
+									Type:        genai.TypeString,
+									Nullable:    new(false),
+								},
+							},
+							Required: []string{geminiFnParamTitle, geminiFnParamSummary},
+						},
+					},
+				},
+			},
+		},
+		ToolConfig: &genai.ToolConfig{
+			FunctionCallingConfig: &genai.FunctionCallingConfig{
+				Mode:                 genai.FunctionCallingConfigModeAny,
+				AllowedFunctionNames: []string{geminiFnName},
+			},
+		},
+	}
+
+	if tagging != nil {
+		params := options.Tools[0].FunctionDeclarations[0].Parameters
+		params.Properties[geminiFnParamTags] = &genai.Schema{
+			Description: tagging.instruction(),
+			Type:        genai.TypeArray,
+			Items:       &genai.Schema{Type: genai.TypeString, Enum: tagging.allowed}, // (any tags if not allowed ones)
+		}
+		params.Required = append(params.Required, geminiFnParamTags)
+	}
+
+	return options
+}
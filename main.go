@@ -3,6 +3,8 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"log"
 	"os"
 )
@@ -13,14 +15,32 @@ func printHelp(cmd string) {
 
   * fetch, summarize, cache, and serve RSS feed items
     %[1]s [CONFIG_FILEPATH]
-`, cmd)
+
+  * re-summarize cached items of a feed (see '%[1]s %[2]s -h' for options)
+    %[1]s %[2]s [CONFIG_FILEPATH] [FEED_NAME] [OPTIONS]
+
+  * report usages (and costs) of Google Gemini API (see '%[1]s %[3]s -h' for options)
+    %[1]s %[3]s [CONFIG_FILEPATH] [OPTIONS]
+`, cmd, resummarizeCommand, usageReportCommand)
 }
 
 func main() {
 	cmd := os.Args[0]
 	args := os.Args[1:]
 
-	if len(args) > 0 {
+	if len(args) > 0 && args[0] == resummarizeCommand {
+		if err := runResummarize(cmd, args[1:], os.Stdout); err == nil {
+			return
+		} else if !errors.Is(err, flag.ErrHelp) {
+			log.Printf("> failed to re-summarize: %s", err)
+		}
+	} else if len(args) > 0 && args[0] == usageReportCommand {
+		if err := runUsageReport(cmd, args[1:], os.Stdout); err == nil {
+			return
+		} else if !errors.Is(err, flag.ErrHelp) {
+			log.Printf("> failed to report usages: %s", err)
+		}
+	} else if len(args) > 0 {
 		configFilepath := args[0]
 		if conf, err := readConfig(configFilepath); err == nil {
 			run(conf)
@@ -0,0 +1,225 @@
+// openai.go
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	openAIGenerationTimeout = 3 * time.Minute
+	maxOpenAIResponseBytes  = 10 * 1024 * 1024 // = 10MB
+
+	openAIResponseInstruction     = `Reply with a JSON object only, with keys: "title" (the translated title) and "summary" (the summarized content in markdown).`
+	openAIResponseTagsInstruction = `Also include the key "tags" (an array of strings) in the JSON object.`
+)
+
+// openAISummarizer struct
+//
+// generates summaries with an OpenAI-compatible chat completions API
+// (eg. OpenAI, or local servers like llama.cpp and vLLM).
+type openAISummarizer struct {
+	baseURL string
+	model   string
+	apiKey  string // (not sent if empty)
+
+	usage  *usageAccountant // nil for no accounting of api usages
+	client *http.Client
+}
+
+// openAIMessage struct
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// openAIChatRequest struct
+type openAIChatRequest struct {
+	Model          string          `json:"model"`
+	Messages       []openAIMessage `json:"messages"`
+	ResponseFormat map[string]any  `json:"response_format,omitempty"`
+}
+
+// openAIChatResponse struct
+type openAIChatResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message      openAIMessage `json:"message"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int64 `json:"prompt_tokens"`
+		CompletionTokens int64 `json:"completion_tokens"`
+	} `json:"usage,omitempty"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// create a new summarizer with an OpenAI-compatible API at `baseURL` (eg. "http://localhost:8080/v1")
+//
+// (usages are counted with `usage`, if it is not nil)
+func newOpenAISummarizer(baseURL, model, apiKey string, usage *usageAccountant) *openAISummarizer {
+	return &openAISummarizer{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		model:   model,
+		apiKey:  apiKey,
+		usage:   usage,
+		client:  &http.Client{Timeout: openAIGenerationTimeout},
+	}
+}
+
+// generate a translated title, a summary, and tags (if requested) with the prompt of given request
+func (o *openAISummarizer) generate(ctx context.Context, req summaryRequest) (model, title, summary string, tags []string, err error) {
+	instruction := summarySystemInstruction() + "\n" + openAIResponseInstruction
+	if req.tagging != nil {
+		instruction += "\n" + openAIResponseTagsInstruction
+	}
+
+	var reply string
+	if model, reply, err = o.complete(ctx, instruction, req.prompt, true); err != nil {
+		return model, "", "", nil, err
+	}
+
+	title, summary, tags = parseTitleAndSummary(reply)
+	if summary == "" {
+		return model, "", "", nil, fmt.Errorf("summarized content was empty [%s]", model)
+	}
+	if req.tagging != nil {
+		tags = req.tagging.normalize(tags)
+	} else {
+		tags = nil
+	}
+	return model, title, summary, tags, nil
+}
+
+// translate given title into `language`
+func (o *openAISummarizer) translateTitle(ctx context.Context, title, language string) (translated string, err error) {
+	var model string
+	if model, translated, err = o.complete(ctx, summarySystemInstruction(), fmt.Sprintf(titleTranslationPromptFormat, language, title), false); err != nil {
+		return "", err
+	}
+	if translated = cleanTranslatedTitle(translated); translated == "" {
+		return "", fmt.Errorf("translated title was empty [%s]", model)
+	}
+	return translated, nil
+}
+
+// request a chat completion of given system `instruction` and user `prompt` (in a json object if `jsonObject` is true),
+// and return the content of its reply with the name of the used model
+//
+// the request, its tokens (if reported), and errors are counted for the feed of given context and the used model.
+func (o *openAISummarizer) complete(ctx context.Context, instruction, prompt string, jsonObject bool) (model, reply string, err error) {
+	model = o.model
+
+	var counts usageCounts
+	defer func() {
+		if counts.Requests > 0 {
+			if err != nil {
+				counts.Errors++
+			}
+			o.usage.record(ctx, o.keyID(), model, counts, time.Now())
+		}
+	}()
+
+	chatReq := openAIChatRequest{
+		Model: o.model,
+		Messages: []openAIMessage{
+			{Role: "system", Content: instruction},
+			{Role: "user", Content: prompt},
+		},
+	}
+	if jsonObject {
+		chatReq.ResponseFormat = map[string]any{"type": "json_object"}
+	}
+
+	var body []byte
+	if body, err = json.Marshal(chatReq); err != nil {
+		return model, "", err
+	}
+
+	var httpReq *http.Request
+	if httpReq, err = http.NewRequestWithContext(ctx, http.MethodPost, o.baseURL+"/chat/completions", bytes.NewReader(body)); err != nil {
+		return model, "", err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if o.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+
+	counts.Requests++
+
+	var resp *http.Response
+	if resp, err = o.client.Do(httpReq); err != nil {
+		return model, "", fmt.Errorf("failed to request chat completion: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var res openAIChatResponse
+	if body, err = io.ReadAll(io.LimitReader(resp.Body, maxOpenAIResponseBytes)); err != nil {
+		return model, "", fmt.Errorf("failed to read chat completion: %w", err)
+	}
+	if err = json.Unmarshal(body, &res); err != nil || resp.StatusCode != http.StatusOK {
+		if res.Error != nil {
+			return model, "", fmt.Errorf("chat completion failed with status %d: %s", resp.StatusCode, res.Error.Message)
+		} else if resp.StatusCode != http.StatusOK {
+			return model, "", fmt.Errorf("chat completion failed with status %d", resp.StatusCode)
+		}
+		return model, "", fmt.Errorf("failed to parse chat completion: %w", err)
+	}
+	if res.Model != "" {
+		model = res.Model
+	}
+	if res.Usage != nil {
+		counts.InputTokens, counts.OutputTokens = res.Usage.PromptTokens, res.Usage.CompletionTokens
+	}
+
+	if len(res.Choices) == 0 {
+		return model, "", fmt.Errorf("no choice in chat completion [%s]", model)
+	}
+	choice := res.Choices[0]
+	if choice.FinishReason != "" && choice.FinishReason != "stop" && choice.FinishReason != "length" {
+		return model, "", fmt.Errorf("generation was terminated due to: %s", choice.FinishReason)
+	}
+	return model, choice.Message.Content, nil
+}
+
+// get the id of the api key (empty if there is no api key, eg. local servers)
+func (o *openAISummarizer) keyID() string {
+	if o.apiKey == "" {
+		return ""
+	}
+	return apiKeyIDOf(o.apiKey)
+}
+
+// interval between summaries of items
+func (o *openAISummarizer) interval() time.Duration {
+	return summaryIntervalDuration
+}
+
+// parse a translated title, a summary, and tags from given (json) reply
+//
+// replies which are not json objects are treated as summaries without titles and tags.
+func parseTitleAndSummary(reply string) (title, summary string, tags []string) {
+	reply = strings.TrimSpace(reply)
+
+	trimmed := strings.TrimPrefix(strings.TrimPrefix(reply, "```json"), "```")
+	trimmed = strings.TrimSpace(strings.TrimSuffix(trimmed, "```"))
+
+	var parsed struct {
+		Title   string   `json:"title"`
+		Summary string   `json:"summary"`
+		Tags    []string `json:"tags"`
+	}
+	if err := json.Unmarshal([]byte(trimmed), &parsed); err == nil && parsed.Summary != "" {
+		return strings.TrimSpace(parsed.Title), strings.TrimSpace(parsed.Summary), parsed.Tags
+	}
+	return "", reply, nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// testOpenAIRequest struct (a request received by the stub server)
+type testOpenAIRequest struct {
+	header http.Header
+	body   openAIChatRequest
+}
+
+// create a stub server of OpenAI-compatible chat completions API which replies with given `reply`
+//
+// received requests are sent to `requests` if it is not nil.
+func newTestOpenAIServer(t *testing.T, status int, reply string, requests chan<- testOpenAIRequest) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		var req openAIChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Messages) != 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, `{"error": {"message": "bad request"}}`)
+			return
+		}
+		if requests != nil {
+			requests <- testOpenAIRequest{header: r.Header, body: req}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if status != http.StatusOK {
+			_, _ = fmt.Fprintf(w, `{"error": {"message": %q}}`, reply)
+			return
+		}
+		res := map[string]any{
+			"model": req.Model,
+			"choices": []map[string]any{
+				{"message": map[string]any{"role": "assistant", "content": reply}, "finish_reason": "stop"},
+			},
+			"usage": map[string]any{"prompt_tokens": 100, "completion_tokens": 20},
+		}
+		_ = json.NewEncoder(w).Encode(res)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestOpenAISummarizer_Generate(t *testing.T) {
+	requests := make(chan testOpenAIRequest, 1)
+	server := newTestOpenAIServer(t, http.StatusOK, `{"title": "번역된 제목", "summary": "요약된 내용"}`, requests)
+
+	usage := newUsageAccountant(config{}, nil)
+	ctx := withUsageFeed(context.Background(), "test")
+
+	o := newOpenAISummarizer(server.URL+"/v1/", "local-model", "secret", usage)
+	model, title, summary, _, err := o.generate(ctx, summaryRequest{prompt: "prompt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model != "local-model" || title != "번역된 제목" || summary != "요약된 내용" {
+		t.Errorf("unexpected generation: %s, %s, %s", model, title, summary)
+	}
+	if req := <-requests; req.header.Get("Authorization") != "Bearer secret" || req.body.Model != "local-model" || req.body.Messages[1].Content != "prompt" {
+		t.Errorf("unexpected request: %+v", req)
+	}
+
+	// without api key
+	o = newOpenAISummarizer(server.URL+"/v1", "local-model", "", nil)
+	if _, _, _, _, err := o.generate(context.Background(), summaryRequest{prompt: "prompt"}); err != nil {
+		t.Fatal(err)
+	}
+	if req := <-requests; req.header.Get("Authorization") != "" {
+		t.Errorf("expected no authorization header, got '%s'", req.header.Get("Authorization"))
+	}
+
+	// errors
+	failing := newTestOpenAIServer(t, http.StatusTooManyRequests, "rate limited", nil)
+	if _, _, _, _, err := newOpenAISummarizer(failing.URL+"/v1", "local-model", "secret", usage).generate(ctx, summaryRequest{prompt: "prompt"}); err == nil || !strings.Contains(err.Error(), "rate limited") {
+		t.Errorf("expected error with the message, got %v", err)
+	}
+
+	// (usages are counted for the feed and the model)
+	if counts, _ := usage.feedUsage("test", time.Now()); counts != (usageCounts{Requests: 2, InputTokens: 100, OutputTokens: 20, Errors: 1}) {
+		t.Errorf("unexpected usage: %+v", counts)
+	}
+	empty := newTestOpenAIServer(t, http.StatusOK, "", nil)
+	if _, _, _, _, err := newOpenAISummarizer(empty.URL+"/v1", "local-model", "", nil).generate(context.Background(), summaryRequest{prompt: "prompt"}); err == nil {
+		t.Error("expected error for an empty reply, got nil")
+	}
+}
+
+func TestParseTitleAndSummary(t *testing.T) {
+	tests := []struct {
+		reply       string
+		wantTitle   string
+		wantSummary string
+	}{
+		{reply: `{"title": "Title", "summary": "- point 1\n- point 2"}`, wantTitle: "Title", wantSummary: "- point 1\n- point 2"},
+		{reply: "```json\n{\"title\": \"Title\", \"summary\": \"Summary\"}\n```", wantTitle: "Title", wantSummary: "Summary"},
+		{reply: "Just a summary, not in json.", wantTitle: "", wantSummary: "Just a summary, not in json."},
+		{reply: `{"title": "Title"}`, wantTitle: "", wantSummary: `{"title": "Title"}`},
+	}
+
+	for _, tt := range tests {
+		if title, summary, _ := parseTitleAndSummary(tt.reply); title != tt.wantTitle || summary != tt.wantSummary {
+			t.Errorf("parseTitleAndSummary(%q) = %q, %q, want %q, %q", tt.reply, title, summary, tt.wantTitle, tt.wantSummary)
+		}
+	}
+
+	if _, _, tags := parseTitleAndSummary(`{"title": "Title", "summary": "Summary", "tags": ["go", "rss"]}`); !slices.Equal(tags, []string{"go", "rss"}) {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+}
+
+func TestSummarizeAndCache_OpenAI(t *testing.T) {
+	requests := make(chan testOpenAIRequest, 1)
+	stub := newTestOpenAIServer(t, http.StatusOK, `{"title": "Translated", "summary": "Summarized with a stub."}`, requests)
+
+	articles := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = io.WriteString(w, testArticleHTML)
+	}))
+	defer articles.Close()
+
+	// (no google ai api keys are needed)
+	path := writeTestConfig(t, `{
+		"db_files_dir": "`+t.TempDir()+`",
+		"rss_feeds": [{
+			"name": "t",
+			"cache_filename": "t.db",
+			"serve_path": "/t",
+			"feed_urls": ["https://example.com/rss"],
+			"summarizer": {"provider": "openai", "base_url": "`+stub.URL+`/v1", "model": "stub-model"},
+			"summary_prompt": {"format": "tldr"}
+		}],
+		"rss_server_port": 8080
+	}`)
+	conf, err := readConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := newFeed(conf, conf.RSSFeeds[0], newUsageAccountant(conf, apiKeysOf(conf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.store.close() }()
+
+	link := articles.URL + "/article"
+	items := []*gofeed.Item{{GUID: "1", Title: "Original", Link: link, Links: []string{link}}}
+	if deferred, err := summarizeAndCache(context.Background(), f, []gofeed.Feed{{Items: items}}, nil, conf); err != nil || len(deferred) > 0 {
+		t.Fatalf("unexpected result: %v, %v", deferred, err)
+	}
+
+	if prompt := (<-requests).body.Messages[1].Content; !strings.Contains(prompt, "Headline") || !strings.Contains(prompt, _summaryFormats["tldr"]) {
+		t.Errorf("expected the extracted content and the format in the prompt, got: %s", prompt)
+	}
+
+	cached := f.client.ListCachedItems(false)
+	if len(cached) != 1 {
+		t.Fatalf("expected 1 cached item, got %d", len(cached))
+	}
+	if cached[0].Title != "Translated" || !strings.HasPrefix(cached[0].Summary, "Summarized with a stub.\n\n(summarized with **stub-model**") || cached[0].Link != link {
+		t.Errorf("unexpected cached item: %+v", cached[0])
+	}
+}
@@ -0,0 +1,70 @@
+// pdf.go
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+const (
+	pdfWordSpacingRatio = 0.15 // (of font sizes) texts further apart than this are considered as separate words
+)
+
+// extract texts of given pdf document `data`
+//
+// pages after the one where the texts exceed `maxBytes` are not extracted. (no limit if <= 0)
+// (for summarizers which cannot read pdf documents by themselves, eg. OpenAI-compatible or extractive ones)
+func extractPDFText(data []byte, maxBytes int) (text string, err error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("%PDF-")) {
+		return "", errors.New("not a pdf document")
+	}
+
+	// (malformed documents may panic while being parsed)
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = "", fmt.Errorf("malformed pdf document: %v", r)
+		}
+	}()
+
+	var r *pdf.Reader
+	if r, err = pdf.NewReader(bytes.NewReader(data), int64(len(data))); err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for i := 1; i <= r.NumPage() && (maxBytes <= 0 || sb.Len() <= maxBytes); i++ {
+		page := r.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		sb.WriteString(pdfPageText(page.Content().Text))
+		sb.WriteString("\n\n")
+	}
+
+	return normalizeParagraphs(sb.String()), nil
+}
+
+// lay out given (positioned) texts of a page in lines
+//
+// a space is put between texts which are apart from each other, and a line break between texts on different lines.
+func pdfPageText(texts []pdf.Text) string {
+	var sb strings.Builder
+	for i, text := range texts {
+		if i > 0 {
+			prev := texts[i-1]
+			if math.Abs(text.Y-prev.Y) > prev.FontSize/2 {
+				sb.WriteString("\n")
+			} else if text.X-(prev.X+prev.W) > prev.FontSize*pdfWordSpacingRatio {
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString(text.S)
+	}
+	return sb.String()
+}
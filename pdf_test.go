@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// build a single-page pdf document with given content stream (and a `ToUnicode` cmap of its font) for testing
+func makeTestPDF(t *testing.T, content string, compress bool, cmap string) []byte {
+	t.Helper()
+
+	stream := func(dict, data string) string {
+		if !compress {
+			return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+		}
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		_, _ = w.Write([]byte(data))
+		_ = w.Close()
+		return fmt.Sprintf("<< %s /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream", dict, buf.Len(), buf.String())
+	}
+
+	font := "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>"
+	if cmap != "" {
+		font = "<< /Type /Font /Subtype /Type0 /BaseFont /Test /Encoding /Identity-H /ToUnicode 6 0 R >>"
+	}
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 /Resources << /Font << /F1 5 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents [4 0 R] >>",
+		stream("", content),
+		font,
+		stream("", cmap),
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := []int{}
+	for i, object := range objects {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+func TestExtractPDFText(t *testing.T) {
+	const cmap = `/CIDInit /ProcSet findresource begin
+begincmap
+1 begincodespacerange
+<0000> <FFFF>
+endcodespacerange
+2 beginbfchar
+<0001> <D55C>
+<0002> <AE00>
+endbfchar
+1 beginbfrange
+<0010> <0012> <0041>
+endbfrange
+endcmap`
+
+	tests := []struct {
+		name     string
+		content  string
+		compress bool
+		cmap     string
+		want     []string
+	}{
+		{
+			name:    "uncompressed",
+			content: "BT /F1 12 Tf 72 720 Td (Hello, PDF \\(world\\)!) Tj 0 -14 Td [(Split)-300(words)] TJ ET",
+			want:    []string{"Hello, PDF (world)!", "Split words"},
+		},
+		{
+			name:     "compressed",
+			content:  "BT /F1 12 Tf 72 720 Td (Compressed text) Tj T* (Next \\101 line) Tj ET",
+			compress: true,
+			want:     []string{"Compressed text", "Next A line"},
+		},
+		{
+			name:    "cmap",
+			content: "BT /F1 12 Tf 72 720 Td <00010002> Tj 0 -14 Td <001000110012> Tj ET",
+			cmap:    cmap,
+			want:    []string{"한글", "ABC"},
+		},
+	}
+
+	for _, tt := range tests {
+		text, err := extractPDFText(makeTestPDF(t, tt.content, tt.compress, tt.cmap), 0)
+		if err != nil {
+			t.Errorf("[%s] failed to extract text: %s", tt.name, err)
+			continue
+		}
+		lines := strings.Split(text, "\n")
+		for _, expected := range tt.want {
+			if !strings.Contains(text, expected) {
+				t.Errorf("[%s] expected '%s' in extracted text, got: %q", tt.name, expected, lines)
+			}
+		}
+	}
+
+	if _, err := extractPDFText([]byte("<html></html>"), 0); err == nil {
+		t.Error("expected error for a non-pdf document, got nil")
+	}
+}
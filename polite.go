@@ -0,0 +1,379 @@
+// polite.go
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const (
+	robotsTxtCacheDuration      = 24 * time.Hour
+	robotsTxtErrorCacheDuration = 1 * time.Hour
+	robotsTxtFetchTimeout       = 10 * time.Second
+	maxRobotsTxtBytes           = 512 * 1024 // 512KB
+)
+
+// errDisallowedByRobots is returned for urls which are disallowed by robots.txt
+var errDisallowedByRobots = errors.New("disallowed by robots.txt")
+
+// robotsRule struct
+type robotsRule struct {
+	allow bool
+	path  string // (can contain `*` wildcards and a `$` anchor)
+}
+
+// robotsRules struct (parsed rules of robots.txt for a user agent)
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// parse robots.txt from `r` for given user agent `token`
+//
+// rules of the group for `token` are used, or ones of `*` if there is no such group.
+func parseRobotsTxt(r io.Reader, token string) *robotsRules {
+	token = strings.ToLower(token)
+
+	specific, wildcard := &robotsRules{}, &robotsRules{}
+	var foundSpecific bool
+	var current []*robotsRules // rules of the current group
+	inAgents := false          // reading `User-agent` lines of a group
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				current = nil
+				inAgents = true
+			}
+			agent := strings.ToLower(value)
+			if agent == "*" {
+				current = append(current, wildcard)
+			} else if token != "" && strings.Contains(token, agent) {
+				current = append(current, specific)
+				foundSpecific = true
+			}
+		case "allow", "disallow":
+			inAgents = false
+			if value == "" {
+				continue // (empty disallow allows all)
+			}
+			for _, rules := range current {
+				rules.rules = append(rules.rules, robotsRule{allow: key == "allow", path: value})
+			}
+		case "crawl-delay":
+			inAgents = false
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				for _, rules := range current {
+					rules.crawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		default:
+			inAgents = false
+		}
+	}
+
+	if foundSpecific {
+		return specific
+	}
+	return wildcard
+}
+
+// check if given `path` (with its query) is allowed by the rules
+//
+// (the longest matching rule wins, and `allow` wins ties)
+func (r *robotsRules) allowed(path string) bool {
+	if r == nil {
+		return true
+	}
+
+	allow, longest := true, -1
+	for _, rule := range r.rules {
+		if robotsPathMatches(rule.path, path) {
+			if l := len(rule.path); l > longest || (l == longest && rule.allow) {
+				allow, longest = rule.allow, l
+			}
+		}
+	}
+	return allow
+}
+
+// check if given robots.txt `pattern` matches `path`
+func robotsPathMatches(pattern, path string) bool {
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(strings.TrimSuffix(pattern, "$")), `\*`, ".*")
+	if strings.HasSuffix(pattern, "$") {
+		expr += "$"
+	}
+	if re, err := regexp.Compile(expr); err == nil {
+		return re.MatchString(path)
+	}
+	return false
+}
+
+// user agent token of given user agent string for matching robots.txt groups
+func robotsAgentToken(userAgent string) string {
+	token, _, _ := strings.Cut(userAgent, "/")
+	token, _, _ = strings.Cut(token, " ")
+	return token
+}
+
+// politeHost struct (politeness state of a host)
+type politeHost struct {
+	slots limiter
+
+	mu   sync.Mutex
+	next time.Time // earliest time of the next request
+
+	robotsMu        sync.Mutex
+	robots          *robotsRules
+	robotsExpiresAt time.Time
+}
+
+// politeness struct
+//
+// spaces requests to the same host by the crawl delay, limits concurrent connections per host,
+// and (optionally) checks robots.txt of hosts. shared by all feeds.
+type politeness struct {
+	userAgent      string // empty for default ones
+	crawlDelay     time.Duration
+	maxConnections int
+	respectRobots  bool
+
+	client *http.Client // for fetching robots.txt
+
+	mu    sync.Mutex
+	hosts map[string]*politeHost
+}
+
+// create a new politeness with given config
+func newPoliteness(conf config) *politeness {
+	p := &politeness{
+		crawlDelay:     time.Duration(conf.CrawlDelaySeconds * float64(time.Second)),
+		maxConnections: conf.MaxConnectionsPerHost,
+		respectRobots:  conf.RespectRobotsTxt,
+		client:         &http.Client{Timeout: robotsTxtFetchTimeout},
+		hosts:          map[string]*politeHost{},
+	}
+	if conf.UserAgent != nil {
+		p.userAgent = *conf.UserAgent
+	}
+	return p
+}
+
+// get the user agent, or `fallback` if it is not configured
+func (p *politeness) userAgentOr(fallback string) string {
+	if p == nil || p.userAgent == "" {
+		return fallback
+	}
+	return p.userAgent
+}
+
+// get the state of given host
+func (p *politeness) host(host string) *politeHost {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	h, exists := p.hosts[host]
+	if !exists {
+		h = &politeHost{slots: newLimiter(p.maxConnections)}
+		p.hosts[host] = h
+	}
+	return h
+}
+
+// get the robots.txt rules of given url's host (fetched and cached)
+func (p *politeness) robotsOf(ctx context.Context, u *url.URL) *robotsRules {
+	h := p.host(u.Host)
+
+	h.robotsMu.Lock()
+	defer h.robotsMu.Unlock()
+
+	if time.Now().Before(h.robotsExpiresAt) {
+		return h.robots
+	}
+
+	rules, err := p.fetchRobotsTxt(ctx, u)
+	if err == nil {
+		h.robots, h.robotsExpiresAt = rules, time.Now().Add(robotsTxtCacheDuration)
+	} else {
+		log.Printf("# failed to fetch robots.txt of '%s' (allowing all): %s", u.Host, err)
+		h.robots, h.robotsExpiresAt = nil, time.Now().Add(robotsTxtErrorCacheDuration)
+	}
+	return h.robots
+}
+
+// fetch and parse robots.txt of given url's host
+func (p *politeness) fetchRobotsTxt(ctx context.Context, u *url.URL) (*robotsRules, error) {
+	robotsURL := url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	userAgent := p.userAgentOr(fetchUserAgent)
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return parseRobotsTxt(io.LimitReader(resp.Body, maxRobotsTxtBytes), robotsAgentToken(userAgent)), nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return &robotsRules{}, nil // (no robots.txt: allow all)
+	default:
+		return nil, fmt.Errorf("http error %d", resp.StatusCode)
+	}
+}
+
+// check if given url is allowed to be crawled
+func (p *politeness) allowed(ctx context.Context, rawURL string) bool {
+	if p == nil || !p.respectRobots {
+		return true
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return true
+	}
+	return p.robotsOf(ctx, u).allowed(u.RequestURI())
+}
+
+// wait for a polite time to request given url
+//
+// the returned `release` must be called when the request is done.
+// crawl delays of robots.txt are honoured if enabled, and when `checkRobots` is true, urls disallowed by robots.txt are rejected with `errDisallowedByRobots`.
+func (p *politeness) wait(ctx context.Context, rawURL string, checkRobots bool) (release func(), err error) {
+	if p == nil {
+		return func() {}, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return func() {}, nil
+	}
+
+	delay := p.crawlDelay
+	if p.respectRobots {
+		rules := p.robotsOf(ctx, u)
+		if checkRobots && !rules.allowed(u.RequestURI()) {
+			return nil, errDisallowedByRobots
+		}
+		if rules != nil {
+			delay = max(delay, rules.crawlDelay)
+		}
+	}
+
+	h := p.host(u.Host)
+	if err := h.slots.acquire(ctx); err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	at := time.Now()
+	if h.next.After(at) {
+		at = h.next
+	}
+	h.next = at.Add(delay)
+	h.mu.Unlock()
+
+	if !sleep(ctx, time.Until(at)) {
+		h.slots.release()
+		return nil, ctx.Err()
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(h.slots.release)
+	}, nil
+}
+
+// get a http client which requests politely
+func (p *politeness) httpClient() *http.Client {
+	if p == nil {
+		return http.DefaultClient
+	}
+	return &http.Client{
+		Transport: &politeTransport{
+			base:   http.DefaultTransport,
+			polite: p,
+		},
+	}
+}
+
+// politeTransport struct (http.RoundTripper which waits for polite times of hosts)
+type politeTransport struct {
+	base   http.RoundTripper
+	polite *politeness
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *politeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	release, err := t.polite.wait(req.Context(), req.URL.String(), false)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releasingBody struct (releases the connection slot of its host on close)
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+// Close implements io.Closer
+func (b *releasingBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
+
+// drop items of given feeds `fs` whose links are disallowed by robots.txt
+func dropDisallowedItems(ctx context.Context, fs []gofeed.Feed, polite *politeness, verbose bool) (allowed []gofeed.Feed, numDropped int) {
+	for _, f := range fs {
+		items := []*gofeed.Item{}
+		for _, item := range f.Items {
+			if item.Link == "" || polite.allowed(ctx, item.Link) {
+				items = append(items, item)
+			} else {
+				if verbose {
+					log.Printf(">>> skipping item disallowed by robots.txt: '%s' (%s)", item.Title, item.Link)
+				}
+				numDropped++
+			}
+		}
+		f.Items = items
+		allowed = append(allowed, f)
+	}
+	return allowed, numDropped
+}
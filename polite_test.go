@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const testRobotsTxt = `# comment
+User-agent: *
+Disallow: /private/
+Allow: /private/public$
+Crawl-delay: 2
+
+User-agent: SomeBot
+User-agent: OtherBot
+Disallow: /
+Allow: /feeds/*.xml
+Crawl-delay: 0.5
+`
+
+func TestParseRobotsTxt(t *testing.T) {
+	tests := []struct {
+		token     string
+		path      string
+		want      bool
+		wantDelay time.Duration
+	}{
+		{token: "Mozilla", path: "/", want: true, wantDelay: 2 * time.Second},
+		{token: "Mozilla", path: "/private/secret", want: false, wantDelay: 2 * time.Second},
+		{token: "Mozilla", path: "/private/public", want: true, wantDelay: 2 * time.Second},
+		{token: "Mozilla", path: "/private/public/more", want: false, wantDelay: 2 * time.Second},
+		{token: "SomeBot", path: "/articles/1", want: false, wantDelay: 500 * time.Millisecond},
+		{token: "otherbot", path: "/feeds/all.xml", want: true, wantDelay: 500 * time.Millisecond},
+		{token: "OtherBot", path: "/feeds/all.json", want: false, wantDelay: 500 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		rules := parseRobotsTxt(strings.NewReader(testRobotsTxt), tt.token)
+		if got := rules.allowed(tt.path); got != tt.want {
+			t.Errorf("allowed(%q) for '%s' = %v, want %v", tt.path, tt.token, got, tt.want)
+		}
+		if rules.crawlDelay != tt.wantDelay {
+			t.Errorf("crawl delay for '%s' = %s, want %s", tt.token, rules.crawlDelay, tt.wantDelay)
+		}
+	}
+
+	// nil rules allow all
+	var rules *robotsRules
+	if !rules.allowed("/anything") {
+		t.Error("expected nil rules to allow all")
+	}
+}
+
+func TestRobotsAgentToken(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      string
+	}{
+		{userAgent: "SomeBot/1.0 (+https://example.com)", want: "SomeBot"},
+		{userAgent: "Mozilla/5.0 (X11; Linux x86_64)", want: "Mozilla"},
+		{userAgent: "plain agent", want: "plain"},
+	}
+
+	for _, tt := range tests {
+		if got := robotsAgentToken(tt.userAgent); got != tt.want {
+			t.Errorf("robotsAgentToken(%q) = %q, want %q", tt.userAgent, got, tt.want)
+		}
+	}
+}
+
+func TestPolitenessWait(t *testing.T) {
+	p := newPoliteness(config{CrawlDelaySeconds: 0.05, MaxConnectionsPerHost: 1})
+
+	// spaced by the crawl delay
+	start := time.Now()
+	for range 3 {
+		release, err := p.wait(context.Background(), "https://example.com/a", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expected requests to be spaced by the crawl delay, took %s", elapsed)
+	}
+
+	// other hosts are not affected
+	start = time.Now()
+	if release, err := p.wait(context.Background(), "https://example.org/a", false); err != nil {
+		t.Fatal(err)
+	} else {
+		release()
+	}
+	if elapsed := time.Since(start); elapsed > 40*time.Millisecond {
+		t.Errorf("expected no wait for another host, took %s", elapsed)
+	}
+
+	// capped concurrent connections
+	release, err := p.wait(context.Background(), "https://example.net/a", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.wait(ctx, "https://example.net/b", false); err == nil {
+		t.Error("expected error while all connections to the host are in use, got nil")
+	}
+	release()
+	release() // (releasing twice is harmless)
+
+	// nil politeness never waits
+	var none *politeness
+	if release, err := none.wait(context.Background(), "https://example.com/", true); err != nil {
+		t.Error(err)
+	} else {
+		release()
+	}
+}
+
+func TestPolitenessRobotsTxt(t *testing.T) {
+	var robotsFetched atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		robotsFetched.Add(1)
+		if !strings.HasPrefix(r.UserAgent(), "SomeBot") {
+			t.Errorf("unexpected user agent: %s", r.UserAgent())
+		}
+		_, _ = io.WriteString(w, "User-agent: SomeBot\nDisallow: /private/\n")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	p := newPoliteness(config{
+		UserAgent:        new("SomeBot/1.0"),
+		RespectRobotsTxt: true,
+	})
+
+	if !p.allowed(context.Background(), server.URL+"/articles/1") {
+		t.Error("expected an allowed url")
+	}
+	if p.allowed(context.Background(), server.URL+"/private/1") {
+		t.Error("expected a disallowed url")
+	}
+	if _, err := p.wait(context.Background(), server.URL+"/private/2", true); err != errDisallowedByRobots {
+		t.Errorf("expected errDisallowedByRobots, got %v", err)
+	}
+	if n := robotsFetched.Load(); n != 1 {
+		t.Errorf("expected robots.txt to be fetched once (cached), got %d", n)
+	}
+
+	// missing robots.txt allows all
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	if !p.allowed(context.Background(), missing.URL+"/private/1") {
+		t.Error("expected all urls to be allowed without robots.txt")
+	}
+
+	// not checked when disabled
+	disabled := newPoliteness(config{})
+	if !disabled.allowed(context.Background(), server.URL+"/private/1") {
+		t.Error("expected robots.txt not to be checked when disabled")
+	}
+}
+
+func TestPoliteTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.UserAgent())
+	}))
+	defer server.Close()
+
+	p := newPoliteness(config{MaxConnectionsPerHost: 1})
+	client := p.httpClient()
+
+	for range 2 { // (would block if the connection was not released on close)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			cancel()
+			t.Fatal(err)
+		}
+		_, _ = io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		cancel()
+	}
+}
+
+func TestDropDisallowedItems(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "User-agent: *\nDisallow: /private/\n")
+	}))
+	defer server.Close()
+
+	p := newPoliteness(config{RespectRobotsTxt: true})
+	fs := []gofeed.Feed{
+		{Items: []*gofeed.Item{
+			{GUID: "1", Link: server.URL + "/articles/1"},
+			{GUID: "2", Link: server.URL + "/private/2"},
+			{GUID: "3"},
+		}},
+	}
+
+	allowed, dropped := dropDisallowedItems(context.Background(), fs, p, false)
+	if dropped != 1 || numItems(allowed) != 2 {
+		t.Errorf("expected 1 item dropped and 2 allowed, got %d and %d", dropped, numItems(allowed))
+	}
+}
@@ -0,0 +1,119 @@
+// poll.go
+
+package main
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/mmcdole/gofeed/rss"
+)
+
+const (
+	pollCadenceMaxItems = 10 // number of the latest items for learning the posting cadence of a source
+)
+
+// durations of `sy:updatePeriod` values
+var _syndicationUpdatePeriods = map[string]time.Duration{
+	"hourly":  time.Hour,
+	"daily":   24 * time.Hour,
+	"weekly":  7 * 24 * time.Hour,
+	"monthly": 30 * 24 * time.Hour,
+	"yearly":  365 * 24 * time.Hour,
+}
+
+// average interval between the latest posts of given `items`
+//
+// when the latest post is older than the average interval, the time since it is used instead,
+// so that sources which became quiet are polled less often. returns 0 if it cannot be learned.
+func postingCadence(items []*gofeed.Item, now time.Time) time.Duration {
+	times := []time.Time{}
+	for _, item := range items {
+		if t := itemTimeOf(item); t != nil {
+			times = append(times, *t)
+		}
+	}
+	if len(times) < 2 {
+		return 0
+	}
+
+	slices.SortFunc(times, func(a, b time.Time) int {
+		return b.Compare(a)
+	})
+	times = times[:min(len(times), pollCadenceMaxItems)]
+
+	cadence := times[0].Sub(times[len(times)-1]) / time.Duration(len(times)-1)
+	return max(cadence, now.Sub(times[0]))
+}
+
+// published (or updated) time of given item
+func itemTimeOf(item *gofeed.Item) *time.Time {
+	if item.PublishedParsed != nil {
+		return item.PublishedParsed
+	}
+	return item.UpdatedParsed
+}
+
+// minimum polling interval hinted by given fetched source
+//
+// (RSS `<ttl>`, `<sy:updatePeriod>` with `<sy:updateFrequency>`, and `Cache-Control: max-age`)
+func pollIntervalHint(result fetchedSource) (hint time.Duration) {
+	hint = result.maxAge
+
+	if result.feed == nil {
+		return hint
+	}
+
+	if original, ok := result.feed.OriginalFeed().(*rss.Feed); ok {
+		if ttl, err := strconv.Atoi(strings.TrimSpace(original.TTL)); err == nil && ttl > 0 {
+			hint = max(hint, time.Duration(ttl)*time.Minute)
+		}
+	}
+
+	if sy, exists := result.feed.Extensions["sy"]; exists {
+		if periods := sy["updatePeriod"]; len(periods) > 0 {
+			if period, exists := _syndicationUpdatePeriods[strings.ToLower(strings.TrimSpace(periods[0].Value))]; exists {
+				frequency := 1
+				if frequencies := sy["updateFrequency"]; len(frequencies) > 0 {
+					if f, err := strconv.Atoi(strings.TrimSpace(frequencies[0].Value)); err == nil && f > 0 {
+						frequency = f
+					}
+				}
+				hint = max(hint, period/time.Duration(frequency))
+			}
+		}
+	}
+
+	return hint
+}
+
+// parse `max-age` of given `Cache-Control` header value
+func maxAgeOf(cacheControl string) time.Duration {
+	for directive := range strings.SplitSeq(cacheControl, ",") {
+		if value, found := strings.CutPrefix(strings.ToLower(strings.TrimSpace(directive)), "max-age="); found {
+			if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return 0
+}
+
+// next polling interval of a source after a successful fetch
+//
+// polls at half of the posting cadence (or `previous` if it cannot be learned),
+// not more often than hinted by the source, and within `minInterval` and `maxInterval`.
+func nextPollInterval(result fetchedSource, previous, minInterval, maxInterval time.Duration, now time.Time) time.Duration {
+	interval := previous
+	if result.feed != nil {
+		if cadence := postingCadence(result.feed.Items, now); cadence > 0 {
+			interval = cadence / 2
+		}
+	}
+	interval = max(interval, pollIntervalHint(result))
+
+	return min(max(interval, minInterval), maxInterval)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// parse given feed xml for testing (with its original feed kept)
+func parseTestFeed(t *testing.T, xml string) *gofeed.Feed {
+	t.Helper()
+
+	parser := gofeed.NewParser()
+	parser.KeepOriginalFeed = true
+	feed, err := parser.Parse(strings.NewReader(xml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return feed
+}
+
+// create items published at given times before `now` for testing
+func testItemsPublishedBefore(now time.Time, befores ...time.Duration) (items []*gofeed.Item) {
+	for _, before := range befores {
+		published := now.Add(-before)
+		items = append(items, &gofeed.Item{PublishedParsed: &published})
+	}
+	return items
+}
+
+func TestPostingCadence(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		items []*gofeed.Item
+		want  time.Duration
+	}{
+		{name: "no items", items: nil, want: 0},
+		{name: "single item", items: testItemsPublishedBefore(now, time.Hour), want: 0},
+		{name: "busy", items: testItemsPublishedBefore(now, 10*time.Minute, 30*time.Minute, 50*time.Minute), want: 20 * time.Minute},
+		{name: "quiet", items: testItemsPublishedBefore(now, 48*time.Hour, 49*time.Hour), want: 48 * time.Hour},
+		{name: "undated items ignored", items: append(testItemsPublishedBefore(now, 0, time.Hour), &gofeed.Item{}), want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := postingCadence(tt.items, now); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMaxAgeOf(t *testing.T) {
+	tests := map[string]time.Duration{
+		"":                                 0,
+		"no-cache":                         0,
+		"max-age=300":                      5 * time.Minute,
+		"public, Max-Age=600, s-maxage=60": 10 * time.Minute,
+		"max-age=invalid":                  0,
+	}
+
+	for cacheControl, want := range tests {
+		if got := maxAgeOf(cacheControl); got != want {
+			t.Errorf("maxAgeOf(%q) = %s, want %s", cacheControl, got, want)
+		}
+	}
+}
+
+func TestPollIntervalHint(t *testing.T) {
+	tests := []struct {
+		name   string
+		xml    string
+		maxAge time.Duration
+		want   time.Duration
+	}{
+		{
+			name: "no hints",
+			xml:  `<rss version="2.0"><channel><title>t</title></channel></rss>`,
+			want: 0,
+		},
+		{
+			name: "ttl",
+			xml:  `<rss version="2.0"><channel><title>t</title><ttl>60</ttl></channel></rss>`,
+			want: time.Hour,
+		},
+		{
+			name: "sy:updatePeriod",
+			xml: `<rss version="2.0" xmlns:sy="http://purl.org/rss/1.0/modules/syndication/"><channel><title>t</title>
+<sy:updatePeriod>daily</sy:updatePeriod><sy:updateFrequency>4</sy:updateFrequency></channel></rss>`,
+			want: 6 * time.Hour,
+		},
+		{
+			name:   "max-age",
+			xml:    `<rss version="2.0"><channel><title>t</title><ttl>5</ttl></channel></rss>`,
+			maxAge: 10 * time.Minute,
+			want:   10 * time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := fetchedSource{feed: parseTestFeed(t, tt.xml), maxAge: tt.maxAge}
+			if got := pollIntervalHint(result); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNextPollInterval(t *testing.T) {
+	now := time.Now()
+	minInterval, maxInterval := time.Minute, time.Hour
+
+	tests := []struct {
+		name   string
+		result fetchedSource
+		want   time.Duration
+	}{
+		{
+			name:   "not modified",
+			result: fetchedSource{notModified: true},
+			want:   10 * time.Minute,
+		},
+		{
+			name:   "busy",
+			result: fetchedSource{feed: &gofeed.Feed{Items: testItemsPublishedBefore(now, 0, 20*time.Minute)}},
+			want:   10 * time.Minute,
+		},
+		{
+			name:   "very busy",
+			result: fetchedSource{feed: &gofeed.Feed{Items: testItemsPublishedBefore(now, 0, time.Second)}},
+			want:   minInterval,
+		},
+		{
+			name:   "quiet",
+			result: fetchedSource{feed: &gofeed.Feed{Items: testItemsPublishedBefore(now, 24*time.Hour, 48*time.Hour)}},
+			want:   maxInterval,
+		},
+		{
+			name:   "hinted",
+			result: fetchedSource{feed: &gofeed.Feed{Items: testItemsPublishedBefore(now, 0, 20*time.Minute)}, maxAge: 30 * time.Minute},
+			want:   30 * time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextPollInterval(tt.result, 10*time.Minute, minInterval, maxInterval, now); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
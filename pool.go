@@ -0,0 +1,243 @@
+// pool.go
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	ssg "github.com/meinside/simple-scrapper-go"
+)
+
+const (
+	scrapperHealthCheckIdle = 1 * time.Minute // idle scrappers are checked before reuse after this
+	scrapperHealthCheckText = "ok"
+)
+
+// pooledScrapper struct
+type pooledScrapper struct {
+	scrapper *ssg.Scrapper
+	pages    int // number of pages crawled so far
+	lastUsed time.Time
+	failure  error // error of a failed scrape (recycled on release if not nil)
+}
+
+// scrapperPool struct
+//
+// keeps up to `size` long-lived scrappers (headless browsers) shared by all feeds,
+// which are health-checked before reuse, and recycled after `maxPages` pages, on crash, or after a failed scrape.
+type scrapperPool struct {
+	slots    limiter
+	maxPages int
+
+	mu     sync.Mutex
+	idle   []*pooledScrapper
+	inUse  map[*ssg.Scrapper]*pooledScrapper
+	closed bool
+
+	// (replaceable for testing)
+	create  func() *ssg.Scrapper
+	check   func(*ssg.Scrapper) error
+	destroy func(*ssg.Scrapper) error
+	scrape  func(*ssg.Scrapper, string) (string, error)
+
+	healthCheck *http.Server
+	healthURL   string
+}
+
+// create a new scrapper pool (scrappers crawl politely with given `polite`)
+func newScrapperPool(size, maxPages int, polite *politeness) *scrapperPool {
+	p := &scrapperPool{
+		slots:    newLimiter(max(size, 1)),
+		maxPages: maxPages,
+		inUse:    map[*ssg.Scrapper]*pooledScrapper{},
+		create: func() *ssg.Scrapper {
+			return newScrapper(polite)
+		},
+		destroy: func(s *ssg.Scrapper) error {
+			return s.Close()
+		},
+		scrape: scrapeText,
+	}
+	p.check = p.checkHealth
+
+	// serve a page on loopback for health checks
+	if listener, err := net.Listen("tcp", "127.0.0.1:0"); err == nil {
+		p.healthURL = fmt.Sprintf("http://%s/", listener.Addr())
+		p.healthCheck = &http.Server{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = fmt.Fprintf(w, "<html><body>%s</body></html>", scrapperHealthCheckText)
+			}),
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+		go func() {
+			if err := p.healthCheck.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("# health check server of scrapper pool stopped: %s", err)
+			}
+		}()
+	} else {
+		log.Printf("# failed to listen for health checks of scrappers: %s", err)
+	}
+
+	return p
+}
+
+// check if given scrapper can crawl the health check page
+func (p *scrapperPool) checkHealth(s *ssg.Scrapper) error {
+	if p.healthURL == "" {
+		return nil
+	}
+	crawled, err := s.CrawlURLs([]string{p.healthURL}, false)
+	if err != nil {
+		return err
+	}
+	for _, text := range crawled {
+		if strings.Contains(text, scrapperHealthCheckText) {
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected health check result: %v", crawled)
+}
+
+// acquire a scrapper from the pool, waiting for a free slot until `ctx` is done
+//
+// the returned scrapper can be nil if it could not be created, and `release` must be called
+// with the number of crawled pages after using it.
+//
+// (a nil pool creates a new scrapper, and closes it on release)
+func (p *scrapperPool) acquire(ctx context.Context) (scrapper *ssg.Scrapper, release func(pages int)) {
+	if p == nil {
+		scrapper = newScrapper(nil)
+		return scrapper, func(int) {
+			if scrapper != nil {
+				if err := scrapper.Close(); err != nil {
+					log.Printf("# failed to close scrapper: %s", err)
+				}
+			}
+		}
+	}
+
+	if err := p.slots.acquire(ctx); err != nil {
+		return nil, func(int) {}
+	}
+
+	ps := p.take()
+	if ps == nil {
+		return nil, func(int) { p.slots.release() }
+	}
+
+	p.mu.Lock()
+	p.inUse[ps.scrapper] = ps
+	p.mu.Unlock()
+
+	return ps.scrapper, func(pages int) {
+		p.mu.Lock()
+		delete(p.inUse, ps.scrapper)
+		p.mu.Unlock()
+
+		p.put(ps, pages)
+		p.slots.release()
+	}
+}
+
+// scrape the text of given `url` with `scrapper` (acquired from the pool)
+//
+// the scrapper is marked as unhealthy when it fails, so that it is recycled on release
+// instead of being health-checked before reuse.
+func (p *scrapperPool) scrapeText(scrapper *ssg.Scrapper, url string) (text string, err error) {
+	if p == nil {
+		return scrapeText(scrapper, url)
+	}
+
+	if text, err = p.scrape(scrapper, url); err != nil {
+		p.mu.Lock()
+		if ps, exists := p.inUse[scrapper]; exists && ps.failure == nil {
+			ps.failure = err
+		}
+		p.mu.Unlock()
+	}
+	return text, err
+}
+
+// take an idle (and healthy) scrapper, or create a new one
+func (p *scrapperPool) take() *pooledScrapper {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil
+		}
+		var ps *pooledScrapper
+		if n := len(p.idle); n > 0 {
+			ps, p.idle = p.idle[n-1], p.idle[:n-1]
+		}
+		p.mu.Unlock()
+
+		if ps == nil {
+			if s := p.create(); s != nil {
+				return &pooledScrapper{scrapper: s}
+			}
+			return nil
+		}
+
+		if time.Since(ps.lastUsed) < scrapperHealthCheckIdle {
+			return ps
+		}
+		ps.pages++
+		if err := p.check(ps.scrapper); err == nil {
+			return ps
+		} else {
+			log.Printf("# recycling unhealthy scrapper: %s", err)
+			p.recycle(ps)
+		}
+	}
+}
+
+// put given scrapper back to the pool (or recycle it)
+func (p *scrapperPool) put(ps *pooledScrapper, pages int) {
+	ps.pages += pages
+	ps.lastUsed = time.Now()
+
+	p.mu.Lock()
+	if !p.closed && (p.maxPages <= 0 || ps.pages < p.maxPages) && ps.failure == nil {
+		p.idle = append(p.idle, ps)
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+
+	if ps.failure != nil {
+		log.Printf("# recycling unhealthy scrapper: %s", ps.failure)
+	}
+	p.recycle(ps)
+}
+
+// close given scrapper
+func (p *scrapperPool) recycle(ps *pooledScrapper) {
+	if err := p.destroy(ps.scrapper); err != nil {
+		log.Printf("# failed to close scrapper: %s", err)
+	}
+}
+
+// close the pool and its idle scrappers (scrappers in use are closed on release)
+func (p *scrapperPool) close() {
+	p.mu.Lock()
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+
+	for _, ps := range idle {
+		p.recycle(ps)
+	}
+	if p.healthCheck != nil {
+		_ = p.healthCheck.Close()
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	ssg "github.com/meinside/simple-scrapper-go"
+)
+
+// fake scrappers of a pool for testing
+type testScrappers struct {
+	created, destroyed []*ssg.Scrapper
+	checkErr           error
+	checked            int
+	scrapeErr          error
+}
+
+// create a scrapper pool with fake scrappers for testing
+func newTestScrapperPool(t *testing.T, size, maxPages int) (*scrapperPool, *testScrappers) {
+	t.Helper()
+
+	p := newScrapperPool(size, maxPages, nil)
+	t.Cleanup(p.close)
+
+	fakes := &testScrappers{}
+	p.create = func() *ssg.Scrapper {
+		s := &ssg.Scrapper{}
+		fakes.created = append(fakes.created, s)
+		return s
+	}
+	p.check = func(*ssg.Scrapper) error {
+		fakes.checked++
+		return fakes.checkErr
+	}
+	p.destroy = func(s *ssg.Scrapper) error {
+		fakes.destroyed = append(fakes.destroyed, s)
+		return nil
+	}
+	p.scrape = func(*ssg.Scrapper, string) (string, error) {
+		return "scraped", fakes.scrapeErr
+	}
+	return p, fakes
+}
+
+func TestScrapperPoolReuse(t *testing.T) {
+	p, fakes := newTestScrapperPool(t, 1, 10)
+
+	first, release := p.acquire(context.Background())
+	release(3)
+	second, release := p.acquire(context.Background())
+	release(3)
+
+	if first == nil || first != second || len(fakes.created) != 1 {
+		t.Errorf("expected the scrapper to be reused, created %d", len(fakes.created))
+	}
+
+	// recycled after max pages
+	third, release := p.acquire(context.Background())
+	release(4)
+	if third != first || len(fakes.destroyed) != 1 {
+		t.Errorf("expected the scrapper to be recycled after max pages, destroyed %d", len(fakes.destroyed))
+	}
+	if fourth, release := p.acquire(context.Background()); fourth == first || len(fakes.created) != 2 {
+		t.Errorf("expected a new scrapper after recycling, created %d", len(fakes.created))
+	} else {
+		release(0)
+	}
+}
+
+func TestScrapperPoolHealthCheck(t *testing.T) {
+	p, fakes := newTestScrapperPool(t, 1, 10)
+
+	first, release := p.acquire(context.Background())
+	release(1)
+
+	// not checked when recently used
+	_, release = p.acquire(context.Background())
+	release(0)
+	if fakes.checked != 0 {
+		t.Errorf("expected no health checks for recently used scrappers, got %d", fakes.checked)
+	}
+
+	// checked after idle, and recycled when unhealthy
+	p.idle[0].lastUsed = time.Now().Add(-2 * scrapperHealthCheckIdle)
+	fakes.checkErr = errors.New("browser has been closed")
+	second, release := p.acquire(context.Background())
+	release(0)
+	if fakes.checked != 1 || second == first || len(fakes.destroyed) != 1 || fakes.destroyed[0] != first {
+		t.Errorf("expected the unhealthy scrapper to be recycled, checked %d, destroyed %d", fakes.checked, len(fakes.destroyed))
+	}
+}
+
+func TestScrapperPoolScrapeFailure(t *testing.T) {
+	p, fakes := newTestScrapperPool(t, 1, 10)
+
+	// kept after successful scrapes
+	first, release := p.acquire(context.Background())
+	if _, err := p.scrapeText(first, "https://example.com/a"); err != nil {
+		t.Fatal(err)
+	}
+	release(1)
+	if len(fakes.destroyed) != 0 {
+		t.Errorf("expected the scrapper to be kept, destroyed %d", len(fakes.destroyed))
+	}
+
+	// recycled on release after a failed scrape
+	fakes.scrapeErr = errors.New("target page, context or browser has been closed")
+	if s, release := p.acquire(context.Background()); s != first {
+		t.Fatal("expected the idle scrapper to be reused")
+	} else {
+		if _, err := p.scrapeText(s, "https://example.com/b"); err == nil {
+			t.Fatal("expected error from a failed scrape, got nil")
+		}
+		release(1)
+	}
+	if len(fakes.destroyed) != 1 || fakes.destroyed[0] != first {
+		t.Errorf("expected the failed scrapper to be recycled on release, destroyed %d", len(fakes.destroyed))
+	}
+
+	second, release := p.acquire(context.Background())
+	release(0)
+	if second == first || len(fakes.created) != 2 || fakes.checked != 0 {
+		t.Errorf("expected a new scrapper without health checks, created %d, checked %d", len(fakes.created), fakes.checked)
+	}
+}
+
+func TestScrapperPoolSize(t *testing.T) {
+	p, _ := newTestScrapperPool(t, 1, 10)
+
+	_, release := p.acquire(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if s, _ := p.acquire(ctx); s != nil {
+		t.Error("expected no scrapper while the pool is full")
+	}
+
+	release(0)
+	if s, release := p.acquire(context.Background()); s == nil {
+		t.Error("expected a scrapper after it was released")
+	} else {
+		release(0)
+	}
+}
+
+func TestScrapperPoolClose(t *testing.T) {
+	p, fakes := newTestScrapperPool(t, 2, 10)
+
+	idle, releaseIdle := p.acquire(context.Background())
+	inUse, releaseInUse := p.acquire(context.Background())
+	releaseIdle(0)
+
+	p.close()
+	if len(fakes.destroyed) != 1 || fakes.destroyed[0] != idle {
+		t.Errorf("expected idle scrappers to be closed, destroyed %d", len(fakes.destroyed))
+	}
+
+	releaseInUse(0)
+	if len(fakes.destroyed) != 2 || fakes.destroyed[1] != inUse {
+		t.Errorf("expected scrappers in use to be closed on release, destroyed %d", len(fakes.destroyed))
+	}
+
+	if s, release := p.acquire(context.Background()); s != nil {
+		t.Error("expected no scrapper from a closed pool")
+	} else {
+		release(0)
+	}
+}
+
+func TestScrapperPoolHealthCheckPage(t *testing.T) {
+	p := newScrapperPool(1, 10, nil)
+	defer p.close()
+
+	resp, err := http.Get(p.healthURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), scrapperHealthCheckText) {
+		t.Errorf("unexpected health check page: %s", body)
+	}
+}
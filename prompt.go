@@ -0,0 +1,242 @@
+// prompt.go
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmcdole/gofeed"
+
+	ssg "github.com/meinside/simple-scrapper-go"
+)
+
+const (
+	defaultSummaryLength = "medium"
+	defaultSummaryFormat = "paragraphs"
+
+	promptSummaryTimeout    = 6 * time.Minute  // (same as rss-feeds-go)
+	summaryIntervalDuration = 10 * time.Second // (same as rss-feeds-go)
+
+	attachedDocumentContent = "(in the attached pdf document)" // content in prompts of items summarized with their pdf documents
+
+	defaultSummaryPromptTemplate = `Summarize the following content in {{.Language}} language, {{.Length}}, {{.Format}}.
+Also translate its title into the same language, referring to the summarized content.
+If the content implies an error such as network or permission issues, do not translate the title and keep it as is.
+
+Title: {{.Title}}
+URL: {{.URL}}
+
+<content>
+{{.Content}}
+</content>`
+)
+
+// instructions for lengths of summaries
+var _summaryLengths = map[string]string{
+	"short":  "in 2 or 3 sentences",
+	"medium": "in about 150 words",
+	"long":   "in about 400 words, covering all the key points",
+}
+
+// instructions for formats of summaries
+var _summaryFormats = map[string]string{
+	"paragraphs":    "as plain paragraphs",
+	"bullet_points": "as a markdown list of bullet points",
+	"tldr":          "as a one-line TL;DR followed by a short paragraph of details",
+	"key_numbers":   "as a markdown list of the key numbers (figures, amounts, dates, and so on) in it, each with a short explanation",
+}
+
+// summaryPromptData struct (fields of summary prompt templates)
+type summaryPromptData struct {
+	Title    string
+	URL      string
+	Content  string
+	Language string
+	Length   string
+	Format   string
+}
+
+// summaryPrompt struct (a parsed summary prompt of a feed)
+type summaryPrompt struct {
+	tmpl   *template.Template
+	length string
+	format string
+}
+
+// parse and validate given summary prompt config
+func newSummaryPrompt(conf configSummaryPrompt) (*summaryPrompt, error) {
+	length, format := defaultSummaryLength, defaultSummaryFormat
+	if conf.Length != "" {
+		length = conf.Length
+	}
+	if conf.Format != "" {
+		format = conf.Format
+	}
+	if _, exists := _summaryLengths[length]; !exists {
+		return nil, fmt.Errorf("unknown length '%s' (should be one of: %s)", length, strings.Join(sortedKeys(_summaryLengths), ", "))
+	}
+	if _, exists := _summaryFormats[format]; !exists {
+		return nil, fmt.Errorf("unknown format '%s' (should be one of: %s)", format, strings.Join(sortedKeys(_summaryFormats), ", "))
+	}
+
+	text := defaultSummaryPromptTemplate
+	if conf.Template != nil {
+		text = *conf.Template
+	}
+	tmpl, err := template.New("summary_prompt").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &summaryPrompt{
+		tmpl:   tmpl,
+		length: length,
+		format: format,
+	}
+
+	// (unknown fields are only caught on execution)
+	const marker = "(content of the item)"
+	rendered, err := p.render("title", "https://example.com", marker, defaultDesiredLanguage)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(rendered, marker) {
+		return nil, fmt.Errorf("template does not include {{.Content}}")
+	}
+
+	return p, nil
+}
+
+// render the prompt with given values
+func (p *summaryPrompt) render(title, url, content, language string) (string, error) {
+	var sb strings.Builder
+	if err := p.tmpl.Execute(&sb, summaryPromptData{
+		Title:    title,
+		URL:      url,
+		Content:  content,
+		Language: language,
+		Length:   _summaryLengths[p.length],
+		Format:   _summaryFormats[p.format],
+	}); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// get sorted keys of given map
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// get the text content of given item for summarizing with a custom prompt
+//
+// already scraped (or combined with similar items), scraped with `scrapper` if it is not nil, or extracted over plain http,
+// falling back to the description of the item.
+// pdf documents are returned as they are in `document` when the summarizer of the feed reads them by itself (Google Gemini API).
+func contentTextOf(ctx context.Context, f *feed, item *gofeed.Item, scrapper *ssg.Scrapper, maxTextBytes int) (text string, document []byte, err error) {
+	if text = scrapedTextOf(item); text != "" {
+		return truncateText(text, maxTextBytes), nil, nil
+	}
+
+	_, readsPDF := f.summarizer.(*geminiSummarizer)
+
+	if scrapper != nil {
+		if text, _, document, err = fetchContentText(ctx, f.polite, item.Link, false, !readsPDF, maxTextBytes); err != nil { // (non-html contents)
+			if text, err = f.scrappers.scrapeText(scrapper, item.Link); err == nil {
+				text = truncateText(text, maxTextBytes)
+			}
+		}
+	} else {
+		text, _, document, err = fetchContentText(ctx, f.polite, item.Link, true, !readsPDF, maxTextBytes)
+	}
+	if document != nil {
+		return "", document, nil
+	}
+
+	if err != nil || strings.TrimSpace(text) == "" {
+		if doc, e := goquery.NewDocumentFromReader(strings.NewReader(item.Description)); e == nil {
+			if description := strings.TrimSpace(doc.Text()); description != "" {
+				return truncateText(description, maxTextBytes), nil, nil
+			}
+		}
+		if err == nil {
+			err = fmt.Errorf("no content")
+		}
+		return "", nil, err
+	}
+
+	return text, nil, nil
+}
+
+// summarize given item with the custom prompt of feed `f` (and tag it, if configured)
+func summarizeItemWithPrompt(ctx context.Context, f *feed, item *gofeed.Item, scrapper *ssg.Scrapper, conf config) (model, title, summary string, tags []string, err error) {
+	var content string
+	var document []byte
+	if content, document, err = contentTextOf(ctx, f, item, scrapper, conf.MaxExtractedTextBytes); err != nil {
+		return "", "", "", nil, fmt.Errorf("failed to fetch content: %w", err)
+	}
+
+	if conf.Verbose {
+		log.Printf(">>> summarizing '%s' with a custom prompt.", item.Link)
+	}
+
+	return generateSummary(ctx, f, f.summarizer, item, content, document, conf)
+}
+
+// generate the summary of given item with its `content` (or pdf `document`), the prompt of feed `f`, and summarizer `s`
+// (and tag it, if configured)
+//
+// a trailing line with the name of the used model is appended to the summary (same as rss-feeds-go).
+func generateSummary(ctx context.Context, f *feed, s summarizer, item *gofeed.Item, content string, document []byte, conf config) (model, title, summary string, tags []string, err error) {
+	if document != nil {
+		content = attachedDocumentContent
+	}
+
+	var prompt string
+	if prompt, err = f.prompt.render(item.Title, item.Link, content, *conf.DesiredLanguage); err != nil {
+		return "", "", "", nil, fmt.Errorf("failed to render prompt: %w", err)
+	}
+
+	var tagging *tagging
+	if f.tagging != nil {
+		tagging = f.tagging
+		prompt += "\n\n" + tagging.instruction()
+	}
+
+	if model, title, summary, tags, err = s.generate(ctx, summaryRequest{
+		title:    item.Title,
+		url:      item.Link,
+		content:  content,
+		prompt:   prompt,
+		document: document,
+		tagging:  tagging,
+	}); err != nil {
+		return model, "", "", nil, err
+	}
+
+	if title == "" {
+		title = item.Title
+	}
+	if summary == "" {
+		summary = "Summarized content was empty."
+	}
+	summary = fmt.Sprintf(
+		"%s\n\n(summarized with **%s**, %s)",
+		summary,
+		model,
+		time.Now().Format("2006-01-02 15:04:05 (Mon) MST"),
+	)
+	return model, title, summary, tags, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestSummaryPrompt_Render(t *testing.T) {
+	tests := []struct {
+		conf     configSummaryPrompt
+		want     []string
+		unwanted []string
+	}{
+		{
+			conf: configSummaryPrompt{},
+			want: []string{"in Korean language", _summaryLengths[defaultSummaryLength], _summaryFormats[defaultSummaryFormat], "Title: Hello", "URL: https://example.com/hello", "<content>\nBody text\n</content>"},
+		},
+		{
+			conf: configSummaryPrompt{Length: "short", Format: "tldr"},
+			want: []string{_summaryLengths["short"], _summaryFormats["tldr"]},
+		},
+		{
+			conf:     configSummaryPrompt{Template: new("{{.Title}} ({{.Language}}) / {{.Format}}\n{{.Content}}"), Format: "key_numbers"},
+			want:     []string{"Hello (Korean) / " + _summaryFormats["key_numbers"] + "\nBody text"},
+			unwanted: []string{"URL:"},
+		},
+	}
+
+	for _, tt := range tests {
+		p, err := newSummaryPrompt(tt.conf)
+		if err != nil {
+			t.Errorf("failed to parse summary prompt %+v: %s", tt.conf, err)
+			continue
+		}
+		rendered, err := p.render("Hello", "https://example.com/hello", "Body text", "Korean")
+		if err != nil {
+			t.Errorf("failed to render summary prompt %+v: %s", tt.conf, err)
+			continue
+		}
+		for _, expected := range tt.want {
+			if !strings.Contains(rendered, expected) {
+				t.Errorf("expected '%s' in rendered prompt, got: %q", expected, rendered)
+			}
+		}
+		for _, unexpected := range tt.unwanted {
+			if strings.Contains(rendered, unexpected) {
+				t.Errorf("unexpected '%s' in rendered prompt, got: %q", unexpected, rendered)
+			}
+		}
+	}
+}
+
+func TestContentTextOf(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/article" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = io.WriteString(w, testArticleHTML)
+	}))
+	defer server.Close()
+
+	f := &feed{}
+
+	// readable text over plain http
+	if text, _, err := contentTextOf(context.Background(), f, &gofeed.Item{Link: server.URL + "/article"}, nil, 0); err != nil || !strings.Contains(text, "Headline") {
+		t.Errorf("unexpected content text: %q (%v)", text, err)
+	}
+
+	// description as a fallback, truncated
+	if text, _, err := contentTextOf(context.Background(), f, &gofeed.Item{Link: server.URL + "/missing", Description: "<p>Some <b>description</b></p>"}, nil, 4); err != nil || !strings.HasPrefix(text, "Some\n") {
+		t.Errorf("unexpected content text: %q (%v)", text, err)
+	}
+
+	// no content at all
+	if _, _, err := contentTextOf(context.Background(), f, &gofeed.Item{Link: server.URL + "/missing"}, nil, 0); err == nil {
+		t.Error("expected error for an item without any content, got nil")
+	}
+}
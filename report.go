@@ -0,0 +1,326 @@
+// report.go
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	rf "github.com/meinside/rss-feeds-go"
+)
+
+const (
+	adminUsageServePath = adminServePathPrefix + "usage"
+
+	usageReportCommand = "report"
+
+	usageReportPeriodDaily   = "daily"
+	usageReportPeriodMonthly = "monthly"
+)
+
+// usageReportOptions struct
+//
+// (usages are saved daily, so `Since` and `Until` are rounded to the (local) days which contain them)
+type usageReportOptions struct {
+	Period string     `json:"period"`          // "daily" or "monthly"
+	Since  *time.Time `json:"since,omitempty"` // at or after
+	Until  *time.Time `json:"until,omitempty"` // before (the day of a timestamp is included)
+	Feed   string     `json:"feed,omitempty"`  // all feeds if empty
+}
+
+// usageReportRow struct (usage of a model by a feed in a period)
+type usageReportRow struct {
+	Period string `json:"period"` // YYYY-MM-DD or YYYY-MM
+	Feed   string `json:"feed"`
+	Model  string `json:"model"`
+
+	usageCounts
+
+	Cost *float64 `json:"cost,omitempty"` // nil if the price of the model is unknown
+}
+
+// usageReportTotal struct (usage of all feeds and models in a period)
+type usageReportTotal struct {
+	Period string `json:"period"`
+
+	usageCounts
+
+	Cost float64 `json:"cost"` // (of models with known prices only)
+}
+
+// usageReport struct
+type usageReport struct {
+	Options        usageReportOptions `json:"options"`
+	Rows           []usageReportRow   `json:"rows"`
+	Totals         []usageReportTotal `json:"totals"`
+	TotalCost      float64            `json:"total_cost"`
+	UnpricedModels []string           `json:"unpriced_models,omitempty"`
+}
+
+// usageTotal struct (a row of summed usages)
+type usageTotal struct {
+	Period       string
+	Model        string
+	Requests     int64
+	InputTokens  int64
+	OutputTokens int64
+	Errors       int64
+	QuotaErrors  int64
+}
+
+// namedStore struct (a feed store with the name of its feed)
+type namedStore struct {
+	name  string
+	store *feedStore
+}
+
+// sum usages of the store for each period and model which match given options
+func (s *feedStore) usageTotals(opts usageReportOptions) (totals []usageTotal, err error) {
+	period := "day"
+	if opts.Period == usageReportPeriodMonthly {
+		period = "substr(day, 1, 7)"
+	}
+
+	tx := s.db.Model(&apiUsage{}).
+		Select(period + " AS period, model, sum(requests) AS requests, sum(input_tokens) AS input_tokens, sum(output_tokens) AS output_tokens, sum(errors) AS errors, sum(quota_errors) AS quota_errors").
+		Group("period, model").
+		Order("period ASC, model ASC")
+	if opts.Since != nil {
+		tx = tx.Where("day >= ?", usageDayOf(*opts.Since))
+	}
+	if opts.Until != nil {
+		tx = tx.Where("day < ?", usageDayOf(opts.Until.Add(-time.Nanosecond).AddDate(0, 0, 1)))
+	}
+
+	if err = tx.Scan(&totals).Error; err != nil {
+		return nil, fmt.Errorf("failed to sum usages: %w", err)
+	}
+	return totals, nil
+}
+
+// get the price of given model (exactly matched, or the longest one which is a prefix of it)
+func priceOf(prices map[string]configModelPrice, model string) (price configModelPrice, exists bool) {
+	if price, exists = prices[model]; exists {
+		return price, true
+	}
+	matched := ""
+	for name, p := range prices {
+		if strings.HasPrefix(model, name) && len(name) > len(matched) {
+			matched, price, exists = name, p, true
+		}
+	}
+	return price, exists
+}
+
+// calculate the cost of given counts with `price` (per million tokens)
+func costOf(price configModelPrice, counts usageCounts) float64 {
+	cost := float64(counts.InputTokens)*price.InputPerMillionTokens/1_000_000 +
+		float64(counts.OutputTokens)*price.OutputPerMillionTokens/1_000_000
+	return math.Round(cost*1_000_000) / 1_000_000
+}
+
+// build the usage report of given stores with `prices` of models
+func buildUsageReport(stores []namedStore, opts usageReportOptions, prices map[string]configModelPrice) (report usageReport, err error) {
+	report = usageReport{
+		Options: opts,
+		Rows:    []usageReportRow{},
+		Totals:  []usageReportTotal{},
+	}
+
+	totals := map[string]*usageReportTotal{}
+	for _, s := range stores {
+		if opts.Feed != "" && s.name != opts.Feed {
+			continue
+		}
+
+		var sums []usageTotal
+		if sums, err = s.store.usageTotals(opts); err != nil {
+			return report, fmt.Errorf("failed to report usages of '%s': %w", s.name, err)
+		}
+		for _, sum := range sums {
+			row := usageReportRow{
+				Period: sum.Period,
+				Feed:   s.name,
+				Model:  sum.Model,
+				usageCounts: usageCounts{
+					Requests:     sum.Requests,
+					InputTokens:  sum.InputTokens,
+					OutputTokens: sum.OutputTokens,
+					Errors:       sum.Errors,
+					QuotaErrors:  sum.QuotaErrors,
+				},
+			}
+
+			total, exists := totals[row.Period]
+			if !exists {
+				total = &usageReportTotal{Period: row.Period}
+				totals[row.Period] = total
+			}
+			total.add(row.usageCounts)
+
+			if price, exists := priceOf(prices, row.Model); exists {
+				cost := costOf(price, row.usageCounts)
+				row.Cost = &cost
+				total.Cost += cost
+				report.TotalCost += cost
+			} else if !slices.Contains(report.UnpricedModels, row.Model) {
+				report.UnpricedModels = append(report.UnpricedModels, row.Model)
+			}
+
+			report.Rows = append(report.Rows, row)
+		}
+	}
+
+	// (sort rows and totals by their periods)
+	slices.SortStableFunc(report.Rows, func(a, b usageReportRow) int {
+		return strings.Compare(a.Period, b.Period)
+	})
+	for _, total := range totals {
+		total.Cost = math.Round(total.Cost*1_000_000) / 1_000_000
+		report.Totals = append(report.Totals, *total)
+	}
+	slices.SortFunc(report.Totals, func(a, b usageReportTotal) int {
+		return strings.Compare(a.Period, b.Period)
+	})
+	report.TotalCost = math.Round(report.TotalCost*1_000_000) / 1_000_000
+	slices.Sort(report.UnpricedModels)
+
+	return report, nil
+}
+
+// get the (local) day of given time for summing usages
+func usageDayOf(t time.Time) string {
+	return t.In(time.Local).Format(usageDayFormat)
+}
+
+// parse options of usage reports
+func parseUsageReportOptions(period, since, until, feedName string) (opts usageReportOptions, err error) {
+	opts = usageReportOptions{
+		Period: period,
+		Feed:   feedName,
+	}
+	if opts.Period == "" {
+		opts.Period = usageReportPeriodDaily
+	}
+	if opts.Period != usageReportPeriodDaily && opts.Period != usageReportPeriodMonthly {
+		return opts, fmt.Errorf("invalid period '%s' (should be one of: %s, %s)", period, usageReportPeriodDaily, usageReportPeriodMonthly)
+	}
+	if opts.Since, err = parseResummarizeDate(since, false); err != nil {
+		return opts, err
+	}
+	if opts.Until, err = parseResummarizeDate(until, true); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// run `report` subcommand with given `args`
+func runUsageReport(cmd string, args []string, output io.Writer) error {
+	flags := flag.NewFlagSet(usageReportCommand, flag.ContinueOnError)
+	flags.SetOutput(output)
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(output, "Usage: %s %s CONFIG_FILEPATH [OPTIONS]\n", cmd, usageReportCommand)
+		flags.PrintDefaults()
+	}
+
+	period := flags.String("period", usageReportPeriodDaily, "sum usages for each day or month ("+usageReportPeriodDaily+" or "+usageReportPeriodMonthly+")")
+	since := flags.String("since", "", "report usages on or after this date (YYYY-MM-DD or RFC3339)")
+	until := flags.String("until", "", "report usages on or before this date (YYYY-MM-DD or RFC3339)")
+	feedName := flags.String("feed", "", "report usages of this feed only")
+
+	if len(args) < 1 {
+		flags.Usage()
+		return fmt.Errorf("config filepath is required")
+	}
+	configFilepath := args[0]
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	opts, err := parseUsageReportOptions(*period, *since, *until, *feedName)
+	if err != nil {
+		return err
+	}
+
+	conf, err := readConfig(configFilepath)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	if opts.Feed != "" && !slices.ContainsFunc(conf.RSSFeeds, func(feedConfig configRSSFeed) bool {
+		return feedConfig.Name == opts.Feed
+	}) {
+		return fmt.Errorf("no such feed: '%s'", opts.Feed)
+	}
+
+	// (open stores of feeds only, without clients)
+	stores := []namedStore{}
+	for _, feedConfig := range conf.RSSFeeds {
+		if opts.Feed != "" && feedConfig.Name != opts.Feed {
+			continue
+		}
+		store, err := openFeedStore(filepath.Join(conf.DBFilesDirectory, feedConfig.CacheFilename))
+		if err != nil {
+			return err
+		}
+		defer func() { _ = store.close() }()
+
+		stores = append(stores, namedStore{name: feedConfig.Name, store: store})
+	}
+
+	report, err := buildUsageReport(stores, opts, conf.ModelPrices)
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintln(output, rf.Prettify(report))
+
+	return nil
+}
+
+// handle http requests for usage reports of feeds
+//
+// `period`("daily" or "monthly"), `since`, `until`, and `feed` are the options.
+func handleUsageReport(conf config, feeds []*feed) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !adminRequestPermitted(r, conf) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		opts, err := parseUsageReportOptions(query.Get("period"), query.Get("since"), query.Get("until"), query.Get("feed"))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		if opts.Feed != "" && !slices.ContainsFunc(feeds, func(f *feed) bool {
+			return f.conf.Name == opts.Feed
+		}) {
+			writeJSONError(w, http.StatusNotFound, fmt.Errorf("no such feed: '%s'", opts.Feed))
+			return
+		}
+
+		stores := []namedStore{}
+		for _, f := range feeds {
+			stores = append(stores, namedStore{name: f.conf.Name, store: f.store})
+		}
+
+		report, err := buildUsageReport(stores, opts, conf.ModelPrices)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// save given usages in the store
+func addTestUsages(t *testing.T, store *feedStore, usages ...apiUsage) {
+	t.Helper()
+
+	for _, u := range usages {
+		if err := store.addUsage(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPriceOf(t *testing.T) {
+	prices := map[string]configModelPrice{
+		"gemini-3-flash":         {InputPerMillionTokens: 0.5, OutputPerMillionTokens: 3},
+		"gemini-3-flash-preview": {InputPerMillionTokens: 0.4, OutputPerMillionTokens: 2},
+		"gemini":                 {InputPerMillionTokens: 1, OutputPerMillionTokens: 1},
+	}
+
+	tests := []struct {
+		model      string
+		wantInput  float64
+		wantExists bool
+	}{
+		{model: "gemini-3-flash-preview", wantInput: 0.4, wantExists: true},
+		{model: "gemini-3-flash-lite", wantInput: 0.5, wantExists: true},
+		{model: "gemini-2.5-pro", wantInput: 1, wantExists: true},
+		{model: "gpt-4o", wantExists: false},
+	}
+
+	for _, tt := range tests {
+		if price, exists := priceOf(prices, tt.model); exists != tt.wantExists || price.InputPerMillionTokens != tt.wantInput {
+			t.Errorf("priceOf(%s) = %+v, %v, want input %v, %v", tt.model, price, exists, tt.wantInput, tt.wantExists)
+		}
+	}
+}
+
+func TestBuildUsageReport(t *testing.T) {
+	_, store1 := newTestFeedStore(t)
+	_, store2 := newTestFeedStore(t)
+
+	addTestUsages(t, store1,
+		apiUsage{Day: "2026-01-30", KeyID: "k1", Model: "model-a", Requests: 2, InputTokens: 1_000_000, OutputTokens: 100_000},
+		apiUsage{Day: "2026-01-30", KeyID: "k2", Model: "model-a", Requests: 1, InputTokens: 1_000_000, Errors: 1, QuotaErrors: 1},
+		apiUsage{Day: "2026-02-01", KeyID: "k1", Model: "model-b", Requests: 1, InputTokens: 500},
+	)
+	addTestUsages(t, store2,
+		apiUsage{Day: "2026-01-31", KeyID: "k1", Model: "model-a", Requests: 1, InputTokens: 500_000, OutputTokens: 500_000},
+	)
+	stores := []namedStore{{name: "feed1", store: store1}, {name: "feed2", store: store2}}
+	prices := map[string]configModelPrice{
+		"model-a": {InputPerMillionTokens: 1, OutputPerMillionTokens: 10},
+	}
+
+	// daily
+	opts, err := parseUsageReportOptions("", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := buildUsageReport(stores, opts, prices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Rows) != 3 || len(report.Totals) != 3 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if row := report.Rows[0]; row.Period != "2026-01-30" || row.Feed != "feed1" || row.Requests != 3 || row.QuotaErrors != 1 || row.Cost == nil || *row.Cost != 3 {
+		t.Errorf("unexpected first row: %+v", row)
+	}
+	if row := report.Rows[2]; row.Model != "model-b" || row.Cost != nil {
+		t.Errorf("unexpected last row: %+v", row)
+	}
+	if report.TotalCost != 8.5 || !slices.Equal(report.UnpricedModels, []string{"model-b"}) {
+		t.Errorf("unexpected total cost or unpriced models: %v, %v", report.TotalCost, report.UnpricedModels)
+	}
+
+	// monthly, of a feed
+	if opts, err = parseUsageReportOptions(usageReportPeriodMonthly, "", "", "feed1"); err != nil {
+		t.Fatal(err)
+	}
+	if report, err = buildUsageReport(stores, opts, prices); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Totals) != 2 || report.Totals[0].Period != "2026-01" || report.Totals[0].InputTokens != 2_000_000 || report.Totals[0].Cost != 3 {
+		t.Errorf("unexpected monthly totals: %+v", report.Totals)
+	}
+
+	// in a range (inclusive)
+	if opts, err = parseUsageReportOptions("", "2026-01-31", "2026-01-31", ""); err != nil {
+		t.Fatal(err)
+	}
+	if report, err = buildUsageReport(stores, opts, prices); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Rows) != 1 || report.Rows[0].Feed != "feed2" || report.TotalCost != 5.5 {
+		t.Errorf("unexpected report in a range: %+v", report)
+	}
+
+	// in a range of timestamps (the days which contain them)
+	noon := time.Date(2026, 1, 31, 12, 0, 0, 0, time.Local).Format(time.RFC3339)
+	if opts, err = parseUsageReportOptions("", noon, noon, ""); err != nil {
+		t.Fatal(err)
+	}
+	if report, err = buildUsageReport(stores, opts, prices); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Rows) != 1 || report.Rows[0].Period != "2026-01-31" {
+		t.Errorf("unexpected report in a range of timestamps: %+v", report)
+	}
+
+	// invalid options
+	if _, err := parseUsageReportOptions("weekly", "", "", ""); err == nil {
+		t.Error("expected error for an invalid period, got nil")
+	}
+	if _, err := parseUsageReportOptions("", "yesterday", "", ""); err == nil {
+		t.Error("expected error for an invalid date, got nil")
+	}
+}
+
+func TestHandleUsageReport(t *testing.T) {
+	client, store := newTestFeedStore(t)
+	addTestUsages(t, store, apiUsage{Day: "2026-03-01", KeyID: "k1", Model: "model-a", Requests: 1, InputTokens: 10, OutputTokens: 20})
+
+	f := &feed{
+		conf:   configRSSFeed{Name: "test"},
+		client: client,
+		store:  store,
+	}
+	conf := config{AdminToken: new("secret")}
+	handler := handleUsageReport(conf, []*feed{f})
+
+	request := func(target, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	if w := request(adminUsageServePath, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected %d without token, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := request(adminUsageServePath+"?period=yearly", "secret"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected %d for bad period, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := request(adminUsageServePath+"?feed=unknown", "secret"); w.Code != http.StatusNotFound {
+		t.Errorf("expected %d for unknown feed, got %d", http.StatusNotFound, w.Code)
+	}
+
+	w := request(adminUsageServePath+"?period=monthly", "secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, w.Code)
+	}
+	var res struct {
+		Rows []map[string]any `json:"rows"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rows) != 1 || res.Rows[0]["period"] != "2026-03" || res.Rows[0]["output_tokens"] != float64(20) {
+		t.Errorf("unexpected report: %s", w.Body.String())
+	}
+}
+
+func TestRunUsageReport_InvalidArgs(t *testing.T) {
+	var output bytes.Buffer
+
+	if err := runUsageReport("cmd", nil, &output); err == nil {
+		t.Error("expected error for missing arguments, got nil")
+	}
+	if !strings.Contains(output.String(), "Usage") {
+		t.Errorf("expected usage to be printed, got %s", output.String())
+	}
+
+	path := writeTestConfig(t, validConfig)
+	if err := runUsageReport("cmd", []string{path, "-feed", "no-such-feed"}, &output); err == nil || !strings.Contains(err.Error(), "no such feed") {
+		t.Errorf("expected error for unknown feed, got %v", err)
+	}
+	if err := runUsageReport("cmd", []string{path, "-period", "hourly"}, &output); err == nil {
+		t.Error("expected error for invalid period, got nil")
+	}
+}
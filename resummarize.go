@@ -0,0 +1,383 @@
+// resummarize.go
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	rf "github.com/meinside/rss-feeds-go"
+)
+
+const (
+	adminServePathPrefix      = "/admin/"
+	adminResummarizeServePath = adminServePathPrefix + "resummarize"
+
+	resummarizeCommand    = "resummarize"
+	resummarizeDateLayout = "2006-01-02"
+)
+
+// resummarizeOptions struct
+type resummarizeOptions struct {
+	FailedOnly bool       `json:"failed_only,omitempty"`
+	Since      *time.Time `json:"since,omitempty"` // cached at or after
+	Until      *time.Time `json:"until,omitempty"` // cached before
+	GUIDs      []string   `json:"guids,omitempty"`
+	DryRun     bool       `json:"dry_run,omitempty"`
+}
+
+// resummarizeResult struct
+type resummarizeResult struct {
+	Feed        string `json:"feed"`
+	DryRun      bool   `json:"dry_run"`
+	NumItems    int    `json:"num_items"`
+	NumAPICalls int    `json:"num_api_calls"` // number of API calls made (or estimated from the config of the feed, for dry runs)
+	NumFailed   int    `json:"num_failed"`
+	NumDeferred int    `json:"num_deferred,omitempty"` // (not re-summarized for now, eg. over budgets)
+}
+
+// list cached items which match given options for re-summarizing
+func (s *feedStore) resummarizeTargets(opts resummarizeOptions) (items []rf.CachedItem, err error) {
+	tx := s.db.Model(&rf.CachedItem{}).Order("created_at ASC")
+	if opts.FailedOnly {
+		tx = tx.Where("instr(summary, ?) > 0", rf.ErrorPrefixSummaryFailedWithError)
+	}
+	if opts.Since != nil {
+		tx = tx.Where("created_at >= ?", *opts.Since)
+	}
+	if opts.Until != nil {
+		tx = tx.Where("created_at < ?", *opts.Until)
+	}
+	if len(opts.GUIDs) > 0 {
+		tx = tx.Where("guid IN ?", opts.GUIDs)
+	}
+
+	if err = tx.Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to list items for re-summarizing: %w", err)
+	}
+	return items, nil
+}
+
+// fetch cached items with given `guids`
+func (s *feedStore) cachedItemsOf(guids []string) (items []rf.CachedItem, err error) {
+	if len(guids) == 0 {
+		return nil, nil
+	}
+	err = s.db.Where("guid IN ?", guids).Find(&items).Error
+	return items, err
+}
+
+// estimate the number of API calls for re-summarizing given cached item of feed `f` (without fallbacks or retries)
+//
+// counts a generation of its summary, and (when configured) generation of its tags (for feeds summarized with rss-feeds-go),
+// translation of its title, and a generation of its discussion's summary (for items of supported discussion sites).
+func estimatedAPICallsOf(f *feed, item rf.CachedItem) (calls int) {
+	_, extractive := f.summarizer.(*extractiveSummarizer)
+	if !extractive {
+		calls++ // (summary)
+	}
+	if f.summarizer == nil && f.tagging != nil {
+		calls++ // (tags)
+	}
+	if f.translator != nil {
+		calls++ // (title)
+	}
+	if f.conf.SummarizeDiscussions != nil && !extractive {
+		if _, _, err := discussionSourceOf(discussionLinkOf(feedItemOf(item))); err == nil {
+			calls++ // (discussion)
+		}
+	}
+	return calls
+}
+
+// re-summarize cached items of given feed which match `opts`
+//
+// items are scraped and summarized in the same way as `processFeedTick` (not concurrently with its ticks).
+func resummarize(ctx context.Context, f *feed, opts resummarizeOptions, conf config) (result resummarizeResult, err error) {
+	result = resummarizeResult{
+		Feed:   f.conf.Name,
+		DryRun: opts.DryRun,
+	}
+
+	if opts.DryRun {
+		var targets []rf.CachedItem
+		if targets, err = f.store.resummarizeTargets(opts); err != nil {
+			return result, err
+		}
+		result.NumItems = len(targets)
+		for _, target := range targets {
+			result.NumAPICalls += estimatedAPICallsOf(f, target)
+		}
+		return result, nil
+	}
+
+	f.tick.Lock()
+	defer f.tick.Unlock()
+
+	var targets []rf.CachedItem
+	if targets, err = f.store.resummarizeTargets(opts); err != nil {
+		return result, err
+	}
+	result.NumItems = len(targets)
+	if len(targets) == 0 {
+		return result, nil
+	}
+
+	// (count api calls which are actually made)
+	var calls atomic.Int64
+	ctx = withAPICallCounter(ctx, &calls)
+	defer func() { result.NumAPICalls = int(calls.Load()) }()
+
+	items := []*gofeed.Item{}
+	guids := []string{}
+	for _, target := range targets {
+		items = append(items, feedItemOf(target))
+		guids = append(guids, target.GUID)
+	}
+
+	if conf.Verbose {
+		log.Printf(">>> re-summarizing %d item(s) of '%s'.", len(items), f.conf.Name)
+	}
+
+	// (scrap +) summarize, and cache them
+	scrapper, release := f.scrappers.acquire(ctx)
+	deferred, err := summarizeAndCache(ctx, f, []gofeed.Feed{{Items: items}}, scrapper, conf)
+	if err != nil {
+		log.Printf("# re-summarizing failed: %s", err)
+	}
+	release(len(items))
+	result.NumDeferred = len(deferred)
+
+	// reset retries of them,
+	if err = f.store.resetRetries(guids); err != nil {
+		return result, fmt.Errorf("failed to reset retries of re-summarized items: %w", err)
+	}
+
+	// count failed ones (re-summarized ones are re-indexed when saved)
+	var resummarized []rf.CachedItem
+	if resummarized, err = f.store.cachedItemsOf(guids); err != nil {
+		return result, fmt.Errorf("failed to fetch re-summarized items: %w", err)
+	}
+	for _, item := range resummarized {
+		if isFailedSummary(item.Summary) {
+			result.NumFailed++
+		}
+	}
+
+	return result, nil
+}
+
+// parse a date (or RFC3339 timestamp) for re-summarizing options
+//
+// `endOfDay` extends a date to the start of its next day (for exclusive upper bounds).
+func parseResummarizeDate(s string, endOfDay bool) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation(resummarizeDateLayout, s, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date '%s' (expected %s or RFC3339)", s, resummarizeDateLayout)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// guidsFlag type for repeatable `-guid` flags
+type guidsFlag []string
+
+// String implements flag.Value
+func (g *guidsFlag) String() string {
+	return fmt.Sprintf("%v", *g)
+}
+
+// Set implements flag.Value
+func (g *guidsFlag) Set(value string) error {
+	*g = append(*g, value)
+	return nil
+}
+
+// run `resummarize` subcommand with given `args`
+func runResummarize(cmd string, args []string, output io.Writer) error {
+	flags := flag.NewFlagSet(resummarizeCommand, flag.ContinueOnError)
+	flags.SetOutput(output)
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(output, "Usage: %s %s CONFIG_FILEPATH FEED_NAME [OPTIONS]\n", cmd, resummarizeCommand)
+		flags.PrintDefaults()
+	}
+
+	failedOnly := flags.Bool("failed-only", false, "re-summarize items with failed summaries only")
+	since := flags.String("since", "", "re-summarize items cached on or after this date (YYYY-MM-DD or RFC3339)")
+	until := flags.String("until", "", "re-summarize items cached on or before this date (YYYY-MM-DD or RFC3339)")
+	dryRun := flags.Bool("dry-run", false, "only report how many items (and API calls) would be re-summarized")
+	var guids guidsFlag
+	flags.Var(&guids, "guid", "re-summarize the item with this GUID (repeatable)")
+
+	if len(args) < 2 {
+		flags.Usage()
+		return fmt.Errorf("config filepath and feed name are required")
+	}
+	configFilepath, feedName := args[0], args[1]
+	if err := flags.Parse(args[2:]); err != nil {
+		return err
+	}
+
+	opts := resummarizeOptions{
+		FailedOnly: *failedOnly,
+		GUIDs:      guids,
+		DryRun:     *dryRun,
+	}
+	var err error
+	if opts.Since, err = parseResummarizeDate(*since, false); err != nil {
+		return err
+	}
+	if opts.Until, err = parseResummarizeDate(*until, true); err != nil {
+		return err
+	}
+
+	conf, err := readConfig(configFilepath)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	idx := slices.IndexFunc(conf.RSSFeeds, func(feedConfig configRSSFeed) bool {
+		return feedConfig.Name == feedName
+	})
+	if idx < 0 {
+		return fmt.Errorf("no such feed: '%s'", feedName)
+	}
+
+	// (account api usages too, for honouring budgets and cooldowns)
+	usage := newUsageAccountant(conf, apiKeysOf(conf))
+
+	f, err := newFeed(conf, conf.RSSFeeds[idx], usage)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.store.close() }()
+
+	// (scrape politely with a pool of scrappers, same as `run`)
+	f.polite = newPoliteness(conf)
+	f.scrappers = newScrapperPool(conf.MaxConcurrentScrapes, conf.ScrapperMaxPages, f.polite)
+	defer f.scrappers.close()
+
+	if err := usage.register(f.conf.Name, f.store); err != nil {
+		log.Printf("# failed to load api usages: %s", err)
+	}
+
+	result, err := resummarize(context.Background(), f, opts, conf)
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintln(output, rf.Prettify(result))
+
+	return nil
+}
+
+// handle http requests for re-summarizing cached items of a feed
+//
+// `feed` is the name of the feed, and `failed_only`, `since`, `until`, `guid`(repeatable), and `dry_run`
+// are the options. Dry runs are answered synchronously, others are started in background with 202.
+func handleResummarize(ctx context.Context, conf config, feeds []*feed) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !adminRequestPermitted(r, conf) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		idx := slices.IndexFunc(feeds, func(f *feed) bool {
+			return f.conf.Name == query.Get("feed")
+		})
+		if idx < 0 {
+			writeJSONError(w, http.StatusNotFound, fmt.Errorf("no such feed: '%s'", query.Get("feed")))
+			return
+		}
+		f := feeds[idx]
+
+		opts := resummarizeOptions{
+			GUIDs: query["guid"],
+		}
+		opts.FailedOnly, _ = strconv.ParseBool(query.Get("failed_only"))
+		opts.DryRun, _ = strconv.ParseBool(query.Get("dry_run"))
+		var err error
+		if opts.Since, err = parseResummarizeDate(query.Get("since"), false); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		if opts.Until, err = parseResummarizeDate(query.Get("until"), true); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if opts.DryRun {
+			result, err := resummarize(ctx, f, opts, conf)
+			if err != nil {
+				writeJSONError(w, http.StatusInternalServerError, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, result)
+			return
+		}
+
+		go func() {
+			if result, err := resummarize(ctx, f, opts, conf); err == nil {
+				log.Printf("> re-summarized items: %s", rf.Prettify(result))
+			} else {
+				log.Printf("# failed to re-summarize items of '%s': %s", f.conf.Name, err)
+			}
+		}()
+		writeJSON(w, http.StatusAccepted, map[string]any{
+			"feed":    f.conf.Name,
+			"options": opts,
+		})
+	}
+}
+
+// check if given http request is permitted for admin endpoints
+func adminRequestPermitted(r *http.Request, conf config) bool {
+	if conf.AdminToken == nil || *conf.AdminToken == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare(
+		[]byte(r.Header.Get("Authorization")),
+		[]byte("Bearer "+*conf.AdminToken),
+	) == 1
+}
+
+// write given value `v` as JSON with `status`
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("# failed to write JSON: %s", err)
+	}
+}
+
+// write given error `err` as JSON with `status`
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	rf "github.com/meinside/rss-feeds-go"
+)
+
+func TestParseResummarizeDate(t *testing.T) {
+	if d, err := parseResummarizeDate("", false); err != nil || d != nil {
+		t.Errorf("expected nil for empty date, got %v (%v)", d, err)
+	}
+
+	since, err := parseResummarizeDate("2026-01-02", false)
+	if err != nil || since.Day() != 2 || since.Hour() != 0 {
+		t.Errorf("unexpected since: %v (%v)", since, err)
+	}
+	until, err := parseResummarizeDate("2026-01-02", true)
+	if err != nil || until.Day() != 3 || until.Hour() != 0 {
+		t.Errorf("unexpected until: %v (%v)", until, err)
+	}
+
+	if d, err := parseResummarizeDate("2026-01-02T03:04:05Z", true); err != nil || d.Hour() != 3 {
+		t.Errorf("unexpected RFC3339 date: %v (%v)", d, err)
+	}
+
+	if _, err := parseResummarizeDate("yesterday", false); err == nil {
+		t.Error("expected error for invalid date, got nil")
+	}
+}
+
+// create a feed with cached items for testing re-summarization
+func newTestResummarizeFeed(t *testing.T) *feed {
+	t.Helper()
+
+	client, store := newTestFeedStore(t)
+
+	now := time.Now()
+	items := []rf.CachedItem{
+		{GUID: "old", Summary: "summary"},
+		{GUID: "failed", Summary: rf.ErrorPrefixSummaryFailedWithError + ": error"},
+		{GUID: "new", Summary: "summary"},
+	}
+	items[0].CreatedAt = now.AddDate(0, 0, -10)
+	items[1].CreatedAt = now.AddDate(0, 0, -5)
+	items[2].CreatedAt = now
+	insertTestCachedItems(t, store, items...)
+
+	return &feed{conf: configRSSFeed{Name: "test"}, client: client, store: store}
+}
+
+func TestResummarizeDryRun(t *testing.T) {
+	f := newTestResummarizeFeed(t)
+
+	since := time.Now().AddDate(0, 0, -7)
+
+	tests := []struct {
+		name string
+		opts resummarizeOptions
+		want int
+	}{
+		{name: "all", opts: resummarizeOptions{}, want: 3},
+		{name: "failed only", opts: resummarizeOptions{FailedOnly: true}, want: 1},
+		{name: "since", opts: resummarizeOptions{Since: &since}, want: 2},
+		{name: "until", opts: resummarizeOptions{Until: &since}, want: 1},
+		{name: "guids", opts: resummarizeOptions{GUIDs: []string{"old", "new", "unknown"}}, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.DryRun = true
+
+			result, err := resummarize(context.Background(), f, tt.opts, config{})
+			if err != nil {
+				t.Fatalf("resummarize() error: %s", err)
+			}
+			if !result.DryRun || result.NumItems != tt.want || result.NumAPICalls != tt.want {
+				t.Errorf("unexpected result: %+v", result)
+			}
+		})
+	}
+}
+
+func TestEstimatedAPICallsOf(t *testing.T) {
+	item := rf.CachedItem{GUID: "https://news.ycombinator.com/item?id=1", Link: "https://example.com/a"}
+	other := rf.CachedItem{GUID: "https://example.com/b", Link: "https://example.com/b"}
+	gemini := newGeminiSummarizer(nil)
+
+	tests := []struct {
+		name string
+		f    *feed
+		item rf.CachedItem
+		want int
+	}{
+		{name: "rss-feeds-go", f: &feed{gemini: gemini}, item: item, want: 1},
+		{name: "tags", f: &feed{gemini: gemini, tagging: newTagging(&configTags{})}, item: item, want: 2},
+		{name: "tags with a prompt", f: &feed{summarizer: gemini, tagging: newTagging(&configTags{})}, item: item, want: 1},
+		{name: "titles", f: &feed{gemini: gemini, translator: gemini}, item: item, want: 2},
+		{name: "discussions", f: &feed{conf: configRSSFeed{SummarizeDiscussions: &configDiscussions{}}, gemini: gemini}, item: item, want: 2},
+		{name: "unsupported discussions", f: &feed{conf: configRSSFeed{SummarizeDiscussions: &configDiscussions{}}, gemini: gemini}, item: other, want: 1},
+		{name: "extractive", f: &feed{conf: configRSSFeed{SummarizeDiscussions: &configDiscussions{}}, summarizer: newExtractiveSummarizer("", "")}, item: item, want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := estimatedAPICallsOf(tt.f, tt.item); got != tt.want {
+			t.Errorf("estimatedAPICallsOf(%s) = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestResummarize_APICalls(t *testing.T) {
+	f := newTestResummarizeFeed(t)
+	insertTestCachedItems(t, f.store, rf.CachedItem{GUID: "described", Title: "Title", Description: "description of the item", Summary: "summary"})
+
+	conf := config{
+		GoogleAIModels:  []string{"model1", "model2"},
+		DesiredLanguage: new("Korean"),
+	}
+	f.usage = newUsageAccountant(conf, []string{"key1"})
+	var err error
+	if f.prompt, err = newSummaryPrompt(configSummaryPrompt{}); err != nil {
+		t.Fatal(err)
+	}
+	server := newTestGeminiServer(t)
+	server.reply("model1", http.StatusOK, `{"candidates": [{"finishReason": "SAFETY"}]}`)
+	f.summarizer = newTestGeminiSummarizer(f.usage, server)
+
+	// (not re-summarized while a tick is being processed)
+	f.tick.Lock()
+	done := make(chan resummarizeResult)
+	go func() {
+		result, err := resummarize(context.Background(), f, resummarizeOptions{GUIDs: []string{"described"}}, conf)
+		if err != nil {
+			t.Errorf("resummarize() error: %s", err)
+		}
+		done <- result
+	}()
+	select {
+	case <-done:
+		t.Fatal("expected to wait for the tick")
+	case <-time.After(100 * time.Millisecond):
+	}
+	f.tick.Unlock()
+
+	// (api calls which were actually made, including the fallback)
+	if result := <-done; result.NumItems != 1 || result.NumAPICalls != 2 || result.NumFailed != 0 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+}
+
+func TestRunResummarize_InvalidArgs(t *testing.T) {
+	var output bytes.Buffer
+
+	if err := runResummarize("cmd", nil, &output); err == nil {
+		t.Error("expected error for missing arguments, got nil")
+	}
+	if !strings.Contains(output.String(), "Usage") {
+		t.Errorf("expected usage to be printed, got %s", output.String())
+	}
+
+	path := writeTestConfig(t, validConfig)
+	if err := runResummarize("cmd", []string{path, "no-such-feed", "-dry-run"}, &output); err == nil || !strings.Contains(err.Error(), "no such feed") {
+		t.Errorf("expected error for unknown feed, got %v", err)
+	}
+	if err := runResummarize("cmd", []string{path, "test", "-since", "yesterday"}, &output); err == nil {
+		t.Error("expected error for invalid date, got nil")
+	}
+}
+
+func TestHandleResummarize(t *testing.T) {
+	f := newTestResummarizeFeed(t)
+	conf := config{AdminToken: new("secret")}
+	handler := handleResummarize(context.Background(), conf, []*feed{f})
+
+	request := func(method, target, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	if w := request(http.MethodPost, "/admin/resummarize?feed=test&dry_run=true", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected %d without token, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := request(http.MethodPost, "/admin/resummarize?feed=test&dry_run=true", "wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected %d with wrong token, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := request(http.MethodGet, "/admin/resummarize?feed=test&dry_run=true", "secret"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected %d for GET, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+	if w := request(http.MethodPost, "/admin/resummarize?feed=unknown&dry_run=true", "secret"); w.Code != http.StatusNotFound {
+		t.Errorf("expected %d for unknown feed, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := request(http.MethodPost, "/admin/resummarize?feed=test&since=bad&dry_run=true", "secret"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected %d for bad date, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w := request(http.MethodPost, "/admin/resummarize?feed=test&failed_only=true&dry_run=true", "secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, w.Code)
+	}
+	var result resummarizeResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Feed != "test" || result.NumItems != 1 || result.NumAPICalls != 1 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	// admin endpoints are disabled without a token
+	disabled := handleResummarize(context.Background(), config{}, []*feed{f})
+	w = httptest.NewRecorder()
+	disabled(w, httptest.NewRequest(http.MethodPost, "/admin/resummarize?feed=test&dry_run=true", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected %d when disabled, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
@@ -0,0 +1,184 @@
+// retry.go
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"gorm.io/gorm"
+
+	rf "github.com/meinside/rss-feeds-go"
+	ssg "github.com/meinside/simple-scrapper-go"
+)
+
+const (
+	maxSummaryRetryBackoff = 24 * time.Hour
+)
+
+// summaryRetry struct (retry state of a cached item with a failed summary)
+type summaryRetry struct {
+	GUID        string `gorm:"primaryKey"`
+	Attempts    int    // number of summary attempts so far (including the first one)
+	NextRetryAt time.Time
+
+	UpdatedAt time.Time
+}
+
+// backoff duration after given number of `attempts`
+func summaryRetryBackoff(interval time.Duration, attempts int) time.Duration {
+	return exponentialBackoff(interval, attempts, maxSummaryRetryBackoff)
+}
+
+// check if given summary is a failed one
+func isFailedSummary(summary string) bool {
+	return strings.Contains(summary, rf.ErrorPrefixSummaryFailedWithError)
+}
+
+// list cached items with failed summaries which are due for retrying at `now`
+//
+// newly found ones are scheduled for their first retries, and ones which reached `maxAttempts` are skipped.
+func (s *feedStore) dueRetries(maxAttempts int, interval time.Duration, now time.Time) (due []rf.CachedItem, err error) {
+	var failed []rf.CachedItem
+	if err = s.db.Where("instr(summary, ?) > 0", rf.ErrorPrefixSummaryFailedWithError).Find(&failed).Error; err != nil {
+		return nil, fmt.Errorf("failed to list items with failed summaries: %w", err)
+	}
+
+	for _, item := range failed {
+		var retry summaryRetry
+		if err = s.db.Where("guid = ?", item.GUID).First(&retry).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, err
+			}
+
+			// schedule the first retry
+			if err = s.db.Create(&summaryRetry{
+				GUID:        item.GUID,
+				Attempts:    1,
+				NextRetryAt: now.Add(summaryRetryBackoff(interval, 1)),
+			}).Error; err != nil {
+				return nil, fmt.Errorf("failed to schedule retry of '%s': %w", item.GUID, err)
+			}
+			continue
+		}
+
+		if retry.Attempts >= maxAttempts || retry.NextRetryAt.After(now) {
+			continue
+		}
+		due = append(due, item)
+	}
+
+	return due, nil
+}
+
+// record results of retried summaries of items with given `guids`
+//
+// returns the items which were summarized successfully.
+func (s *feedStore) recordRetries(guids []string, interval time.Duration, now time.Time) (succeeded []rf.CachedItem, err error) {
+	var errs []error
+	for _, guid := range guids {
+		var item rf.CachedItem
+		if err := s.db.Where("guid = ?", guid).First(&item).Error; err != nil {
+			errs = append(errs, fmt.Errorf("failed to fetch retried item '%s': %w", guid, err))
+			continue
+		}
+
+		if isFailedSummary(item.Summary) {
+			var retry summaryRetry
+			if err := s.db.Where("guid = ?", guid).First(&retry).Error; err != nil {
+				errs = append(errs, fmt.Errorf("failed to fetch retry of '%s': %w", guid, err))
+				continue
+			}
+			retry.Attempts++
+			retry.NextRetryAt = now.Add(summaryRetryBackoff(interval, retry.Attempts))
+			if err := s.db.Save(&retry).Error; err != nil {
+				errs = append(errs, fmt.Errorf("failed to save retry of '%s': %w", guid, err))
+			}
+		} else {
+			if err := s.db.Where("guid = ?", guid).Delete(&summaryRetry{}).Error; err != nil {
+				errs = append(errs, fmt.Errorf("failed to delete retry of '%s': %w", guid, err))
+			}
+			succeeded = append(succeeded, item)
+		}
+	}
+	return succeeded, errors.Join(errs...)
+}
+
+// reset retries of items with given `guids` (failed ones will be scheduled again)
+func (s *feedStore) resetRetries(guids []string) error {
+	if len(guids) == 0 {
+		return nil
+	}
+	return s.db.Where("guid IN ?", guids).Delete(&summaryRetry{}).Error
+}
+
+// delete retries of items which were deleted from the cache
+func (s *feedStore) pruneRetries() error {
+	return s.db.Where("guid NOT IN (SELECT guid FROM cached_items)").Delete(&summaryRetry{}).Error
+}
+
+// convert given cached item back to a feed item for summarizing it again
+func feedItemOf(item rf.CachedItem) *gofeed.Item {
+	converted := &gofeed.Item{
+		Title:       item.Title,
+		Link:        item.Link,
+		GUID:        item.GUID,
+		Description: item.Description,
+	}
+	if item.Link != "" {
+		converted.Links = []string{item.Link}
+		if item.Comments != "" {
+			converted.Links = append(converted.Links, item.Comments)
+		}
+	}
+	if item.Author != "" {
+		converted.Author = &gofeed.Person{Name: item.Author}
+	}
+	if published, err := time.Parse(time.RFC3339, item.PublishDate); err == nil {
+		converted.PublishedParsed = &published
+	}
+	return converted
+}
+
+// summarize given items with failed summaries again, and record the results
+func retryFailedSummaries(ctx context.Context, f *feed, due []rf.CachedItem, scrapper *ssg.Scrapper, conf config) {
+	interval := time.Duration(conf.RetryFailedSummariesIntervalSeconds) * time.Second
+
+	items := []*gofeed.Item{}
+	guids := []string{}
+	for _, item := range due {
+		items = append(items, feedItemOf(item))
+		guids = append(guids, item.GUID)
+	}
+
+	if conf.Verbose {
+		log.Printf(">>> retrying %d failed summaries.", len(items))
+	}
+
+	deferred, err := summarizeAndCache(ctx, f, []gofeed.Feed{{Items: items}}, scrapper, conf)
+	if err != nil {
+		log.Printf("# retrying failed summaries failed: %s", err)
+	}
+
+	// (deferred ones are not counted as attempts, and retried on the next tick)
+	guids = slices.DeleteFunc(guids, func(guid string) bool {
+		return slices.ContainsFunc(deferred, func(item *gofeed.Item) bool {
+			return item.GUID == guid
+		})
+	})
+
+	succeeded, err := f.store.recordRetries(guids, interval, time.Now())
+	if err != nil {
+		log.Printf("# failed to record retries: %s", err)
+	}
+
+	if conf.Verbose {
+		log.Printf(">>> %d of %d failed summaries succeeded on retry.", len(succeeded), len(items))
+	}
+}
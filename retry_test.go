@@ -0,0 +1,114 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	rf "github.com/meinside/rss-feeds-go"
+)
+
+func TestSummaryRetryBackoff(t *testing.T) {
+	interval := 10 * time.Minute
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 10 * time.Minute},
+		{attempts: 2, want: 20 * time.Minute},
+		{attempts: 4, want: 80 * time.Minute},
+		{attempts: 20, want: maxSummaryRetryBackoff},
+	}
+
+	for _, tt := range tests {
+		if got := summaryRetryBackoff(interval, tt.attempts); got != tt.want {
+			t.Errorf("summaryRetryBackoff(%s, %d) = %s, want %s", interval, tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestFeedItemOf(t *testing.T) {
+	item := feedItemOf(rf.CachedItem{
+		Title:       "title",
+		Link:        "https://example.com/a",
+		Comments:    "https://example.com/a/comments",
+		GUID:        "guid",
+		Author:      "author",
+		PublishDate: "2026-01-01T00:00:00Z",
+		Description: "description",
+	})
+
+	if item.GUID != "guid" || item.Title != "title" || item.Link != "https://example.com/a" || item.Description != "description" {
+		t.Errorf("unexpected item: %+v", item)
+	}
+	if len(item.Links) != 2 || item.Links[1] != "https://example.com/a/comments" {
+		t.Errorf("unexpected links: %v", item.Links)
+	}
+	if item.Author == nil || item.Author.Name != "author" {
+		t.Errorf("unexpected author: %v", item.Author)
+	}
+	if item.PublishedParsed == nil || item.PublishedParsed.Year() != 2026 {
+		t.Errorf("unexpected publish date: %v", item.PublishedParsed)
+	}
+}
+
+func TestFeedStoreRetries(t *testing.T) {
+	_, store := newTestFeedStore(t)
+
+	insertTestCachedItems(t, store,
+		rf.CachedItem{GUID: "ok", Summary: "fine"},
+		rf.CachedItem{GUID: "failed", Summary: "<p>" + rf.ErrorPrefixSummaryFailedWithError + ": quota</p>"},
+	)
+
+	interval := 10 * time.Minute
+	now := time.Now()
+
+	// newly found ones are scheduled, not retried immediately
+	if due, err := store.dueRetries(3, interval, now); err != nil || len(due) != 0 {
+		t.Fatalf("expected no due retries, got %v (%v)", due, err)
+	}
+	if due, err := store.dueRetries(3, interval, now.Add(interval-time.Second)); err != nil || len(due) != 0 {
+		t.Fatalf("expected no due retries before backoff, got %v (%v)", due, err)
+	}
+
+	// due after the backoff
+	now = now.Add(interval)
+	due, err := store.dueRetries(3, interval, now)
+	if err != nil || len(due) != 1 || due[0].GUID != "failed" {
+		t.Fatalf("expected 'failed' to be due, got %v (%v)", due, err)
+	}
+
+	// failed again: backoff is doubled
+	if succeeded, err := store.recordRetries([]string{"failed"}, interval, now); err != nil || len(succeeded) != 0 {
+		t.Fatalf("expected no succeeded retries, got %v (%v)", succeeded, err)
+	}
+	if due, _ := store.dueRetries(3, interval, now.Add(2*interval-time.Second)); len(due) != 0 {
+		t.Errorf("expected no due retries before doubled backoff, got %v", due)
+	}
+	now = now.Add(2 * interval)
+	if due, _ := store.dueRetries(3, interval, now); len(due) != 1 {
+		t.Errorf("expected 'failed' to be due after doubled backoff, got %v", due)
+	}
+
+	// failed again: reached max attempts
+	if _, err := store.recordRetries([]string{"failed"}, interval, now); err != nil {
+		t.Fatal(err)
+	}
+	if due, _ := store.dueRetries(3, interval, now.Add(maxSummaryRetryBackoff)); len(due) != 0 {
+		t.Errorf("expected no due retries after max attempts, got %v", due)
+	}
+
+	// succeeded
+	if err := store.db.Model(&rf.CachedItem{}).Where("guid = ?", "failed").Update("summary", "summarized").Error; err != nil {
+		t.Fatal(err)
+	}
+	succeeded, err := store.recordRetries([]string{"failed"}, interval, now)
+	if err != nil || len(succeeded) != 1 || succeeded[0].Summary != "summarized" {
+		t.Errorf("expected 'failed' to be succeeded, got %v (%v)", succeeded, err)
+	}
+	var count int64
+	store.db.Model(&summaryRetry{}).Count(&count)
+	if count != 0 {
+		t.Errorf("expected retry to be deleted, got %d", count)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -13,11 +14,13 @@ import (
 	"path/filepath"
 	"slices"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/mmcdole/gofeed"
 
+	gt "github.com/meinside/gemini-things-go"
 	rf "github.com/meinside/rss-feeds-go"
 	ssg "github.com/meinside/simple-scrapper-go"
 )
@@ -48,6 +51,28 @@ var _paywalledSitesURLs = []string{
 	`https://www.theguardian.com/`,
 }
 
+// feed struct (a configured feed with its client and store)
+type feed struct {
+	conf   configRSSFeed
+	client *rf.Client
+	store  *feedStore
+
+	schedule   *cronSchedule // nil if polled adaptively
+	quietHours *quietHours   // nil if there are no quiet hours
+
+	scrappers *scrapperPool    // shared by all feeds (nil for creating a scrapper on each use)
+	polite    *politeness      // shared by all feeds (nil for no politeness)
+	usage     *usageAccountant // shared by all feeds (for requesting Google Gemini API)
+
+	prompt     *summaryPrompt    // for summarizing with `summarizer` (or `gemini`)
+	summarizer summarizer        // nil for summarizing with rss-feeds-go
+	gemini     *geminiSummarizer // for summarizing extracted texts of feeds summarized with rss-feeds-go
+	tagging    *tagging          // nil for no tags
+	translator titleTranslator   // nil for not translating titles
+
+	tick sync.Mutex // held while summarizing items of the feed (in a tick, or re-summarizing)
+}
+
 // run with config
 func run(conf config) {
 	if conf.Verbose {
@@ -55,120 +80,337 @@ func run(conf config) {
 	}
 
 	// api keys
-	apiKeys := []string{}
-	if conf.GoogleAIAPIKey != nil {
-		apiKeys = append(apiKeys, *conf.GoogleAIAPIKey)
-	}
-	if len(conf.GoogleAIAPIKeys) > 0 {
-		apiKeys = append(apiKeys, conf.GoogleAIAPIKeys...)
-	}
-	slices.Sort(apiKeys)
-	apiKeys = slices.Compact(apiKeys)
+	apiKeys := apiKeysOf(conf)
 
-	// feed configs for serving
-	feedConfs := map[*rf.Client]configRSSFeed{}
+	// feeds for serving
+	feeds := []*feed{}
 
 	// context for controlling goroutines
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// politeness of requests to each host (shared by all feeds)
+	polite := newPoliteness(conf)
+
+	// pool of scrappers (shared by all feeds, and closed on cancel)
+	scrappers := newScrapperPool(conf.MaxConcurrentScrapes, conf.ScrapperMaxPages, polite)
+	go func() {
+		<-ctx.Done()
+		scrappers.close()
+	}()
+
+	// accounting of api usages (shared by all feeds)
+	usage := newUsageAccountant(conf, apiKeys)
+
 	for _, feedConfig := range conf.RSSFeeds {
-		if client, err := rf.NewClientWithDB(
-			apiKeys,
-			feedConfig.FeedURLs,
-			filepath.Join(conf.DBFilesDirectory, feedConfig.CacheFilename),
-		); err == nil {
-			if len(conf.GoogleAIModels) > 0 {
-				client.SetGoogleAIModels(conf.GoogleAIModels)
+		if f, err := newFeed(conf, feedConfig, usage); err == nil {
+			defer func() { _ = f.store.close() }()
+			f.scrappers = scrappers
+			f.polite = polite
+
+			// load api usages of today
+			if err := usage.register(feedConfig.Name, f.store); err != nil {
+				log.Printf("# failed to load api usages: %s", err)
 			}
-			client.SetDesiredLanguage(*conf.DesiredLanguage)
-			client.SetVerbose(conf.Verbose)
 
-			if conf.Verbose {
-				log.Printf(
-					"> periodically(interval: %ds) processing feeds from urls: %s",
-					conf.FetchFeedsIntervalSeconds,
-					strings.Join(feedConfig.FeedURLs, ", "),
-				)
+			// delete states of sources which were removed from the config
+			if err := f.store.pruneSourceStates(feedConfig.FeedURLs); err != nil {
+				log.Printf("# failed to prune source states: %s", err)
 			}
 
-			// run periodically (fetch immediately on start, then on interval):
-			go func(client *rf.Client) {
-				processFeedTick(ctx, client, conf)
-
-				ticker := time.NewTicker(time.Duration(conf.FetchFeedsIntervalSeconds) * time.Second)
-				defer ticker.Stop()
-
-				for {
-					select {
-					case <-ctx.Done():
-						return
-					case <-ticker.C:
-						processFeedTick(ctx, client, conf)
-					}
-				}
-			}(client)
+			// index already cached items for searching, and save their links
+			if err := f.store.indexUnindexedItems(); err != nil {
+				log.Printf("# failed to index cached items: %s", err)
+			}
+			if err := f.store.saveCachedLinks(f.client.ListCachedItems(true)); err != nil {
+				log.Printf("# failed to save cached links: %s", err)
+			}
 
-			feedConfs[client] = feedConfig
+			feeds = append(feeds, f)
 		} else {
-			log.Printf("# failed to create a client: %s", err)
+			log.Printf("# failed to create a feed: %s", err)
 		}
 	}
 
-	if len(feedConfs) == 0 {
+	if len(feeds) == 0 {
 		log.Printf("# no feed clients were created, exiting")
 		return
 	}
 
+	// process feeds with a central scheduler
+	sched := newScheduler(feeds, conf.MaxConcurrentTicks)
+	sched.run(ctx, func(ctx context.Context, f *feed, drainOnly bool) {
+		processFeedTick(ctx, f, conf, drainOnly)
+	})
+	for _, f := range feeds {
+		if f.schedule != nil {
+			if conf.Verbose {
+				log.Printf(
+					"> processing feeds on schedule '%s' from urls: %s",
+					*f.conf.Schedule,
+					strings.Join(f.conf.FeedURLs, ", "),
+				)
+			}
+
+			// request ticks on schedule
+			go requestOnSchedule(ctx, sched, f, conf)
+		} else {
+			if conf.Verbose {
+				log.Printf(
+					"> periodically(interval: %ds ~ %ds) processing feeds from urls: %s",
+					conf.FetchFeedsMinIntervalSeconds,
+					conf.FetchFeedsMaxIntervalSeconds,
+					strings.Join(f.conf.FeedURLs, ", "),
+				)
+			}
+
+			// request ticks periodically (on start, then on the minimum interval;
+			// each source is polled only when it is due)
+			go requestPeriodically(ctx, sched, f, conf)
+		}
+	}
+
 	// serve RSS feeds
 	if conf.Verbose {
 		log.Printf("> serving with config: %s", rf.Prettify(conf))
 	}
-	serve(conf, feedConfs, cancel)
+	serve(ctx, conf, feeds, usage, cancel)
+}
+
+// get deduplicated api keys from given config
+func apiKeysOf(conf config) []string {
+	apiKeys := []string{}
+	if conf.GoogleAIAPIKey != nil {
+		apiKeys = append(apiKeys, *conf.GoogleAIAPIKey)
+	}
+	if len(conf.GoogleAIAPIKeys) > 0 {
+		apiKeys = append(apiKeys, conf.GoogleAIAPIKeys...)
+	}
+	slices.Sort(apiKeys)
+	return slices.Compact(apiKeys)
+}
+
+// create a new feed (with its client and store) for given `feedConfig`
+//
+// (Google Gemini API is requested with the api keys and models of given `usage`)
+func newFeed(conf config, feedConfig configRSSFeed, usage *usageAccountant) (*feed, error) {
+	_, schedule, quiet, err := feedConfig.scheduling()
+	if err != nil {
+		return nil, err
+	}
+
+	dbFilepath := filepath.Join(conf.DBFilesDirectory, feedConfig.CacheFilename)
+
+	// (for the cache and feeds only, as items are summarized with clients of each attempt)
+	client, err := rf.NewClientWithDB(
+		nil,
+		feedConfig.FeedURLs,
+		dbFilepath,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a client: %w", err)
+	}
+	client.SetVerbose(conf.Verbose)
+
+	store, err := openFeedStore(dbFilepath)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &feed{
+		conf:       feedConfig,
+		client:     client,
+		store:      store,
+		schedule:   schedule,
+		quietHours: quiet,
+		usage:      usage,
+		tagging:    newTagging(feedConfig.Tags),
+	}
+	promptConfig := configSummaryPrompt{}
+	if feedConfig.SummaryPrompt != nil {
+		promptConfig = *feedConfig.SummaryPrompt
+	}
+	if f.prompt, err = newSummaryPrompt(promptConfig); err != nil {
+		_ = store.close()
+		return nil, fmt.Errorf("invalid 'summary_prompt' of '%s': %w", feedConfig.Name, err)
+	}
+	if f.summarizer = newSummarizer(conf, feedConfig, usage); f.summarizer == nil { // (summarized with rss-feeds-go)
+		f.gemini = newGeminiSummarizer(usage)
+	}
+	if feedConfig.TranslateTitles {
+		if f.summarizer == nil {
+			f.translator = f.gemini
+		} else if translator, ok := f.summarizer.(titleTranslator); ok {
+			f.translator = translator
+		}
+	}
+	return f, nil
 }
 
 // processFeedTick handles a single tick of the feed processing loop
-func processFeedTick(parent context.Context, client *rf.Client, conf config) {
-	// delete old caches
+//
+// (with `drainOnly`, sources are not fetched and only the deferred items are summarized)
+func processFeedTick(parent context.Context, f *feed, conf config, drainOnly bool) {
+	f.tick.Lock()
+	defer f.tick.Unlock()
+
+	client := f.client
+
+	// delete old caches (and their rows in the store)
 	if err := client.DeleteOldCachedItems(); err != nil {
 		log.Printf("# failed to delete old cached items: %s", err)
 	}
+	if err := f.store.prune(); err != nil {
+		log.Printf("# failed to prune feed store: %s", err)
+	}
 
-	// context with timeout (fetch)
-	ctx, cancel := context.WithTimeout(parent, time.Duration(conf.FetchFeedsTimeoutSeconds)*time.Second)
-	defer cancel()
+	// fetch feeds (from available sources),
+	var feeds []gofeed.Feed
+	var validators []sourceValidators
+	if !drainOnly {
+		feeds, validators = fetchFeeds(parent, f, conf)
+	}
+	processed := true // whether all fetched items are processed (cached, deferred, or dropped) safely
+
+	// drop items disallowed by robots.txt,
+	if conf.RespectRobotsTxt {
+		var dropped int
+		if feeds, dropped = dropDisallowedItems(parent, feeds, f.polite, conf.Verbose); conf.Verbose && dropped > 0 {
+			log.Printf(">>> dropped %d item(s) disallowed by robots.txt.", dropped)
+		}
+	}
+
+	// drop duplicated items (will be merged into cached ones),
+	feeds, duplicates := dedupeFeedItems(feeds, f.store)
+	if conf.Verbose && len(duplicates) > 0 {
+		log.Printf(">>> dropped %d duplicated item(s).", len(duplicates))
+	}
 
-	// fetch feeds,
-	feeds, err := client.FetchFeeds(
-		ctx,
-		true,
-		ignoreItemsPublishedBeforeDays,
+	// list items with failed summaries which are due for retrying,
+	retries, err := f.store.dueRetries(
+		conf.RetryFailedSummariesMaxAttempts,
+		time.Duration(conf.RetryFailedSummariesIntervalSeconds)*time.Second,
+		time.Now(),
 	)
 	if err != nil {
-		log.Printf("# failed to fetch feeds: %s", err)
-		return
+		log.Printf("# failed to list retries of failed summaries: %s", err)
 	}
 
-	// summarize and cache them,
-	if numItems(feeds) > 0 {
-		// try creating a new scrapper,
-		scrapper := newScrapper()
-		if scrapper != nil {
-			// scrap + summarize, and cache feeds
-			if err := client.SummarizeAndCacheFeeds(parent, feeds, scrapper); err != nil {
-				log.Printf("# summary with scrapper failed: %s", err)
+	// (summarization is paused in quiet hours, or when api usages are not available)
+	paused, reason := f.quietHours != nil && f.quietHours.contains(time.Now()), "in quiet hours"
+	if !paused && f.conf.usesGemini() {
+		var available bool
+		available, reason = f.usage.available(f.conf.Name, time.Now())
+		paused = !available
+	}
+
+	if paused {
+		// defer summarization of fetched items while paused,
+		if err := f.store.deferItems(feeds); err != nil {
+			log.Printf("# failed to defer items: %s", err)
+			processed = false
+		}
+		if conf.Verbose && numItems(feeds) > 0 {
+			log.Printf(">>> deferred %d item(s) %s.", numItems(feeds), reason)
+		}
+		feeds, retries = nil, nil
+	} else {
+		// or, summarize the deferred ones (first) with the fetched items,
+		if deferred, err := f.store.deferredItems(); err == nil {
+			deferred = slices.DeleteFunc(deferred, func(item *gofeed.Item) bool {
+				return slices.ContainsFunc(feeds, func(f gofeed.Feed) bool {
+					return slices.ContainsFunc(f.Items, func(fetched *gofeed.Item) bool {
+						return fetched.GUID == item.GUID
+					})
+				})
+			}) // (ones fetched again)
+			if len(deferred) > 0 {
+				if conf.Verbose {
+					log.Printf(">>> summarizing %d deferred item(s).", len(deferred))
+				}
+				feeds = append([]gofeed.Feed{{Items: deferred}}, feeds...)
+			}
+		} else {
+			log.Printf("# failed to list deferred items: %s", err)
+		}
+
+		// (and defer the ones over the limit to the next tick)
+		var rest []gofeed.Feed
+		if feeds, rest = limitItems(feeds, conf.MaxItemsPerTick); len(rest) > 0 {
+			if err := f.store.deferItems(rest); err != nil {
+				log.Printf("# failed to defer items: %s", err)
+				processed = false
+			}
+			if conf.Verbose {
+				log.Printf(">>> deferred %d item(s) over the limit of a tick.", numItems(rest))
 			}
+		}
+	}
 
-			// close the scrapper,
-			if err := scrapper.Close(); err != nil {
-				log.Printf("# failed to close scrapper: %s", err)
+	// summarize and cache them,
+	if numItems(feeds) > 0 || len(retries) > 0 {
+		// try acquiring a scrapper from the pool,
+		scrapper, release := f.scrappers.acquire(parent)
+		pages := 0 // (estimated) number of pages crawled with the scrapper
+
+		// cluster items with similar contents (will be summarized together, with their scraped texts),
+		if scrapper != nil && f.conf.ClusterSimilarItems {
+			pages += numItems(feeds)
+
+			var similars []duplicatedItem
+			feeds, similars = clusterSimilarItems(feeds, f.store, func(link string) (string, error) {
+				return f.scrappers.scrapeText(scrapper, link)
+			}, conf.Verbose)
+			if conf.Verbose && len(similars) > 0 {
+				log.Printf(">>> combined %d item(s) with similar contents.", len(similars))
+			}
+			if err := f.store.recordDuplicates(similars); err != nil {
+				log.Printf("# failed to record similar items: %s", err)
 			}
 		} else {
-			// or just fetch + summarize, and cache feeds
-			if err := client.SummarizeAndCacheFeeds(parent, feeds); err != nil {
+			pages += numItems(feeds)
+		}
+
+		// (scrap +) summarize, and cache feeds,
+		if numItems(feeds) > 0 {
+
+			deferred, err := summarizeAndCache(parent, f, feeds, scrapper, conf)
+			if err != nil {
 				log.Printf("# summary failed: %s", err)
+				if errors.Is(err, errNotCached) {
+					processed = false
+				}
+			}
+
+			// (defer the ones which could not be summarized for now to the next tick)
+			if err := f.store.deferItems([]gofeed.Feed{{Items: deferred}}); err != nil {
+				log.Printf("# failed to defer items: %s", err)
+				processed = false
 			}
+			if conf.Verbose && len(deferred) > 0 {
+				log.Printf(">>> deferred %d item(s) to the next tick.", len(deferred))
+			}
+		}
+
+		// retry failed summaries,
+		if len(retries) > 0 {
+			pages += len(retries)
+
+			retryFailedSummaries(parent, f, retries, scrapper, conf)
 		}
+
+		// and release the scrapper,
+		release(pages)
+	}
+
+	// save validators of the fetched sources, only when their items were processed safely
+	// (or they will be fetched again without validators)
+	if processed {
+		if err := f.store.saveSourceValidators(validators); err != nil {
+			log.Printf("# failed to save validators of sources: %s", err)
+		}
+	} else if conf.Verbose && len(validators) > 0 {
+		log.Printf(">>> not saving validators of %d source(s), as their items were not processed safely.", len(validators))
 	}
 
 	// fetch cached (summarized) items,
@@ -178,6 +420,19 @@ func processFeedTick(parent context.Context, client *rf.Client, conf config) {
 		log.Printf(">>> fetched %d new item(s).", len(items))
 	}
 
+	// save their links, and merge (recorded) duplicated items into them,
+	if err := f.store.saveCachedLinks(items); err != nil {
+		log.Printf("# failed to save cached links: %s", err)
+	}
+	if err := f.store.mergeDuplicates(); err != nil {
+		log.Printf("# failed to merge duplicated items: %s", err)
+	}
+
+	// index the ones which are not indexed yet for searching, (others are re-indexed whenever rewritten)
+	if err := f.store.indexUnindexedItems(); err != nil {
+		log.Printf("# failed to index items: %s", err)
+	}
+
 	// and mark them as read
 	if err := client.MarkCachedItemsAsRead(items); err != nil {
 		log.Printf("# failed to mark items as read: %s", err)
@@ -188,33 +443,192 @@ func processFeedTick(parent context.Context, client *rf.Client, conf config) {
 	}
 }
 
-// serve RSS xml
-func serve(conf config, feedConfs map[*rf.Client]configRSSFeed, cancelFunc context.CancelFunc) {
-	mux := http.NewServeMux()
+// summarize and cache given feeds `fs` of feed `f`, with `scrapper` if it is not nil
+//
+// when there is no scrapper, readable texts of html documents (and markdown or plain texts) are extracted
+// and summarized with the default prompt instead.
+// feeds with their own summarizers (or custom prompts) are summarized with them instead.
+// discussions of items are summarized and appended too, if configured.
+// titles left untranslated by the summaries are translated, if configured.
+// items which could not be summarized for now (eg. over budgets) are returned as `deferred`, without being cached.
+func summarizeAndCache(ctx context.Context, f *feed, fs []gofeed.Feed, scrapper *ssg.Scrapper, conf config) (deferred []*gofeed.Item, err error) {
+	ctx = withUsageFeed(ctx, f.conf.Name) // (for accounting api usages of the feed)
+
+	items := []*gofeed.Item{}
+	for _, feed := range fs {
+		items = append(items, feed.Items...)
+	}
+	deferred, err = summarizeItems(ctx, f, items, scrapper, conf)
 
-	// set http handlers
-	for client, feedConf := range feedConfs {
-		// get values for publish
-		rssTitle := defaultPublishTitle
-		if feedConf.PublishTitle != nil {
-			rssTitle = *feedConf.PublishTitle
+	// (translate their titles which were left untranslated, if needed)
+	translateTitles(ctx, f, fs, conf)
+
+	// (and their discussions, if needed)
+	summarizeDiscussions(ctx, f, fs, conf)
+
+	return deferred, err
+}
+
+// errNotCached is wrapped in errors of items which could not be cached (so they would be lost)
+var errNotCached = errors.New("not cached")
+
+// summarize and cache given items of feed `f` one by one, with `scrapper` if it is not nil
+//
+// items are summarized with the summarizer of the feed, or with rss-feeds-go,
+// and the models which summarized them are recorded in the store.
+// when summarized with Google Gemini API, the remaining items are returned as `deferred` (and not cached)
+// if the feed cannot be summarized for now, eg. over budgets, all api keys are cooling down, or models are overloaded.
+func summarizeItems(ctx context.Context, f *feed, items []*gofeed.Item, scrapper *ssg.Scrapper, conf config) (deferred []*gofeed.Item, err error) {
+	var errs []error
+
+	interval := summaryIntervalDuration
+	if f.summarizer != nil {
+		interval = f.summarizer.interval()
+	}
+
+	for i, item := range items {
+		// (check budgets and cooldowns before each item)
+		if f.conf.usesGemini() {
+			if available, reason := f.usage.available(f.conf.Name, time.Now()); !available {
+				if conf.Verbose {
+					log.Printf(">>> deferring %d item(s) %s.", len(items[i:]), reason)
+				}
+				return items[i:], errors.Join(errs...)
+			}
+		}
+
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return items[i:], errors.Join(append(errs, ctx.Err())...)
+			case <-time.After(interval):
+			}
+		}
+
+		itemCtx, cancel := context.WithTimeout(ctx, promptSummaryTimeout)
+		var model, title, summary string
+		var tags []string
+		if f.summarizer != nil {
+			model, title, summary, tags, err = summarizeItemWithPrompt(itemCtx, f, item, scrapper, conf)
+		} else {
+			model, title, summary, tags, err = summarizeItemWithRF(itemCtx, f, item, scrapper, conf)
+		}
+		cancel()
+
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, errNoAvailableGeminiKey) || gt.IsModelOverloaded(err) {
+				if conf.Verbose {
+					log.Printf(">>> deferring %d item(s) due to: %s", len(items[i:]), gt.ErrToStr(err))
+				}
+				return items[i:], errors.Join(errs...)
+			}
+
+			if summary == "" {
+				summary = failedSummaryOf(*item, model, err)
+			}
+			title = item.Title
+
+			errs = append(errs, fmt.Errorf("failed to summarize item '%s' (%s): %w", item.Title, item.Link, err))
+		}
+
+		if err := f.store.saveSummary(*item, strings.TrimSpace(title), strings.TrimSpace(summary)); err != nil {
+			errs = append(errs, fmt.Errorf("failed to cache item '%s': %w: %w", item.Title, errNotCached, err))
+			continue
 		}
-		rssLink := defaultPublishLink
-		if feedConf.PublishLink != nil {
-			rssLink = *feedConf.PublishLink
+
+		// (record which model summarized it, if any)
+		if model != "" {
+			if e := f.store.saveSummaryModel(item.GUID, model, err != nil); e != nil {
+				errs = append(errs, e)
+			}
 		}
-		rssDescription := defaultPublishDescription
-		if feedConf.PublishDescription != nil {
-			rssDescription = *feedConf.PublishDescription
+
+		if tags != nil { // (replaced when tagged)
+			if err := f.store.saveItemTags(item.GUID, tags); err != nil {
+				errs = append(errs, fmt.Errorf("failed to save tags of item '%s': %w", item.Title, err))
+			}
 		}
-		rssAuthor := defaultPublishAuthor
-		if feedConf.PublishAuthor != nil {
-			rssAuthor = *feedConf.PublishAuthor
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+// summarize given item of feed `f` with rss-feeds-go, with `scrapper` if it is not nil
+//
+// texts which were already scraped (or combined with similar items) are summarized with the default prompt instead,
+// and so are the texts of contents (or their pdf documents, as they are) when there is no scrapper, if possible.
+// (YouTube videos are left to rss-feeds-go, which passes them to Google Gemini API by their urls)
+// items summarized with rss-feeds-go are tagged with another generation, if configured.
+//
+// each attempt of rss-feeds-go is made with a client of a single (api key, model) pair from the usage accountant
+// (and a memory cache), so that usages are accounted and quotas are handled per attempt.
+// (rss-feeds-go does not report token counts, so only requests and errors are counted)
+// the failed summary generated by rss-feeds-go is returned with the error, if any.
+func summarizeItemWithRF(ctx context.Context, f *feed, item *gofeed.Item, scrapper *ssg.Scrapper, conf config) (model, title, summary string, tags []string, err error) {
+	if text := scrapedTextOf(item); text != "" {
+		return generateSummary(ctx, f, f.gemini, item, truncateText(text, conf.MaxExtractedTextBytes), nil, conf)
+	} else if scrapper == nil && item.Link != "" && !isYouTubeLink(item.Link) {
+		if text, mediaType, document, err := fetchContentText(ctx, f.polite, item.Link, true, false, conf.MaxExtractedTextBytes); err == nil {
+			if conf.Verbose {
+				log.Printf(">>> fetched %d bytes of text (or document) from '%s' (%s)", len(text)+len(document), item.Link, mediaType)
+			}
+			return generateSummary(ctx, f, f.gemini, item, text, document, conf)
+		} else if conf.Verbose && !errors.Is(err, errSkippedContent) {
+			log.Printf(">>> failed to extract text of '%s' (%s): %s", item.Title, item.Link, err)
 		}
-		rssEmail := defaultPublishEmail
-		if feedConf.PublishEmail != nil {
-			rssEmail = *feedConf.PublishEmail
+	}
+
+	scrappers := []*ssg.Scrapper{}
+	if scrapper != nil {
+		scrappers = append(scrappers, scrapper)
+	}
+
+	model, err = f.usage.try(ctx, func(combo geminiCombo) (counts usageCounts, err error) {
+		client := rf.NewClient([]string{combo.apiKey}, nil)
+		client.SetGoogleAIModels([]string{combo.model})
+		client.SetDesiredLanguage(*conf.DesiredLanguage)
+		client.SetVerbose(conf.Verbose)
+
+		err = client.SummarizeAndCacheFeeds(ctx, []gofeed.Feed{{Items: []*gofeed.Item{item}}}, scrappers...)
+
+		title, summary = "", ""
+		for _, cached := range client.ListCachedItems(true) {
+			if cached.GUID == item.GUID {
+				title, summary = cached.Title, cached.Summary
+			}
 		}
+		return counts, err
+	})
+	if err != nil || f.tagging == nil || isFailedSummary(summary) {
+		return model, title, summary, nil, err
+	}
+
+	// (tags are generated separately, as rss-feeds-go does not generate them)
+	if tags, err = f.gemini.generateTags(ctx, title, _summarizedWithLine.ReplaceAllString(summary, ""), f.tagging); err != nil {
+		log.Printf("# failed to generate tags of '%s': %s", item.Title, err)
+	}
+	return model, title, summary, tags, nil
+}
+
+// build a failed summary of given item (same as the ones of rss-feeds-go)
+func failedSummaryOf(item gofeed.Item, model string, err error) string {
+	var summary string
+	if model != "" {
+		summary = fmt.Sprintf("%s [%s]: %s", rf.ErrorPrefixSummaryFailedWithError, model, gt.ErrToStr(err))
+	} else {
+		summary = fmt.Sprintf("%s: %s", rf.ErrorPrefixSummaryFailedWithError, gt.ErrToStr(err))
+	}
+	return fmt.Sprintf("<p>%s</p>\n<hr>\n%s", summary, item.Description)
+}
+
+// serve RSS xml
+func serve(ctx context.Context, conf config, feeds []*feed, usage *usageAccountant, cancelFunc context.CancelFunc) {
+	mux := http.NewServeMux()
+
+	// set http handlers
+	for _, f := range feeds {
+		client, feedConf := f.client, f.conf
+		sources := []*feed{f}
 
 		mux.HandleFunc(path.Join("/", feedConf.ServePath), func(w http.ResponseWriter, r *http.Request) {
 			if requestPermitted(r, conf) {
@@ -226,36 +640,62 @@ func serve(conf config, feedConfs map[*rf.Client]configRSSFeed, cancelFunc conte
 					items = dropItemsWithFailedSummaries(items)
 				}
 
-				etag := itemsETag(items)
-				lastModified := latestPublishDate(items)
-
-				w.Header().Set("Content-Type", rf.PublishContentType)
-				w.Header().Set("Cache-Control", "max-age=60")
-				w.Header().Set("ETag", etag)
-				if !lastModified.IsZero() {
-					w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
-				}
+				// and serve them
+				serveItems(w, r, client, feedConf.configPublish, items, sources)
+			} else {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		})
+	}
 
-				if notModified(r, etag, lastModified) {
-					w.WriteHeader(http.StatusNotModified)
+	// set http handlers for search feeds
+	for _, searchFeed := range conf.SearchFeeds {
+		mux.HandleFunc(path.Join("/", searchFeed.ServePath), func(w http.ResponseWriter, r *http.Request) {
+			if requestPermitted(r, conf) {
+				// search cached items of source feeds,
+				items, client, err := searchFeedItems(searchFeed, feeds)
+				if err != nil {
+					log.Printf("# failed to search items for '%s': %s", searchFeed.Name, err)
+					w.WriteHeader(http.StatusInternalServerError)
 					return
 				}
 
-				// generate xml and serve it
-				if bytes, err := client.PublishXML(rssTitle, rssLink, rssDescription, rssAuthor, rssEmail, items); err == nil {
-					if _, err := w.Write(bytes); err != nil {
-						log.Printf("# failed to write data: %s", err)
-					}
-				} else {
-					log.Printf("# failed to serve RSS feeds: %s", err)
+				// and serve them
+				serveItems(w, r, client, searchFeed.configPublish, items, feeds)
+			} else {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		})
+	}
+
+	// set http handlers for composite feeds
+	for _, compositeFeed := range conf.CompositeFeeds {
+		mux.HandleFunc(path.Join("/", compositeFeed.ServePath), func(w http.ResponseWriter, r *http.Request) {
+			if requestPermitted(r, conf) {
+				// merge cached items of source feeds,
+				items, client, err := compositeFeedItems(compositeFeed, feeds)
+				if err != nil {
+					log.Printf("# failed to merge items for '%s': %s", compositeFeed.Name, err)
 					w.WriteHeader(http.StatusInternalServerError)
+					return
 				}
+
+				// and serve them
+				serveItems(w, r, client, compositeFeed.configPublish, items, feeds)
 			} else {
 				w.WriteHeader(http.StatusUnauthorized)
 			}
 		})
 	}
 
+	// search cached items of all feeds
+	mux.HandleFunc(searchServePath, handleSearch(conf, feeds))
+
+	// admin endpoints
+	mux.HandleFunc(adminResummarizeServePath, handleResummarize(ctx, conf, feeds))
+	mux.HandleFunc(adminStatusServePath, handleStatus(conf, feeds, usage))
+	mux.HandleFunc(adminUsageServePath, handleUsageReport(conf, feeds))
+
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", conf.RSSServerPort),
 		Handler:      mux,
@@ -290,6 +730,47 @@ func serve(conf config, feedConfs map[*rf.Client]configRSSFeed, cancelFunc conte
 	}
 }
 
+// serve given cached `items` as RSS xml (or 304 for conditional requests)
+//
+// items are served with their tags (as `<category>` elements) and original titles (in descriptions) in the stores of `sources` feeds,
+// and filtered with `tag` queries of the request (items with all of them).
+func serveItems(w http.ResponseWriter, r *http.Request, client *rf.Client, publish configPublish, items []rf.CachedItem, sources []*feed) {
+	itemTags := itemTagsOf(sources, items)
+	items = filterItemsByTags(items, itemTags, r.URL.Query()[tagQueryParam])
+	items = withOriginalTitles(sources, items)
+
+	etag := itemsETag(items)
+	lastModified := latestPublishDate(items)
+
+	w.Header().Set("Content-Type", rf.PublishContentType)
+	w.Header().Set("Cache-Control", "max-age=60")
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// generate xml and serve it
+	title, link, description, author, email := publish.values()
+	if bytes, err := client.PublishXML(title, link, description, author, email, items); err == nil {
+		if withTags, err := withCategories(bytes, itemTags); err == nil {
+			bytes = withTags
+		} else {
+			log.Printf("# failed to add categories: %s", err)
+		}
+		if _, err := w.Write(bytes); err != nil {
+			log.Printf("# failed to write data: %s", err)
+		}
+	} else {
+		log.Printf("# failed to serve RSS feeds: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
 // check if given http request is permitted
 func requestPermitted(r *http.Request, conf config) bool {
 	if len(conf.PermittedUserAgents) > 0 {
@@ -317,23 +798,30 @@ func numItems(fs []gofeed.Feed) (num int) {
 	return num
 }
 
-// create a new scrapper
-func newScrapper() *ssg.Scrapper {
+// get guids of all items in given feeds
+func guidsOf(fs []gofeed.Feed) (guids []string) {
+	for _, feed := range fs {
+		for _, item := range feed.Items {
+			guids = append(guids, item.GUID)
+		}
+	}
+	return guids
+}
+
+// create a new scrapper which crawls politely with given `polite`
+func newScrapper(polite *politeness) *ssg.Scrapper {
 	if scrapper, err := ssg.NewScrapper(); err == nil {
-		// replace urls if needed
+		if ua := polite.userAgentOr(""); ua != "" {
+			scrapper.SetFixedUserAgent(ua)
+		}
+
+		// replace urls if needed, and wait for a polite time to crawl them
 		scrapper.SetURLReplacer(func(from string) string {
-			if strings.HasPrefix(from, "https://www.reddit.com/") {
-				// www.reddit.com => old.reddit.com
-				return strings.ReplaceAll(from, "www.reddit.com", "old.reddit.com")
-			} else if slices.ContainsFunc(_paywalledSitesURLs, func(url string) bool {
-				return strings.HasPrefix(from, url)
-			}) {
-				// use https://www.paywallskip.com/
-				return "https://www.paywallskip.com/article?url=" + from
+			to := replaceURL(from)
+			if release, err := polite.wait(context.Background(), to, false); err == nil {
+				release() // (connections of the browser are not tracked)
 			}
-
-			// default: return it as-is
-			return from
+			return to
 		})
 
 		// selector for specific urls
@@ -354,10 +842,26 @@ func newScrapper() *ssg.Scrapper {
 	return nil
 }
 
+// replace given url for crawling, if needed
+func replaceURL(from string) string {
+	if strings.HasPrefix(from, "https://www.reddit.com/") {
+		// www.reddit.com => old.reddit.com
+		return strings.ReplaceAll(from, "www.reddit.com", "old.reddit.com")
+	} else if slices.ContainsFunc(_paywalledSitesURLs, func(url string) bool {
+		return strings.HasPrefix(from, url)
+	}) {
+		// use https://www.paywallskip.com/
+		return "https://www.paywallskip.com/article?url=" + from
+	}
+
+	// default: return it as-is
+	return from
+}
+
 // drop items with failed summaries
 func dropItemsWithFailedSummaries(items []rf.CachedItem) []rf.CachedItem {
 	return slices.DeleteFunc(items, func(item rf.CachedItem) bool {
-		return strings.Contains(item.Summary, rf.ErrorPrefixSummaryFailedWithError)
+		return isFailedSummary(item.Summary)
 	})
 }
 
@@ -0,0 +1,254 @@
+// schedule.go
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	cronScheduleMaxLookahead = 5 * 366 * 24 * time.Hour // give up finding the next time after this
+)
+
+// bounds of cron fields (minute, hour, day of month, month, day of week)
+var _cronFieldBounds = [5][2]int{
+	{0, 59},
+	{0, 23},
+	{1, 31},
+	{1, 12},
+	{0, 7}, // (both 0 and 7 are sunday)
+}
+
+// cronSchedule struct (a parsed 5-field cron expression in a timezone)
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays uint64 // bit sets of matching values
+
+	anyDay, anyWeekday bool // whether day of month / week is `*`
+
+	location *time.Location
+}
+
+// parse given 5-field cron expression (`minute hour day-of-month month day-of-week`) in `location`
+func parseCronSchedule(expr string, location *time.Location) (schedule *cronSchedule, err error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression '%s' must have 5 fields", expr)
+	}
+
+	var sets [5]uint64
+	for i, field := range fields {
+		if sets[i], err = parseCronField(field, _cronFieldBounds[i][0], _cronFieldBounds[i][1]); err != nil {
+			return nil, fmt.Errorf("invalid cron expression '%s': %w", expr, err)
+		}
+	}
+
+	// sunday can be 0 or 7
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	return &cronSchedule{
+		minutes:    sets[0],
+		hours:      sets[1],
+		days:       sets[2],
+		months:     sets[3],
+		weekdays:   sets[4],
+		anyDay:     fields[2] == "*",
+		anyWeekday: fields[4] == "*",
+		location:   location,
+	}, nil
+}
+
+// parse a cron field (eg. `*`, `*/15`, `1-5`, `0,30`, `9-17/2`) into a bit set
+func parseCronField(field string, low, high int) (set uint64, err error) {
+	for part := range strings.SplitSeq(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step: '%s'", part)
+			}
+		}
+
+		from, to := low, high
+		if rng != "*" {
+			fromStr, toStr, isRange := strings.Cut(rng, "-")
+			if from, err = strconv.Atoi(fromStr); err != nil {
+				return 0, fmt.Errorf("invalid value: '%s'", part)
+			}
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(toStr); err != nil {
+					return 0, fmt.Errorf("invalid value: '%s'", part)
+				}
+			} else if hasStep {
+				to = high
+			}
+		}
+		if from < low || to > high || from > to {
+			return 0, fmt.Errorf("value out of range [%d-%d]: '%s'", low, high, part)
+		}
+
+		for v := from; v <= to; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// check if given day matches the day of month / week fields
+//
+// (like cron, matches either one of them when both are restricted)
+func (s *cronSchedule) matchesDay(t time.Time) bool {
+	day := s.days&(1<<t.Day()) != 0
+	weekday := s.weekdays&(1<<int(t.Weekday())) != 0
+
+	switch {
+	case s.anyDay && s.anyWeekday:
+		return true
+	case s.anyDay:
+		return weekday
+	case s.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
+
+// get the next scheduled time after `after` (or zero time if there is none)
+func (s *cronSchedule) next(after time.Time) time.Time {
+	t := after.In(s.location).Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(cronScheduleMaxLookahead)
+
+	for t.Before(limit) {
+		if s.months&(1<<int(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.location)
+			continue
+		}
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.location)
+			continue
+		}
+		if s.hours&(1<<t.Hour()) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.location)
+			continue
+		}
+		if s.minutes&(1<<t.Minute()) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// quietHours struct (a daily time window in a timezone)
+type quietHours struct {
+	from, to int // minutes of the day
+
+	location *time.Location
+}
+
+// parse quiet hours from given `from` and `to` (HH:MM) in `location`
+func parseQuietHours(from, to string, location *time.Location) (hours *quietHours, err error) {
+	hours = &quietHours{location: location}
+	if hours.from, err = parseTimeOfDay(from); err != nil {
+		return nil, err
+	}
+	if hours.to, err = parseTimeOfDay(to); err != nil {
+		return nil, err
+	}
+	if hours.from == hours.to {
+		return nil, fmt.Errorf("quiet hours from '%s' to '%s' are empty", from, to)
+	}
+	return hours, nil
+}
+
+// parse given time of day (HH:MM) into minutes of the day
+func parseTimeOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day '%s' (expected HH:MM)", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// check if given time `t` is in the quiet hours
+//
+// (the window wraps around midnight if `to` is earlier than `from`)
+func (q *quietHours) contains(t time.Time) bool {
+	t = t.In(q.location)
+	m := t.Hour()*60 + t.Minute()
+
+	if q.from < q.to {
+		return q.from <= m && m < q.to
+	}
+	return m >= q.from || m < q.to
+}
+
+// get the next time after `after` when the quiet hours end
+func (q *quietHours) end(after time.Time) time.Time {
+	t := after.In(q.location)
+	end := time.Date(t.Year(), t.Month(), t.Day(), q.to/60, q.to%60, 0, 0, q.location)
+	if !end.After(after) {
+		end = time.Date(t.Year(), t.Month(), t.Day()+1, q.to/60, q.to%60, 0, 0, q.location)
+	}
+	return end
+}
+
+// deferredItem struct (a fetched item whose summarization was deferred during quiet hours, or over the limit of a tick)
+type deferredItem struct {
+	GUID string `gorm:"primaryKey"`
+	Item string // json of gofeed.Item
+
+	CreatedAt time.Time
+}
+
+// save items of given feeds `fs` for summarizing them later (already deferred ones keep their order)
+func (s *feedStore) deferItems(fs []gofeed.Feed) error {
+	for _, f := range fs {
+		for _, item := range f.Items {
+			if bytes, err := json.Marshal(item); err == nil {
+				if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&deferredItem{
+					GUID: item.GUID,
+					Item: string(bytes),
+				}).Error; err != nil {
+					return fmt.Errorf("failed to defer item '%s': %w", item.GUID, err)
+				}
+			} else {
+				return fmt.Errorf("failed to serialize item '%s': %w", item.GUID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// list deferred items (in the order of deferral)
+func (s *feedStore) deferredItems() (items []*gofeed.Item, err error) {
+	var rows []deferredItem
+	if err = s.db.Order("created_at ASC").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to list deferred items: %w", err)
+	}
+	for _, row := range rows {
+		var item gofeed.Item
+		if err = json.Unmarshal([]byte(row.Item), &item); err != nil {
+			return nil, fmt.Errorf("failed to deserialize deferred item '%s': %w", row.GUID, err)
+		}
+		items = append(items, &item)
+	}
+	return items, nil
+}
+
+// delete deferred items which were cached (summarized), or merged into cached ones since
+func (s *feedStore) pruneDeferredItems() error {
+	return s.db.
+		Where("guid IN (SELECT guid FROM cached_items) OR guid IN (SELECT guid FROM discussion_links)").
+		Delete(&deferredItem{}).Error
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	rf "github.com/meinside/rss-feeds-go"
+)
+
+func TestParseCronSchedule(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{expr: "* * * * *"},
+		{expr: "*/15 9-17 * * 1-5"},
+		{expr: "0,30 8 1 1,7 *"},
+		{expr: "0 9-17/2 * * 7"},
+		{expr: "* * * *", wantErr: true},
+		{expr: "60 * * * *", wantErr: true},
+		{expr: "* 5-3 * * *", wantErr: true},
+		{expr: "*/0 * * * *", wantErr: true},
+		{expr: "a * * * *", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		if _, err := parseCronSchedule(tt.expr, time.UTC); (err != nil) != tt.wantErr {
+			t.Errorf("parseCronSchedule(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	seoul, err := time.LoadLocation("Asia/Seoul")
+	if err != nil {
+		t.Skip("no timezone data:", err)
+	}
+
+	// 2026-01-02 (friday) 10:07 in UTC
+	after := time.Date(2026, 1, 2, 10, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr     string
+		location *time.Location
+		want     time.Time
+	}{
+		{expr: "* * * * *", location: time.UTC, want: time.Date(2026, 1, 2, 10, 8, 0, 0, time.UTC)},
+		{expr: "*/15 * * * *", location: time.UTC, want: time.Date(2026, 1, 2, 10, 15, 0, 0, time.UTC)},
+		{expr: "0 9 * * *", location: time.UTC, want: time.Date(2026, 1, 3, 9, 0, 0, 0, time.UTC)},
+		{expr: "0 9 * * 1-5", location: time.UTC, want: time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)},
+		{expr: "0 0 1 * *", location: time.UTC, want: time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 1 * 6", location: time.UTC, want: time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC)}, // (day of month or week)
+		{expr: "0 0 29 2 *", location: time.UTC, want: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 9 * * *", location: seoul, want: time.Date(2026, 1, 3, 9, 0, 0, 0, seoul)}, // (19:07 in Seoul)
+	}
+
+	for _, tt := range tests {
+		schedule, err := parseCronSchedule(tt.expr, tt.location)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := schedule.next(after); !got.Equal(tt.want) {
+			t.Errorf("next(%q) = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+
+	// no such time
+	schedule, _ := parseCronSchedule("0 0 31 2 *", time.UTC)
+	if got := schedule.next(after); !got.IsZero() {
+		t.Errorf("expected zero time for impossible schedule, got %s", got)
+	}
+}
+
+func TestQuietHours(t *testing.T) {
+	if _, err := parseQuietHours("22:00", "22:00", time.UTC); err == nil {
+		t.Error("expected error for empty quiet hours, got nil")
+	}
+	if _, err := parseQuietHours("25:00", "07:00", time.UTC); err == nil {
+		t.Error("expected error for invalid time of day, got nil")
+	}
+
+	day, _ := parseQuietHours("12:00", "13:30", time.UTC)
+	night, _ := parseQuietHours("22:00", "07:00", time.UTC)
+
+	tests := []struct {
+		hour, minute int
+		wantDay      bool
+		wantNight    bool
+	}{
+		{hour: 11, minute: 59},
+		{hour: 12, minute: 0, wantDay: true},
+		{hour: 13, minute: 29, wantDay: true},
+		{hour: 13, minute: 30},
+		{hour: 22, minute: 0, wantNight: true},
+		{hour: 3, minute: 0, wantNight: true},
+		{hour: 7, minute: 0},
+	}
+
+	for _, tt := range tests {
+		at := time.Date(2026, 1, 2, tt.hour, tt.minute, 0, 0, time.UTC)
+		if got := day.contains(at); got != tt.wantDay {
+			t.Errorf("day.contains(%s) = %v, want %v", at.Format("15:04"), got, tt.wantDay)
+		}
+		if got := night.contains(at); got != tt.wantNight {
+			t.Errorf("night.contains(%s) = %v, want %v", at.Format("15:04"), got, tt.wantNight)
+		}
+	}
+}
+
+func TestQuietHoursEnd(t *testing.T) {
+	seoul, _ := time.LoadLocation("Asia/Seoul")
+	night, _ := parseQuietHours("22:00", "07:00", seoul)
+
+	tests := []struct {
+		after time.Time
+		want  time.Time
+	}{
+		{after: time.Date(2026, 1, 2, 23, 0, 0, 0, seoul), want: time.Date(2026, 1, 3, 7, 0, 0, 0, seoul)},
+		{after: time.Date(2026, 1, 3, 3, 0, 0, 0, seoul), want: time.Date(2026, 1, 3, 7, 0, 0, 0, seoul)},
+		{after: time.Date(2026, 1, 3, 7, 0, 0, 0, seoul), want: time.Date(2026, 1, 4, 7, 0, 0, 0, seoul)},
+		{after: time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC), want: time.Date(2026, 1, 3, 7, 0, 0, 0, seoul)}, // 21:00 in seoul
+	}
+
+	for _, tt := range tests {
+		if got := night.end(tt.after); !got.Equal(tt.want) {
+			t.Errorf("end(%s) = %s, want %s", tt.after, got, tt.want)
+		}
+	}
+}
+
+func TestDeferredItems(t *testing.T) {
+	_, store := newTestFeedStore(t)
+
+	published := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := store.deferItems([]gofeed.Feed{{Items: []*gofeed.Item{
+		{GUID: "a", Title: "A", Link: "https://example.com/a", PublishedParsed: &published},
+		{GUID: "b", Title: "B", Link: "https://example.com/b"},
+	}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// deferring again should not duplicate them
+	if err := store.deferItems([]gofeed.Feed{{Items: []*gofeed.Item{{GUID: "a", Title: "A"}}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := store.deferredItems()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("expected 2 deferred items, got %d", len(items))
+	}
+
+	// cached ones are pruned
+	insertTestCachedItems(t, store, rf.CachedItem{GUID: "a"})
+	if err := store.prune(); err != nil {
+		t.Fatal(err)
+	}
+	if items, _ = store.deferredItems(); len(items) != 1 || items[0].GUID != "b" || items[0].Link != "https://example.com/b" {
+		t.Errorf("unexpected deferred items after pruning: %+v", items)
+	}
+}
@@ -0,0 +1,226 @@
+// scheduler.go
+
+package main
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// limiter type (a semaphore for limiting concurrency, unlimited if nil)
+type limiter chan struct{}
+
+// create a new limiter with given `limit` (unlimited if <= 0)
+func newLimiter(limit int) limiter {
+	if limit <= 0 {
+		return nil
+	}
+	return make(limiter, limit)
+}
+
+// acquire a slot of the limiter, waiting until one is available or `ctx` is done
+func (l limiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release an acquired slot of the limiter
+func (l limiter) release() {
+	if l != nil {
+		<-l
+	}
+}
+
+// tickRequest struct (a requested tick of a feed)
+type tickRequest struct {
+	f *feed
+
+	drainOnly bool // only summarize deferred items, without fetching sources
+}
+
+// scheduler struct
+//
+// runs ticks of feeds with a limited number of workers. requested feeds are queued in order
+// (at most once each, until their ticks are done), so that feeds are processed in a round-robin manner.
+type scheduler struct {
+	queue chan tickRequest
+
+	mu      sync.Mutex
+	pending map[*feed]bool // queued or running
+
+	maxTicks int
+}
+
+// create a new scheduler for given `feeds`, running up to `maxTicks` ticks at a time
+func newScheduler(feeds []*feed, maxTicks int) *scheduler {
+	return &scheduler{
+		queue:    make(chan tickRequest, len(feeds)),
+		pending:  map[*feed]bool{},
+		maxTicks: max(maxTicks, 1),
+	}
+}
+
+// request a tick of given feed
+//
+// returns false if the feed is already queued or running.
+func (s *scheduler) request(f *feed) bool {
+	return s.enqueue(tickRequest{f: f})
+}
+
+// request a tick of given feed which only summarizes its deferred items (eg. when its quiet hours end)
+//
+// returns false if the feed is already queued or running.
+func (s *scheduler) requestDrain(f *feed) bool {
+	return s.enqueue(tickRequest{f: f, drainOnly: true})
+}
+
+// queue given tick request (at most once for each feed)
+func (s *scheduler) enqueue(req tickRequest) bool {
+	f := req.f
+
+	s.mu.Lock()
+	if s.pending[f] {
+		s.mu.Unlock()
+		return false
+	}
+	s.pending[f] = true
+	s.mu.Unlock()
+
+	s.queue <- req // (never blocks: each feed is queued at most once)
+	return true
+}
+
+// run workers which process the requested ticks with `process`, until `ctx` is done
+//
+// (`drainOnly` is true for ticks which only summarize deferred items)
+func (s *scheduler) run(ctx context.Context, process func(ctx context.Context, f *feed, drainOnly bool)) {
+	for range s.maxTicks {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case req := <-s.queue:
+					process(ctx, req.f, req.drainOnly)
+
+					s.mu.Lock()
+					delete(s.pending, req.f)
+					s.mu.Unlock()
+				}
+			}
+		}()
+	}
+}
+
+// random jitter in [0, `maxJitter`)
+func jitter(maxJitter time.Duration) time.Duration {
+	if maxJitter <= 0 {
+		return 0
+	}
+	return rand.N(maxJitter)
+}
+
+// wait for given duration, or until `ctx` is done (returns false then)
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// request ticks of given feed on its minimum interval (after a jittered start), until `ctx` is done
+func requestPeriodically(ctx context.Context, s *scheduler, f *feed, conf config) {
+	if !sleep(ctx, jitter(time.Duration(conf.TickJitterSeconds)*time.Second)) {
+		return
+	}
+	s.request(f)
+
+	ticker := time.NewTicker(time.Duration(conf.FetchFeedsMinIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !s.request(f) && conf.Verbose {
+				log.Printf(">>> skipping tick of '%s' (previous one is not done yet)", f.conf.Name)
+			}
+		}
+	}
+}
+
+// request ticks of given feed on its (jittered) schedule, until `ctx` is done
+//
+// when its quiet hours end before the next scheduled time, a tick for summarizing
+// the items deferred in the quiet hours is requested then. (sources are not fetched off the schedule)
+func requestOnSchedule(ctx context.Context, s *scheduler, f *feed, conf config) {
+	for {
+		now := time.Now()
+		next := f.schedule.next(now)
+		if next.IsZero() {
+			log.Printf("# no more scheduled times for '%s'", f.conf.Name)
+			return
+		}
+
+		drain := false
+		if f.quietHours != nil {
+			if end := f.quietHours.end(now); end.Before(next) {
+				next, drain = end, true
+			}
+		}
+
+		if !sleep(ctx, time.Until(next)+jitter(time.Duration(conf.TickJitterSeconds)*time.Second)) {
+			return
+		}
+		if drain {
+			if !s.requestDrain(f) && conf.Verbose {
+				log.Printf(">>> skipping draining deferred items of '%s' (previous tick is not done yet)", f.conf.Name)
+			}
+		} else if !s.request(f) && conf.Verbose {
+			log.Printf(">>> skipping tick of '%s' (previous one is not done yet)", f.conf.Name)
+		}
+	}
+}
+
+// split items of given feeds `fs` into ones within `maxItems` and the rest (no limit if <= 0)
+func limitItems(fs []gofeed.Feed, maxItems int) (limited, rest []gofeed.Feed) {
+	if maxItems <= 0 {
+		return fs, nil
+	}
+
+	remaining := maxItems
+	for _, f := range fs {
+		n := min(len(f.Items), remaining)
+		remaining -= n
+
+		if n > 0 {
+			within := f
+			within.Items = f.Items[:n]
+			limited = append(limited, within)
+		}
+		if n < len(f.Items) {
+			over := f
+			over.Items = f.Items[n:]
+			rest = append(rest, over)
+		}
+	}
+	return limited, rest
+}
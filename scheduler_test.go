@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestLimiter(t *testing.T) {
+	// unlimited
+	unlimited := newLimiter(0)
+	for range 10 {
+		if err := unlimited.acquire(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	unlimited.release()
+
+	// limited
+	l := newLimiter(1)
+	if err := l.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.acquire(ctx); err == nil {
+		t.Error("expected error while the limiter is full, got nil")
+	}
+	l.release()
+	if err := l.acquire(context.Background()); err != nil {
+		t.Errorf("expected a released slot to be acquired, got %s", err)
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	feeds := []*feed{
+		{conf: configRSSFeed{Name: "a"}},
+		{conf: configRSSFeed{Name: "b"}},
+		{conf: configRSSFeed{Name: "c"}},
+	}
+	s := newScheduler(feeds, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var running, maxRunning atomic.Int32
+	var mu sync.Mutex
+	processed := []string{}
+	release := make(chan struct{})
+
+	// queue all feeds before running workers
+	for _, f := range feeds {
+		if !s.request(f) {
+			t.Fatalf("expected tick of '%s' to be requested", f.conf.Name)
+		}
+	}
+	if s.request(feeds[0]) {
+		t.Errorf("expected a queued feed not to be requested again")
+	}
+
+	s.run(ctx, func(ctx context.Context, f *feed, drainOnly bool) {
+		n := running.Add(1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+
+		<-release
+
+		mu.Lock()
+		processed = append(processed, f.conf.Name)
+		mu.Unlock()
+		running.Add(-1)
+	})
+
+	for range feeds {
+		release <- struct{}{}
+	}
+
+	// wait for the last tick to be done
+	deadline := time.Now().Add(time.Second)
+	for {
+		mu.Lock()
+		n := len(processed)
+		mu.Unlock()
+		if n == len(feeds) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if len(processed) != len(feeds) {
+		t.Fatalf("expected %d ticks, got %v", len(feeds), processed)
+	}
+	if maxRunning.Load() > 2 {
+		t.Errorf("expected at most 2 concurrent ticks, got %d", maxRunning.Load())
+	}
+
+	// done feeds can be requested again
+	deadline = time.Now().Add(time.Second)
+	for !s.request(feeds[0]) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected a done feed to be requested again")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	release <- struct{}{}
+}
+
+func TestSchedulerRequestDrain(t *testing.T) {
+	f := &feed{conf: configRSSFeed{Name: "a"}}
+	s := newScheduler([]*feed{f}, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if !s.requestDrain(f) {
+		t.Fatal("expected a drain of 'a' to be requested")
+	}
+	if s.request(f) {
+		t.Error("expected a feed with a queued drain not to be requested again")
+	}
+
+	drained := make(chan bool, 1)
+	s.run(ctx, func(ctx context.Context, f *feed, drainOnly bool) {
+		drained <- drainOnly
+	})
+
+	select {
+	case drainOnly := <-drained:
+		if !drainOnly {
+			t.Error("expected a tick only for draining deferred items")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the drain to be processed")
+	}
+}
+
+func TestJitter(t *testing.T) {
+	if got := jitter(0); got != 0 {
+		t.Errorf("expected no jitter, got %s", got)
+	}
+	for range 100 {
+		if got := jitter(time.Second); got < 0 || got >= time.Second {
+			t.Errorf("jitter out of range: %s", got)
+		}
+	}
+}
+
+func TestLimitItems(t *testing.T) {
+	fs := []gofeed.Feed{
+		{Title: "deferred", Items: []*gofeed.Item{{GUID: "1"}, {GUID: "2"}}},
+		{Title: "fetched", Items: []*gofeed.Item{{GUID: "3"}, {GUID: "4"}, {GUID: "5"}}},
+	}
+
+	tests := []struct {
+		maxItems    int
+		wantLimited int
+		wantRest    int
+	}{
+		{maxItems: 0, wantLimited: 5, wantRest: 0},
+		{maxItems: 1, wantLimited: 1, wantRest: 4},
+		{maxItems: 3, wantLimited: 3, wantRest: 2},
+		{maxItems: 10, wantLimited: 5, wantRest: 0},
+	}
+
+	for _, tt := range tests {
+		limited, rest := limitItems(fs, tt.maxItems)
+		if numItems(limited) != tt.wantLimited || numItems(rest) != tt.wantRest {
+			t.Errorf("limitItems(%d) = %d, %d items, want %d, %d", tt.maxItems, numItems(limited), numItems(rest), tt.wantLimited, tt.wantRest)
+		}
+	}
+
+	// items keep their order
+	limited, rest := limitItems(fs, 3)
+	if limited[0].Items[0].GUID != "1" || limited[1].Items[0].GUID != "3" || rest[0].Items[0].GUID != "4" || rest[0].Title != "fetched" {
+		t.Errorf("unexpected order of items: %+v, %+v", limited, rest)
+	}
+}
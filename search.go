@@ -0,0 +1,425 @@
+// search.go
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+
+	rf "github.com/meinside/rss-feeds-go"
+)
+
+const (
+	searchServePath = "/search"
+
+	defaultSearchResultsLimit = 20
+	maxSearchResultsLimit     = 100
+
+	searchSnippetMaxRunes = 300
+
+	searchFeedItemsLimit = 100 // max number of matches per source feed
+
+	// BM25 parameters
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// NOTE: FTS5 is not compiled into go-sqlite3 without the `sqlite_fts5` build tag,
+// so the index is an FTS4 table, ranked with BM25 computed from `matchinfo()`.
+const (
+	searchIndexTableName = `cached_items_fts`
+
+	searchIndexCreateSQL = `CREATE VIRTUAL TABLE IF NOT EXISTS ` + searchIndexTableName + ` USING fts4(
+	guid, link, publish_date, title, summary, description,
+	notindexed=guid, notindexed=link, notindexed=publish_date,
+	tokenize=unicode61
+)`
+
+	// (rows of `cached_items` are copied into the index as they are)
+	searchIndexInsertSQL = `INSERT INTO ` + searchIndexTableName + ` (guid, link, publish_date, title, summary, description)
+	SELECT guid, link, publish_date, title, summary, description FROM cached_items WHERE deleted_at IS NULL`
+
+	// 'pcnalx': phrases, columns, rows, average tokens, row tokens, hits
+	searchIndexMatchinfoFormat = `pcnalx`
+)
+
+// weights of the search index's columns (guid, link, publish_date, title, summary, description)
+var _searchIndexColumnWeights = []float64{0, 0, 0, 2, 1, 0.5}
+
+// searchResult struct
+type searchResult struct {
+	Feed        string  `json:"feed"`
+	GUID        string  `json:"guid"`
+	Title       string  `json:"title"`
+	Link        string  `json:"link"`
+	PublishDate string  `json:"publish_date,omitempty"`
+	Summary     string  `json:"summary"`
+	Score       float64 `json:"score"`
+}
+
+// searchIndexRow struct
+type searchIndexRow struct {
+	GUID        string
+	Link        string
+	PublishDate string
+	Title       string
+	Summary     string
+	Matchinfo   []byte
+}
+
+// create the search index table if it does not exist
+//
+// (indices without some columns are dropped and created again, for being rebuilt from the cache)
+func (s *feedStore) migrateSearchIndex() error {
+	if err := s.db.Exec(searchIndexCreateSQL).Error; err != nil {
+		return err
+	}
+	if err := s.db.Exec(`SELECT description FROM ` + searchIndexTableName + ` LIMIT 0`).Error; err != nil {
+		if err := s.db.Exec(`DROP TABLE ` + searchIndexTableName).Error; err != nil {
+			return fmt.Errorf("failed to drop outdated search index: %w", err)
+		}
+		return s.db.Exec(searchIndexCreateSQL).Error
+	}
+	return nil
+}
+
+// index (or re-index) cached items with given `guids`, with their current rows
+func (s *feedStore) indexItems(guids []string) error {
+	if len(guids) == 0 {
+		return nil
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`DELETE FROM `+searchIndexTableName+` WHERE guid IN ?`, guids).Error; err != nil {
+			return fmt.Errorf("failed to delete indices of items: %w", err)
+		}
+		if err := tx.Exec(searchIndexInsertSQL+` AND guid IN ?`, guids).Error; err != nil {
+			return fmt.Errorf("failed to index items: %w", err)
+		}
+		return nil
+	})
+}
+
+// index cached items which are not indexed yet
+func (s *feedStore) indexUnindexedItems() error {
+	if err := s.db.Exec(searchIndexInsertSQL + ` AND guid NOT IN (SELECT guid FROM ` + searchIndexTableName + `)`).Error; err != nil {
+		return fmt.Errorf("failed to index unindexed items: %w", err)
+	}
+	return nil
+}
+
+// delete indexed items which were deleted from the cache
+func (s *feedStore) pruneSearchIndex() error {
+	return s.db.Exec(`DELETE FROM ` + searchIndexTableName + ` WHERE guid NOT IN (SELECT guid FROM cached_items)`).Error
+}
+
+// search indexed items with given `query`, ranked by relevance
+func (s *feedStore) search(query string, limit int) (results []searchResult, err error) {
+	match := ftsMatchExpression(query)
+	if match == "" {
+		return nil, nil
+	}
+
+	var rows []searchIndexRow
+	if err = s.db.Raw(
+		`SELECT guid, link, publish_date, title, summary, matchinfo(`+searchIndexTableName+`, '`+searchIndexMatchinfoFormat+`') AS matchinfo
+		FROM `+searchIndexTableName+` WHERE `+searchIndexTableName+` MATCH ?`,
+		match,
+	).Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to search with query '%s': %w", query, err)
+	}
+
+	for _, row := range rows {
+		results = append(results, searchResult{
+			GUID:        row.GUID,
+			Title:       row.Title,
+			Link:        row.Link,
+			PublishDate: row.PublishDate,
+			Summary:     row.Summary,
+			Score:       bm25(row.Matchinfo, _searchIndexColumnWeights),
+		})
+	}
+	sortSearchResults(results)
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil
+}
+
+// search all given feeds with `query`, and merge results by their ranks in each feed
+//
+// NOTE: BM25 scores depend on the statistics (number of rows, average lengths, ...)
+// of each feed's own index, so they are not comparable across feeds.
+// results are ranked in each feed, then interleaved: all first-ranked results come first,
+// (ordered by their publish dates) then all second-ranked ones, and so on.
+func searchFeeds(feeds []*feed, query string, limit int) (results []searchResult, err error) {
+	ranked := [][]searchResult{}
+	for _, f := range feeds {
+		if found, err := f.store.search(query, limit); err == nil {
+			for i := range found {
+				found[i].Feed = f.conf.Name
+			}
+			ranked = append(ranked, found)
+		} else {
+			return nil, err
+		}
+	}
+
+	return interleaveSearchResults(ranked, limit), nil
+}
+
+// interleave given per-feed `ranked` results by their ranks, up to `limit` results
+func interleaveSearchResults(ranked [][]searchResult, limit int) (results []searchResult) {
+	for rank := 0; len(results) < limit; rank++ {
+		same := []searchResult{}
+		for _, found := range ranked {
+			if rank < len(found) {
+				same = append(same, found[rank])
+			}
+		}
+		if len(same) == 0 {
+			break
+		}
+		slices.SortStableFunc(same, func(a, b searchResult) int {
+			return strings.Compare(b.PublishDate, a.PublishDate)
+		})
+		results = append(results, same...)
+	}
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results
+}
+
+// list cached items of source feeds which match the query of given `searchFeed`
+//
+// returns matched items (deduplicated by GUID, newest first) and a client for publishing them.
+func searchFeedItems(searchFeed configSearchFeed, feeds []*feed) (items []rf.CachedItem, client *rf.Client, err error) {
+	seen := map[string]bool{}
+	for _, f := range feeds {
+		if len(searchFeed.FeedNames) > 0 && !slices.Contains(searchFeed.FeedNames, f.conf.Name) {
+			continue
+		}
+		if client == nil {
+			client = f.client
+		}
+
+		var results []searchResult
+		if results, err = f.store.search(searchFeed.Query, searchFeedItemsLimit); err != nil {
+			return nil, nil, err
+		}
+		guids := []string{}
+		for _, result := range results {
+			guids = append(guids, result.GUID)
+		}
+
+		// (loaded directly, as listed items of rss-feeds-go are limited to the newest ones)
+		var matched []rf.CachedItem
+		if matched, err = f.store.cachedItemsOf(guids); err != nil {
+			return nil, nil, fmt.Errorf("failed to load matched items of '%s': %w", f.conf.Name, err)
+		}
+		for _, item := range matched {
+			if !seen[item.GUID] {
+				seen[item.GUID] = true
+				items = append(items, item)
+			}
+		}
+	}
+	if client == nil {
+		return nil, nil, fmt.Errorf("no source feed is available for search feed '%s'", searchFeed.Name)
+	}
+
+	slices.SortStableFunc(items, func(a, b rf.CachedItem) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+
+	if searchFeed.DropItemsWithFailedSummaries {
+		items = dropItemsWithFailedSummaries(items)
+	}
+
+	return items, client, nil
+}
+
+// sort search results by score (descending), then by publish date (descending)
+func sortSearchResults(results []searchResult) {
+	slices.SortStableFunc(results, func(a, b searchResult) int {
+		if a.Score != b.Score {
+			if a.Score > b.Score {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(b.PublishDate, a.PublishDate)
+	})
+}
+
+// convert user's free-form `query` into an FTS MATCH expression
+//
+// each whitespace-separated term becomes a quoted prefix query, (implicitly AND-ed)
+// so that FTS syntax characters in user input cannot cause syntax errors.
+func ftsMatchExpression(query string) string {
+	var terms []string
+	for term := range strings.FieldsSeq(query) {
+		term = strings.ReplaceAll(term, `"`, ``)
+		if term == "" {
+			continue
+		}
+		terms = append(terms, `"`+term+`*"`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// calculate BM25 score from the blob of `matchinfo(..., 'pcnalx')`
+func bm25(matchinfo []byte, weights []float64) (score float64) {
+	if len(matchinfo)%4 != 0 {
+		return 0
+	}
+	values := make([]uint32, len(matchinfo)/4)
+	for i := range values {
+		values[i] = binary.NativeEndian.Uint32(matchinfo[i*4:])
+	}
+	if len(values) < 3 {
+		return 0
+	}
+
+	numPhrases, numColumns, numRows := int(values[0]), int(values[1]), float64(values[2])
+	avgLengths := values[3:]
+	if len(avgLengths) < numColumns*2+numPhrases*numColumns*3 {
+		return 0
+	}
+	rowLengths := values[3+numColumns:]
+	hits := values[3+numColumns*2:]
+
+	for p := range numPhrases {
+		for c := range numColumns {
+			if c >= len(weights) || weights[c] == 0 {
+				continue
+			}
+
+			hitsInRow := float64(hits[(p*numColumns+c)*3])
+			rowsWithHits := float64(hits[(p*numColumns+c)*3+2])
+			if hitsInRow == 0 {
+				continue
+			}
+
+			idf := math.Log((numRows-rowsWithHits+0.5)/(rowsWithHits+0.5) + 1)
+			avgLength := math.Max(float64(avgLengths[c]), 1)
+			rowLength := float64(rowLengths[c])
+
+			score += weights[c] * idf * (hitsInRow * (bm25K1 + 1)) /
+				(hitsInRow + bm25K1*(1-bm25B+bm25B*rowLength/avgLength))
+		}
+	}
+
+	return score
+}
+
+// html template for search results
+var _searchResultsHTML = template.Must(template.New("search").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Search: {{.Query}}</title>
+</head>
+<body>
+<form action="{{.Path}}" method="get">
+<input type="search" name="q" value="{{.Query}}">
+<button type="submit">Search</button>
+</form>
+{{if .Query}}<p>{{len .Results}} result(s) for <strong>{{.Query}}</strong></p>{{end}}
+<ol>
+{{range .Results}}<li>
+<a href="{{.Link}}">{{.Title}}</a> <small>[{{.Feed}}]{{if .PublishDate}} {{.PublishDate}}{{end}}</small>
+<p>{{.Snippet}}</p>
+</li>
+{{end}}</ol>
+</body>
+</html>
+`))
+
+// searchResultHTML struct for rendering a search result in html
+type searchResultHTML struct {
+	searchResult
+
+	Snippet string
+}
+
+// handle http requests for searching cached items of all feeds
+//
+// `q` is the query, `limit` is the max number of results,
+// and `format=json` (or `Accept: application/json`) responds with JSON instead of HTML.
+func handleSearch(conf config, feeds []*feed) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requestPermitted(r, conf) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		limit := defaultSearchResultsLimit
+		if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+			limit = min(l, maxSearchResultsLimit)
+		}
+
+		results, err := searchFeeds(feeds, query, limit)
+		if err != nil {
+			log.Printf("# failed to search: %s", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if results == nil {
+			results = []searchResult{}
+		}
+
+		if r.URL.Query().Get("format") == "json" ||
+			strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(map[string]any{
+				"query":   query,
+				"results": results,
+			}); err != nil {
+				log.Printf("# failed to write search results: %s", err)
+			}
+			return
+		}
+
+		rendered := []searchResultHTML{}
+		for _, result := range results {
+			rendered = append(rendered, searchResultHTML{
+				searchResult: result,
+				Snippet:      truncateRunes(result.Summary, searchSnippetMaxRunes),
+			})
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := _searchResultsHTML.Execute(w, map[string]any{
+			"Path":    r.URL.Path,
+			"Query":   query,
+			"Results": rendered,
+		}); err != nil {
+			log.Printf("# failed to write search results: %s", err)
+		}
+	}
+}
+
+// truncate given string `s` to `maxRunes` runes
+func truncateRunes(s string, maxRunes int) string {
+	runes := []rune(s)
+	if len(runes) <= maxRunes {
+		return s
+	}
+	return string(runes[:maxRunes]) + "…"
+}
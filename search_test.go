@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	rf "github.com/meinside/rss-feeds-go"
+)
+
+func TestFTSMatchExpression(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "", want: ""},
+		{query: "   ", want: ""},
+		{query: "go", want: `"go*"`},
+		{query: "go  sqlite", want: `"go*" "sqlite*"`},
+		{query: `"quoted" OR -x`, want: `"quoted*" "OR*" "-x*"`},
+		{query: `""`, want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := ftsMatchExpression(tt.query); got != tt.want {
+			t.Errorf("ftsMatchExpression(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestFeedStoreSearch(t *testing.T) {
+	_, store := newTestFeedStore(t)
+
+	insertTestCachedItems(t, store,
+		rf.CachedItem{GUID: "1", Title: "SQLite full-text search", Summary: "About FTS indices.", PublishDate: "2026-01-01T00:00:00Z"},
+		rf.CachedItem{GUID: "2", Title: "Go generics", Summary: "Generics in Go, and SQLite drivers.", Description: "<p>Also discussed at: lobsters</p>", PublishDate: "2026-01-02T00:00:00Z"},
+		rf.CachedItem{GUID: "3", Title: "Cooking", Summary: "Nothing related.", PublishDate: "2026-01-03T00:00:00Z"},
+	)
+	if err := store.indexItems([]string{"1", "2", "3"}); err != nil {
+		t.Fatalf("indexItems() error: %s", err)
+	}
+
+	results, err := store.search("sqlite", 10)
+	if err != nil {
+		t.Fatalf("search() error: %s", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d: %v", len(results), results)
+	}
+	// title matches are weighted higher than summary matches
+	if results[0].GUID != "1" {
+		t.Errorf("expected item '1' to be ranked first, got %v", results)
+	}
+	if results[0].Score <= results[1].Score {
+		t.Errorf("expected descending scores, got %v", results)
+	}
+
+	// prefix match
+	if results, err := store.search("gener", 10); err != nil || len(results) != 1 || results[0].GUID != "2" {
+		t.Errorf("unexpected prefix search results: %v (%v)", results, err)
+	}
+
+	// limit
+	if results, err := store.search("sqlite", 1); err != nil || len(results) != 1 {
+		t.Errorf("unexpected limited search results: %v (%v)", results, err)
+	}
+
+	// re-indexed whenever rewritten
+	if err := store.updateTitle("3", "Cooking with SQLite"); err != nil {
+		t.Fatalf("updateTitle() error: %s", err)
+	}
+	if results, err := store.search("cooking", 10); err != nil || len(results) != 1 || results[0].Title != "Cooking with SQLite" {
+		t.Errorf("unexpected re-indexed search results: %v (%v)", results, err)
+	}
+	if err := store.saveSummary(gofeed.Item{GUID: "2"}, "Go generics", "Generics in Go."); err != nil {
+		t.Fatalf("saveSummary() error: %s", err)
+	}
+	if results, err := store.search("drivers", 10); err != nil || len(results) != 0 {
+		t.Errorf("expected the previous summary to be re-indexed, got %v (%v)", results, err)
+	}
+	if results, err := store.search("lobsters", 10); err != nil || len(results) != 1 || results[0].GUID != "2" {
+		t.Errorf("expected the description to be indexed, got %v (%v)", results, err)
+	}
+}
+
+func TestFeedStoreIndexUnindexedItems(t *testing.T) {
+	_, store := newTestFeedStore(t)
+
+	// (more than the listed items of rss-feeds-go)
+	items := []rf.CachedItem{}
+	for i := range 150 {
+		items = append(items, rf.CachedItem{GUID: fmt.Sprintf("%d", i), Title: fmt.Sprintf("Item %d", i), Summary: "summary"})
+	}
+	insertTestCachedItems(t, store, items...)
+	if err := store.indexItems([]string{"0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 { // (not indexed twice)
+		if err := store.indexUnindexedItems(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if results, err := store.search("summary", 1000); err != nil || len(results) != 150 {
+		t.Errorf("expected all items to be indexed once, got %d (%v)", len(results), err)
+	}
+}
+
+func TestInterleaveSearchResults(t *testing.T) {
+	ranked := [][]searchResult{
+		{{GUID: "a1", Score: 9.0, PublishDate: "2026-01-01"}, {GUID: "a2", Score: 8.0}, {GUID: "a3", Score: 7.0}},
+		{{GUID: "b1", Score: 0.5, PublishDate: "2026-01-02"}},
+		{},
+		{{GUID: "c1", Score: 1.0}, {GUID: "c2", Score: 0.1}},
+	}
+
+	tests := []struct {
+		limit int
+		want  []string
+	}{
+		{limit: 10, want: []string{"b1", "a1", "c1", "a2", "c2", "a3"}},
+		{limit: 4, want: []string{"b1", "a1", "c1", "a2"}},
+		{limit: 1, want: []string{"b1"}},
+	}
+
+	for _, tt := range tests {
+		guids := []string{}
+		for _, result := range interleaveSearchResults(ranked, tt.limit) {
+			guids = append(guids, result.GUID)
+		}
+		if !slices.Equal(guids, tt.want) {
+			t.Errorf("interleaveSearchResults(limit: %d) = %v, want %v", tt.limit, guids, tt.want)
+		}
+	}
+
+	if results := interleaveSearchResults(nil, 10); len(results) != 0 {
+		t.Errorf("expected no results, got %v", results)
+	}
+}
+
+func TestFeedStorePruneSearchIndex(t *testing.T) {
+	_, store := newTestFeedStore(t)
+
+	insertTestCachedItems(t, store,
+		rf.CachedItem{GUID: "kept", Title: "kept item"},
+		rf.CachedItem{GUID: "deleted", Title: "deleted item"},
+	)
+	if err := store.indexItems([]string{"kept", "deleted"}); err != nil {
+		t.Fatalf("indexItems() error: %s", err)
+	}
+	if err := store.db.Unscoped().Where("guid = ?", "deleted").Delete(&rf.CachedItem{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.pruneSearchIndex(); err != nil {
+		t.Fatalf("pruneSearchIndex() error: %s", err)
+	}
+
+	results, err := store.search("item", 10)
+	if err != nil {
+		t.Fatalf("search() error: %s", err)
+	}
+	if len(results) != 1 || results[0].GUID != "kept" {
+		t.Errorf("expected only 'kept' item, got %v", results)
+	}
+}
+
+func TestHandleSearch(t *testing.T) {
+	_, store1 := newTestFeedStore(t)
+	_, store2 := newTestFeedStore(t)
+
+	insertTestCachedItems(t, store1, rf.CachedItem{GUID: "a", Title: "Rust release", Summary: "rust"})
+	insertTestCachedItems(t, store2, rf.CachedItem{GUID: "b", Title: "Rust <b>in</b> kernel", Summary: "kernel"})
+	if err := store1.indexItems([]string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store2.indexItems([]string{"b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	feeds := []*feed{
+		{conf: configRSSFeed{Name: "one"}, store: store1},
+		{conf: configRSSFeed{Name: "two"}, store: store2},
+	}
+	handler := handleSearch(config{}, feeds)
+
+	t.Run("json", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, "/search?q=rust&format=json", nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("unexpected status: %d", w.Code)
+		}
+
+		var body struct {
+			Query   string         `json:"query"`
+			Results []searchResult `json:"results"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if len(body.Results) != 2 {
+			t.Fatalf("expected 2 results, got %v", body.Results)
+		}
+		feedNames := []string{body.Results[0].Feed, body.Results[1].Feed}
+		if !strings.Contains(strings.Join(feedNames, ","), "one") || !strings.Contains(strings.Join(feedNames, ","), "two") {
+			t.Errorf("expected results from both feeds, got %v", feedNames)
+		}
+	})
+
+	t.Run("html", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, "/search?q=kernel", nil))
+
+		if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+			t.Errorf("unexpected content type: %s", w.Header().Get("Content-Type"))
+		}
+		if !strings.Contains(w.Body.String(), "Rust &lt;b&gt;in&lt;/b&gt; kernel") {
+			t.Errorf("expected escaped title in html, got %s", w.Body.String())
+		}
+	})
+
+	t.Run("not permitted", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handleSearch(config{PermittedUserAgents: []string{"Feedly"}}, feeds)(w, httptest.NewRequest(http.MethodGet, "/search?q=rust", nil))
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("expected status %d, got %d", http.StatusUnauthorized, w.Code)
+		}
+	})
+}
+
+func TestSearchFeedItems(t *testing.T) {
+	client1, store1 := newTestFeedStore(t)
+	client2, store2 := newTestFeedStore(t)
+
+	now := time.Now()
+	items1 := []rf.CachedItem{
+		{GUID: "a", Title: "CVE-2026-0001 in openssl", Summary: "patch now"},
+		{GUID: "b", Title: "New laptop", Summary: "nothing to see"},
+	}
+	items2 := []rf.CachedItem{
+		{GUID: "c", Title: "Kernel bug", Summary: "tracked as CVE-2026-0002"},
+		{GUID: "d", Title: "Failed one", Summary: rf.ErrorPrefixSummaryFailedWithError + ": CVE"},
+	}
+	items1[0].CreatedAt = now.Add(-time.Hour)
+	items2[0].CreatedAt = now
+	insertTestCachedItems(t, store1, items1...)
+	insertTestCachedItems(t, store2, items2...)
+	if err := store1.indexUnindexedItems(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store2.indexUnindexedItems(); err != nil {
+		t.Fatal(err)
+	}
+
+	feeds := []*feed{
+		{conf: configRSSFeed{Name: "one"}, client: client1, store: store1},
+		{conf: configRSSFeed{Name: "two"}, client: client2, store: store2},
+	}
+
+	t.Run("all feeds", func(t *testing.T) {
+		items, client, err := searchFeedItems(configSearchFeed{Name: "cve", Query: "CVE", DropItemsWithFailedSummaries: true}, feeds)
+		if err != nil {
+			t.Fatalf("searchFeedItems() error: %s", err)
+		}
+		if client == nil {
+			t.Error("expected a client for publishing")
+		}
+		if len(items) != 2 || items[0].GUID != "c" || items[1].GUID != "a" {
+			t.Errorf("unexpected items: %v", items)
+		}
+	})
+
+	t.Run("selected feeds", func(t *testing.T) {
+		items, _, err := searchFeedItems(configSearchFeed{Name: "cve", Query: "CVE", FeedNames: []string{"one"}}, feeds)
+		if err != nil {
+			t.Fatalf("searchFeedItems() error: %s", err)
+		}
+		if len(items) != 1 || items[0].GUID != "a" {
+			t.Errorf("unexpected items: %v", items)
+		}
+	})
+
+	t.Run("no source feed", func(t *testing.T) {
+		if _, _, err := searchFeedItems(configSearchFeed{Name: "cve", Query: "CVE", FeedNames: []string{"none"}}, feeds); err == nil {
+			t.Error("expected error for no source feed, got nil")
+		}
+	})
+}
+
+func TestSearchFeedItems_Older(t *testing.T) {
+	client, store := newTestFeedStore(t)
+
+	// (more than the listed items of rss-feeds-go, with the only match being the oldest one)
+	now := time.Now()
+	items := []rf.CachedItem{}
+	for i := range 150 {
+		item := rf.CachedItem{GUID: fmt.Sprintf("%d", i), Title: fmt.Sprintf("Item %d", i), Summary: "nothing to see"}
+		if i == 0 {
+			item.Summary = "tracked as CVE-2026-0001"
+		}
+		item.CreatedAt = now.Add(time.Duration(i-150) * time.Hour)
+		items = append(items, item)
+	}
+	insertTestCachedItems(t, store, items...)
+	if err := store.indexUnindexedItems(); err != nil {
+		t.Fatal(err)
+	}
+
+	found, _, err := searchFeedItems(configSearchFeed{Name: "cve", Query: "CVE"}, []*feed{{conf: configRSSFeed{Name: "one"}, client: client, store: store}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].GUID != "0" {
+		t.Errorf("expected the oldest item to be found, got %v", found)
+	}
+}
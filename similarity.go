@@ -0,0 +1,253 @@
+// similarity.go
+
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math/bits"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mmcdole/gofeed"
+
+	ssg "github.com/meinside/simple-scrapper-go"
+)
+
+const (
+	simHashShingleSize = 3  // number of words in a shingle
+	simHashMinShingles = 20 // texts with fewer shingles are not fingerprinted
+
+	simHashBands            = 4 // number of (16-bit) bands of a fingerprint, for indexing
+	similarItemsMaxDistance = 3 // max hamming distance between fingerprints of similar items (should be < `simHashBands`)
+
+	scrapedTextKey = "scraped_text" // key of scraped (or combined) texts in `gofeed.Item.Custom`
+
+	similarSourceLabel = "Source" // label of links of similar items, appended to the descriptions of the items they are combined into
+)
+
+// contentFingerprint struct (fingerprint of a cached item's scraped content)
+//
+// fingerprints are also indexed by their bands, so that similar ones can be looked up without scanning all of them:
+// fingerprints within `similarItemsMaxDistance` bits share at least one band (of `simHashBands` > the distance).
+type contentFingerprint struct {
+	GUID    string `gorm:"primaryKey"`
+	SimHash int64  // (uint64 stored as int64)
+
+	Band0 int64 `gorm:"index"`
+	Band1 int64 `gorm:"index"`
+	Band2 int64 `gorm:"index"`
+	Band3 int64 `gorm:"index"`
+
+	CreatedAt time.Time
+}
+
+// calculate the 64-bit SimHash of given `text` over its word shingles
+//
+// `ok` is false when the text is too short to be fingerprinted.
+func simHash(text string) (hash uint64, ok bool) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	numShingles := len(words) - simHashShingleSize + 1
+	if numShingles < simHashMinShingles {
+		return 0, false
+	}
+
+	var weights [64]int
+	h := fnv.New64a()
+	for i := range numShingles {
+		h.Reset()
+		_, _ = h.Write([]byte(strings.Join(words[i:i+simHashShingleSize], " ")))
+		sum := h.Sum64()
+
+		for bit := range 64 {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	for bit, weight := range weights {
+		if weight > 0 {
+			hash |= 1 << bit
+		}
+	}
+	return hash, true
+}
+
+// hamming distance between two fingerprints
+func hammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// 16-bit bands of given fingerprint
+func simHashBandsOf(hash uint64) (bands [simHashBands]int64) {
+	for i := range simHashBands {
+		bands[i] = int64(hash >> (16 * i) & 0xffff)
+	}
+	return bands
+}
+
+// save the fingerprint of an item with given `guid`
+func (s *feedStore) saveFingerprint(guid string, hash uint64) error {
+	bands := simHashBandsOf(hash)
+	return s.db.Save(&contentFingerprint{
+		GUID:    guid,
+		SimHash: int64(hash),
+		Band0:   bands[0],
+		Band1:   bands[1],
+		Band2:   bands[2],
+		Band3:   bands[3],
+	}).Error
+}
+
+// get the guid of a fingerprinted item (other than `guid`) which is similar to given `hash`
+//
+// (only the fingerprints which share a band with `hash` are compared)
+func (s *feedStore) similarGUIDOf(guid string, hash uint64) (similar string, exists bool, err error) {
+	bands := simHashBandsOf(hash)
+
+	var fingerprints []contentFingerprint
+	if err = s.db.
+		Where("guid != ?", guid).
+		Where(s.db.Where("band0 = ?", bands[0]).Or("band1 = ?", bands[1]).Or("band2 = ?", bands[2]).Or("band3 = ?", bands[3])).
+		Order("created_at ASC").
+		Find(&fingerprints).Error; err != nil {
+		return "", false, err
+	}
+	for _, fingerprint := range fingerprints {
+		if hammingDistance(uint64(fingerprint.SimHash), hash) <= similarItemsMaxDistance {
+			return fingerprint.GUID, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// delete fingerprints of items which were deleted from the cache
+func (s *feedStore) pruneFingerprints() error {
+	return s.db.Where("guid NOT IN (SELECT guid FROM cached_items)").Delete(&contentFingerprint{}).Error
+}
+
+// scrape the plain text content of given `url`
+func scrapeText(scrapper *ssg.Scrapper, url string) (text string, err error) {
+	var crawled map[string]string
+	if crawled, err = scrapper.CrawlURLs([]string{url}, false); err == nil {
+		for _, v := range crawled {
+			// get the first (and the only one) value
+			return v, nil
+		}
+	}
+	return "", err
+}
+
+// get the text of given item which was scraped (or combined) before summarizing, if any
+func scrapedTextOf(item *gofeed.Item) string {
+	return item.Custom[scrapedTextKey]
+}
+
+// set the scraped (or combined) text of given item, for summarizing it without scraping again
+//
+// (kept in `gofeed.Item.Custom`, so that it is deferred with the item too)
+func setScrapedText(item *gofeed.Item, text string) {
+	if item.Custom == nil {
+		item.Custom = map[string]string{}
+	}
+	item.Custom[scrapedTextKey] = text
+}
+
+// append the text of given `source` to the combined text of `item` (which it is similar to)
+func appendSimilarText(item *gofeed.Item, source *gofeed.Item, text string) {
+	setScrapedText(item, fmt.Sprintf("%s\n\n---\n\nAlso reported as '%s' (%s):\n\n%s", scrapedTextOf(item), source.Title, source.Link, text))
+}
+
+// cluster items of given feeds `fs` whose scraped contents are near-identical
+// to those of already fingerprinted items, or of preceding items of `fs`
+//
+// scraped texts are kept in the items (see `scrapedTextOf`), so that they are summarized without being scraped again.
+// (items which were already scraped, eg. deferred ones, are not scraped again)
+// similar items are dropped and their texts are appended to the (combined) text of the first item of each cluster,
+// so that one summary is generated for each cluster. when the first one is already cached,
+// it is returned in `clustered` with its previous summary and the texts, for being summarized again.
+// dropped items are returned as `similars`, and should be recorded for appending their links as sources.
+func clusterSimilarItems(fs []gofeed.Feed, store *feedStore, scrape func(link string) (string, error), verbose bool) (clustered []gofeed.Feed, similars []duplicatedItem) {
+	firsts := map[string]*gofeed.Item{} // guid => first item of a cluster
+	cached := []*gofeed.Item{}          // cached items to be summarized again
+
+	// first item of the cluster which the item with given `guid` belongs to
+	firstOf := func(guid string) *gofeed.Item {
+		if first, exists := firsts[guid]; exists {
+			return first
+		}
+		if items, err := store.cachedItemsOf([]string{guid}); err != nil {
+			log.Printf("# failed to get cached item '%s': %s", guid, err)
+		} else if len(items) > 0 {
+			first := feedItemOf(items[0])
+			if !isFailedSummary(items[0].Summary) {
+				setScrapedText(first, fmt.Sprintf("(Previously summarized as:)\n\n%s", items[0].Summary))
+			}
+			firsts[guid] = first
+			cached = append(cached, first)
+			return first
+		}
+		return nil
+	}
+
+	for _, f := range fs {
+		f.Items = slices.DeleteFunc(slices.Clone(f.Items), func(item *gofeed.Item) bool {
+			if item.Link == "" {
+				return false
+			}
+
+			text := scrapedTextOf(item)
+			if text == "" {
+				var err error
+				if text, err = scrape(item.Link); err != nil {
+					if verbose {
+						log.Printf(">>> failed to scrape '%s' for fingerprinting: %s", item.Link, err)
+					}
+					return false
+				}
+				setScrapedText(item, text)
+			}
+
+			hash, ok := simHash(text)
+			if !ok {
+				return false
+			}
+
+			if guid, exists, err := store.similarGUIDOf(item.GUID, hash); err != nil {
+				log.Printf("# failed to check similar items of '%s': %s", item.GUID, err)
+			} else if exists {
+				if first := firstOf(guid); first != nil {
+					appendSimilarText(first, item, text)
+					similars = append(similars, duplicatedItem{
+						item:  item,
+						guid:  first.GUID,
+						label: similarSourceLabel,
+						link:  item.Link,
+					})
+					return true
+				}
+			}
+
+			// NOTE: fingerprints of items which fail to be cached are pruned on the next tick
+			if err := store.saveFingerprint(item.GUID, hash); err != nil {
+				log.Printf("# failed to save fingerprint of '%s': %s", item.GUID, err)
+			}
+			firsts[item.GUID] = item
+
+			return false
+		})
+		clustered = append(clustered, f)
+	}
+	if len(cached) > 0 {
+		clustered = append(clustered, gofeed.Feed{Items: cached})
+	}
+
+	return clustered, similars
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+
+	rf "github.com/meinside/rss-feeds-go"
+)
+
+const testArticle = `The quick brown fox jumps over the lazy dog near the river bank, while the farmer
+watches from the hill and wonders why the dog never chases the fox anymore. Some say the dog is simply
+too old, others say the fox and the dog became friends over the long winter months of the last year.`
+
+func TestSimHash(t *testing.T) {
+	hash1, ok := simHash(testArticle)
+	if !ok {
+		t.Fatal("expected text to be fingerprinted")
+	}
+
+	// identical text (with different cases and spaces)
+	if hash2, _ := simHash(strings.ToUpper(strings.Join(strings.Fields(testArticle), "  "))); hash1 != hash2 {
+		t.Errorf("expected identical fingerprints, got %x and %x", hash1, hash2)
+	}
+
+	// near-identical text
+	hash3, _ := simHash(testArticle + " (Updated.)")
+	if d := hammingDistance(hash1, hash3); d > similarItemsMaxDistance {
+		t.Errorf("expected near-identical fingerprints, got distance %d", d)
+	}
+
+	// different text
+	hash4, _ := simHash(strings.Repeat("completely unrelated words about databases and compilers ", 5))
+	if d := hammingDistance(hash1, hash4); d <= similarItemsMaxDistance {
+		t.Errorf("expected different fingerprints, got distance %d", d)
+	}
+
+	// too short
+	if _, ok := simHash("too short to fingerprint"); ok {
+		t.Error("expected short text not to be fingerprinted")
+	}
+}
+
+func TestHammingDistance(t *testing.T) {
+	if d := hammingDistance(0b1011, 0b0001); d != 2 {
+		t.Errorf("expected distance 2, got %d", d)
+	}
+	if d := hammingDistance(1<<63, 1<<63); d != 0 {
+		t.Errorf("expected distance 0, got %d", d)
+	}
+}
+
+func TestFeedStoreFingerprints(t *testing.T) {
+	_, store := newTestFeedStore(t)
+
+	hash, _ := simHash(testArticle)
+	if err := store.saveFingerprint("original", hash|1<<63); err != nil {
+		t.Fatalf("saveFingerprint() error: %s", err)
+	}
+
+	// similar to the original
+	if guid, exists, err := store.similarGUIDOf("other", hash|1<<63^0b11); err != nil || !exists || guid != "original" {
+		t.Errorf("expected similar item 'original', got %s, %v (%v)", guid, exists, err)
+	}
+
+	// not similar to itself
+	if _, exists, err := store.similarGUIDOf("original", hash|1<<63); err != nil || exists {
+		t.Errorf("expected no similar item, got %v (%v)", exists, err)
+	}
+
+	// pruned when not cached
+	insertTestCachedItems(t, store, rf.CachedItem{GUID: "cached"})
+	if err := store.saveFingerprint("cached", ^hash); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.pruneFingerprints(); err != nil {
+		t.Fatalf("pruneFingerprints() error: %s", err)
+	}
+	if _, exists, _ := store.similarGUIDOf("other", hash|1<<63); exists {
+		t.Error("expected fingerprint of uncached item to be pruned")
+	}
+	if guid, exists, _ := store.similarGUIDOf("other", ^hash); !exists || guid != "cached" {
+		t.Error("expected fingerprint of cached item to be kept")
+	}
+}
+
+func TestClusterSimilarItems(t *testing.T) {
+	_, store := newTestFeedStore(t)
+
+	unrelated := strings.Repeat("completely unrelated words about databases and compilers ", 5)
+	texts := map[string]string{ // link => scraped text
+		"https://a.com/fox":       testArticle,
+		"https://b.com/fox":       testArticle + " (Updated.)",
+		"https://c.com/databases": unrelated,
+		"https://d.com/fox":       testArticle + " (Reported again.)",
+	}
+	scraped := []string{}
+	scrape := func(link string) (string, error) {
+		scraped = append(scraped, link)
+		if text, exists := texts[link]; exists {
+			return text, nil
+		}
+		return "", fmt.Errorf("not found")
+	}
+
+	a := &gofeed.Item{GUID: "a", Title: "Fox", Link: "https://a.com/fox"}
+	b := &gofeed.Item{GUID: "b", Title: "Fox, again", Link: "https://b.com/fox"}
+	c := &gofeed.Item{GUID: "c", Title: "Databases", Link: "https://c.com/databases"}
+
+	// (similar items in a tick are combined into the first one, with their scraped texts)
+	clustered, similars := clusterSimilarItems([]gofeed.Feed{{Items: []*gofeed.Item{a, b, c}}}, store, scrape, false)
+	if items := clustered[0].Items; len(clustered) != 1 || len(items) != 2 || items[0] != a || items[1] != c {
+		t.Fatalf("unexpected clustered items: %+v", clustered)
+	}
+	if len(similars) != 1 || similars[0].item != b || similars[0].guid != "a" || similars[0].link != b.Link {
+		t.Errorf("unexpected similar items: %+v", similars)
+	}
+	if text := scrapedTextOf(a); !strings.HasPrefix(text, testArticle) || !strings.Contains(text, "Also reported as 'Fox, again' (https://b.com/fox)") || !strings.Contains(text, "(Updated.)") {
+		t.Errorf("unexpected combined text: %s", text)
+	}
+	if scrapedTextOf(c) != unrelated {
+		t.Errorf("expected the scraped text to be kept, got: %s", scrapedTextOf(c))
+	}
+	if err := store.recordDuplicates(similars); err != nil {
+		t.Fatal(err)
+	}
+
+	// (links of combined items are appended as sources)
+	insertTestCachedItems(t, store,
+		rf.CachedItem{GUID: "a", Title: "Fox", Link: a.Link, Description: "description", Summary: "Summary of foxes."},
+		rf.CachedItem{GUID: "c", Title: "Databases", Link: c.Link, Summary: "Summary of databases."},
+	)
+	if err := store.mergeDuplicates(); err != nil {
+		t.Fatal(err)
+	}
+	if merged, _ := store.isMergedDuplicate("b"); !merged {
+		t.Error("expected 'b' to be recorded as merged")
+	}
+	if cached, _ := store.cachedItemsOf([]string{"a"}); len(cached) != 1 || cached[0].Description != `description<p>Source: <a href="https://b.com/fox">https://b.com/fox</a></p>` {
+		t.Errorf("expected the link to be appended, got %+v", cached)
+	}
+
+	// (items similar to cached ones are combined into them, which are summarized again with their previous summaries)
+	d := &gofeed.Item{GUID: "d", Title: "Fox, reported again", Link: "https://d.com/fox"}
+	clustered, similars = clusterSimilarItems([]gofeed.Feed{{Items: []*gofeed.Item{d}}}, store, scrape, false)
+	if len(clustered) != 2 || len(clustered[0].Items) != 0 || len(clustered[1].Items) != 1 || clustered[1].Items[0].GUID != "a" {
+		t.Fatalf("unexpected clustered items: %+v", clustered)
+	}
+	if text := scrapedTextOf(clustered[1].Items[0]); !strings.Contains(text, "Summary of foxes.") || !strings.Contains(text, "(Reported again.)") {
+		t.Errorf("unexpected combined text: %s", text)
+	}
+	if len(similars) != 1 || similars[0].guid != "a" {
+		t.Errorf("unexpected similar items: %+v", similars)
+	}
+	if len(scraped) != 4 {
+		t.Errorf("expected each item to be scraped once, got %v", scraped)
+	}
+
+	// (already scraped items are not scraped again)
+	e := &gofeed.Item{GUID: "e", Title: "Fox, deferred", Link: "https://e.com/fox"}
+	setScrapedText(e, testArticle+" (Deferred.)")
+	if _, similars = clusterSimilarItems([]gofeed.Feed{{Items: []*gofeed.Item{e}}}, store, scrape, false); len(similars) != 1 || similars[0].guid != "a" {
+		t.Errorf("unexpected similar items: %+v", similars)
+	}
+	if len(scraped) != 4 {
+		t.Errorf("expected the already scraped item not to be scraped again, got %v", scraped)
+	}
+}
+
+func TestSummarizeItems_ScrapedText(t *testing.T) {
+	_, store := newTestFeedStore(t)
+
+	conf := config{
+		GoogleAIModels:  []string{"model1"},
+		DesiredLanguage: new("Korean"),
+		RSSFeeds:        []configRSSFeed{{Name: "test"}},
+	}
+	usage := newUsageAccountant(conf, []string{"key1"})
+	prompt, err := newSummaryPrompt(configSummaryPrompt{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newTestGeminiServer(t)
+	f := &feed{
+		conf:   conf.RSSFeeds[0],
+		store:  store,
+		usage:  usage,
+		prompt: prompt,
+		gemini: newTestGeminiSummarizer(usage, server),
+	}
+
+	// (summarized with the scraped text, without fetching the (unreachable) link again)
+	item := &gofeed.Item{GUID: "1", Title: "Fox", Link: "http://127.0.0.1:0/fox"}
+	setScrapedText(item, testArticle)
+	if deferred, err := summarizeItems(withUsageFeed(context.Background(), "test"), f, []*gofeed.Item{item}, nil, conf); err != nil || len(deferred) > 0 {
+		t.Fatalf("unexpected result: %v, %v", deferred, err)
+	}
+	if len(server.bodies) != 1 || !strings.Contains(server.bodies[0], "lazy dog") {
+		t.Errorf("expected the scraped text in the prompt, got: %v", server.bodies)
+	}
+}
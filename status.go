@@ -0,0 +1,113 @@
+// status.go
+
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	adminStatusServePath = adminServePathPrefix + "status"
+)
+
+// sourceStatusReport struct (status of a source url of a feed)
+type sourceStatusReport struct {
+	URL                 string     `json:"url"`
+	Status              string     `json:"status"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"`
+	LastFailureAt       *time.Time `json:"last_failure_at,omitempty"`
+	PollIntervalSeconds int        `json:"poll_interval_seconds,omitempty"`
+	NextFetchAt         *time.Time `json:"next_fetch_at,omitempty"`
+	CircuitOpenUntil    *time.Time `json:"circuit_open_until,omitempty"`
+}
+
+// feedStatusReport struct (status of a feed)
+type feedStatusReport struct {
+	Name    string               `json:"name"`
+	Sources []sourceStatusReport `json:"sources"`
+
+	UsageToday *usageCounts `json:"usage_today,omitempty"` // of Google Gemini API
+	OverBudget bool         `json:"over_budget,omitempty"`
+
+	SummaryModels map[string]int `json:"summary_models,omitempty"` // model => number of cached items summarized by it
+}
+
+// build the status report of given feed at `now`
+func feedStatusOf(f *feed, now time.Time) (report feedStatusReport, err error) {
+	report = feedStatusReport{
+		Name:    f.conf.Name,
+		Sources: []sourceStatusReport{},
+	}
+
+	var states map[string]sourceState
+	if states, err = f.store.sourceStates(); err != nil {
+		return report, err
+	}
+
+	for _, source := range f.conf.FeedURLs {
+		sourceReport := sourceStatusReport{
+			URL:    source,
+			Status: sourceStatus(source, states, now),
+		}
+		if state, exists := states[source]; exists {
+			sourceReport.ConsecutiveFailures = state.ConsecutiveFailures
+			sourceReport.LastError = state.LastError
+			sourceReport.LastSuccessAt = state.LastSuccessAt
+			sourceReport.LastFailureAt = state.LastFailureAt
+			sourceReport.PollIntervalSeconds = state.PollIntervalSeconds
+			if state.NextFetchAt.After(now) {
+				sourceReport.NextFetchAt = &state.NextFetchAt
+			}
+			if state.CircuitOpenUntil != nil && state.CircuitOpenUntil.After(now) {
+				sourceReport.CircuitOpenUntil = state.CircuitOpenUntil
+			}
+		}
+		report.Sources = append(report.Sources, sourceReport)
+	}
+
+	if f.usage != nil && f.conf.usesGemini() {
+		var counts usageCounts
+		counts, report.OverBudget = f.usage.feedUsage(f.conf.Name, now)
+		report.UsageToday = &counts
+	}
+
+	if report.SummaryModels, err = f.store.summaryModelCounts(); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// handle http requests for the status of feeds (and usages of api keys, and health of models)
+func handleStatus(conf config, feeds []*feed, usage *usageAccountant) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !adminRequestPermitted(r, conf) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		now := time.Now()
+		reports := []feedStatusReport{}
+		for _, f := range feeds {
+			report, err := feedStatusOf(f, now)
+			if err != nil {
+				writeJSONError(w, http.StatusInternalServerError, err)
+				return
+			}
+			reports = append(reports, report)
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"feeds":    reports,
+			"api_keys": usage.keyReports(now),
+			"models":   usage.modelReports(now),
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandleStatus(t *testing.T) {
+	client, store := newTestFeedStore(t)
+
+	const (
+		broken  = "https://broken.example.com/feed"
+		working = "https://example.com/feed"
+		unknown = "https://unknown.example.com/feed"
+	)
+	now := time.Now()
+	if err := store.recordSourceFailure(broken, errors.New("http error 503"), time.Hour, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.recordSourceSuccess(working, 0, now); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &feed{
+		conf:   configRSSFeed{Name: "test", FeedURLs: []string{broken, working, unknown}},
+		client: client,
+		store:  store,
+	}
+	conf := config{AdminToken: new("secret")}
+	handler := handleStatus(conf, []*feed{f}, nil)
+
+	// without a token
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, adminStatusServePath, nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d without a token, got %d", http.StatusUnauthorized, rec.Code)
+	}
+
+	// with a token
+	req := httptest.NewRequest(http.MethodGet, adminStatusServePath, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var res struct {
+		Feeds []feedStatusReport `json:"feeds"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Feeds) != 1 || len(res.Feeds[0].Sources) != 3 {
+		t.Fatalf("unexpected status: %+v", res)
+	}
+
+	sources := res.Feeds[0].Sources
+	if sources[0].Status != sourceStatusBackingOff || sources[0].LastError != "http error 503" || sources[0].NextFetchAt == nil {
+		t.Errorf("unexpected status of broken source: %+v", sources[0])
+	}
+	if sources[1].Status != sourceStatusOK || sources[1].LastSuccessAt == nil {
+		t.Errorf("unexpected status of working source: %+v", sources[1])
+	}
+	if sources[2].Status != sourceStatusNotYetFetched {
+		t.Errorf("unexpected status of unknown source: %+v", sources[2])
+	}
+}
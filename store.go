@@ -0,0 +1,150 @@
+// store.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+
+	rf "github.com/meinside/rss-feeds-go"
+)
+
+const (
+	storeBusyTimeoutMillis         = 5000
+	storeSlowQueryThresholdSeconds = 3
+)
+
+// feedStore struct
+//
+// keeps this application's own tables in a feed's cache DB file,
+// next to the `cached_items` table which is managed by rss-feeds-go.
+type feedStore struct {
+	db *gorm.DB
+}
+
+// open a feed store on the cache DB file at given `dbFilepath`
+func openFeedStore(dbFilepath string) (store *feedStore, err error) {
+	var db *gorm.DB
+	if db, err = gorm.Open(sqlite.Open(fmt.Sprintf("%s?_busy_timeout=%d", dbFilepath, storeBusyTimeoutMillis)), &gorm.Config{
+		Logger: logger.New(
+			log.New(os.Stdout, "\r\n", log.LstdFlags),
+			logger.Config{
+				SlowThreshold:             storeSlowQueryThresholdSeconds * time.Second,
+				LogLevel:                  logger.Warn,
+				IgnoreRecordNotFoundError: true,
+				ParameterizedQueries:      true,
+				Colorful:                  false,
+			},
+		),
+	}); err == nil {
+		store = &feedStore{db: db}
+
+		if err = store.migrate(); err == nil {
+			return store, nil
+		}
+		_ = store.close()
+
+		return nil, fmt.Errorf("failed to migrate feed store: %w", err)
+	}
+
+	return nil, fmt.Errorf("failed to open feed store: %w", err)
+}
+
+// migrate tables of the feed store
+func (s *feedStore) migrate() error {
+	if err := s.migrateSearchIndex(); err != nil {
+		return err
+	}
+	return s.db.AutoMigrate(
+		&cachedLink{},
+		&discussionLink{},
+		&contentFingerprint{},
+		&summaryRetry{},
+		&sourceState{},
+		&deferredItem{},
+		&apiUsage{},
+		&summaryModel{},
+		&itemTag{},
+		&originalTitle{},
+	)
+}
+
+// delete rows of items which were deleted from the cache
+func (s *feedStore) prune() error {
+	return errors.Join(
+		s.pruneSearchIndex(),
+		s.pruneLinks(),
+		s.pruneFingerprints(),
+		s.pruneRetries(),
+		s.pruneDeferredItems(),
+		s.pruneUsages(), // (kept for the retention days)
+		s.pruneSummaryModels(),
+		s.pruneItemTags(),
+		s.pruneOriginalTitles(),
+	)
+}
+
+// save (or update) the summary of given item in the cache
+//
+// (same as the cache of rss-feeds-go, for summaries generated by this application,
+// but also updates `updated_at` so that the ETags of served feeds change with the summaries)
+func (s *feedStore) saveSummary(item gofeed.Item, title, summary string) error {
+	cached := rf.CachedItem{
+		Title:       title,
+		GUID:        item.GUID,
+		Description: item.Description,
+		Summary:     summary,
+	}
+	if len(item.Links) > 0 {
+		cached.Link = item.Links[0]
+		if len(item.Links) > 1 {
+			cached.Comments = item.Links[1]
+		}
+	}
+	if item.Author != nil {
+		if item.Author.Name != "" {
+			cached.Author = item.Author.Name
+		} else {
+			cached.Author = item.Author.Email
+		}
+	}
+	if item.PublishedParsed != nil {
+		cached.PublishDate = item.PublishedParsed.Format(time.RFC3339)
+	}
+
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "guid"}},
+		DoUpdates: clause.AssignmentColumns([]string{"title", "summary", "updated_at"}),
+	}).Create(&cached).Error; err != nil {
+		return fmt.Errorf("failed to save summary of '%s': %w", item.GUID, err)
+	}
+	return s.indexItems([]string{item.GUID})
+}
+
+// touch cached items with given `guids` (for changing the ETags of served feeds)
+//
+// (rss-feeds-go does not update `updated_at` when it summarizes cached items again)
+func (s *feedStore) touchItems(guids []string) error {
+	if len(guids) == 0 {
+		return nil
+	}
+	return s.db.Model(&rf.CachedItem{}).Where("guid IN ?", guids).Update("updated_at", time.Now()).Error
+}
+
+// close the feed store
+func (s *feedStore) close() error {
+	if db, err := s.db.DB(); err == nil {
+		return db.Close()
+	} else {
+		return err
+	}
+}
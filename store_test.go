@@ -0,0 +1,101 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	rf "github.com/meinside/rss-feeds-go"
+)
+
+// create a client and a feed store on a temporary cache DB
+func newTestFeedStore(t *testing.T) (*rf.Client, *feedStore) {
+	t.Helper()
+
+	dbFilepath := filepath.Join(t.TempDir(), "test.db")
+
+	client, err := rf.NewClientWithDB([]string{"key1"}, nil, dbFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := openFeedStore(dbFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = store.close() })
+
+	return client, store
+}
+
+// insert given items directly into the `cached_items` table of the store
+func insertTestCachedItems(t *testing.T, store *feedStore, items ...rf.CachedItem) {
+	t.Helper()
+
+	for _, item := range items {
+		if err := store.db.Create(&item).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestOpenFeedStore(t *testing.T) {
+	_, store := newTestFeedStore(t)
+
+	if !store.db.Migrator().HasTable(searchIndexTableName) {
+		t.Errorf("expected table %s to be created", searchIndexTableName)
+	}
+
+	// migrating again should not fail on existing tables
+	if err := store.migrate(); err != nil {
+		t.Errorf("migrate() error: %s", err)
+	}
+}
+
+func TestSaveSummary(t *testing.T) {
+	client, store := newTestFeedStore(t)
+
+	published := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	item := gofeed.Item{
+		GUID:            "guid1",
+		Title:           "Original title",
+		Description:     "description",
+		Links:           []string{"https://example.com/article", "https://example.com/comments"},
+		Author:          &gofeed.Person{Email: "author@example.com"},
+		PublishedParsed: &published,
+	}
+
+	if err := store.saveSummary(item, "Title", "Summary"); err != nil {
+		t.Fatal(err)
+	}
+	saved := client.ListCachedItems(false)[0].UpdatedAt
+	time.Sleep(10 * time.Millisecond)
+	if err := store.saveSummary(item, "Updated title", "Updated summary"); err != nil {
+		t.Fatal(err)
+	}
+
+	items := client.ListCachedItems(false)
+	if len(items) != 1 {
+		t.Fatalf("expected 1 cached item, got %d", len(items))
+	}
+	if cached := items[0]; cached.Title != "Updated title" || cached.Summary != "Updated summary" ||
+		cached.Link != item.Links[0] || cached.Comments != item.Links[1] ||
+		cached.Author != "author@example.com" || cached.PublishDate != published.Format(time.RFC3339) {
+		t.Errorf("unexpected cached item: %+v", cached)
+	}
+	if !items[0].UpdatedAt.After(saved) {
+		t.Errorf("expected `updated_at` to be updated, got %s (was %s)", items[0].UpdatedAt, saved)
+	}
+
+	// touched
+	updated := items[0].UpdatedAt
+	time.Sleep(10 * time.Millisecond)
+	if err := store.touchItems([]string{item.GUID}); err != nil {
+		t.Fatal(err)
+	}
+	if touched := client.ListCachedItems(false)[0].UpdatedAt; !touched.After(updated) {
+		t.Errorf("expected `updated_at` to be touched, got %s (was %s)", touched, updated)
+	}
+}
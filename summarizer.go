@@ -0,0 +1,83 @@
+// summarizer.go
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	summarizerProviderGemini     = "gemini"
+	summarizerProviderOpenAI     = "openai"
+	summarizerProviderExtractive = "extractive"
+
+	summarySystemInstructionFormat = `You are a precise and useful agent for summarizing and translating contents retrieved from web sites or RSS/Atom feeds.
+
+Current datetime is %s.
+
+Respond to user messages according to the following principles:
+- Be as accurate as possible.
+- Be as truthful as possible.
+- Try to keep the nuances of the original title and/or content as much as possible.
+- Follow the instructions about the language, length, and format of the summary strictly.
+- If the title is already in the same language, or too vague to be translated, just keep it as it is.
+`
+)
+
+// summaryRequest struct (an item to be summarized)
+type summaryRequest struct {
+	title   string
+	url     string
+	content string // text content of the item
+	prompt  string // rendered with the prompt of the feed
+
+	document []byte // pdf document of the item (instead of its text content), for models which read it by themselves
+
+	tagging *tagging // nil for no tags
+}
+
+// summarizer interface (backend of summaries generated by this application)
+type summarizer interface {
+	// generate a (translated) title, a summary, and tags (if requested) of given request, and return them with the name of the used model
+	generate(ctx context.Context, req summaryRequest) (model, title, summary string, tags []string, err error)
+
+	// interval between summaries of items (for not hitting rate limits)
+	interval() time.Duration
+}
+
+// generate a system instruction for summarizers
+func summarySystemInstruction() string {
+	return fmt.Sprintf(summarySystemInstructionFormat, time.Now().Format("2006-01-02 15:04:05 (Mon) MST"))
+}
+
+// create a summarizer for given feed config (nil if summaries are left to rss-feeds-go)
+//
+// (Google Gemini API is requested with the api keys and models of given `usage`)
+func newSummarizer(conf config, feedConfig configRSSFeed, usage *usageAccountant) summarizer {
+	provider := summarizerProviderGemini
+	if feedConfig.Summarizer != nil {
+		provider = feedConfig.Summarizer.provider()
+	}
+
+	switch provider {
+	case summarizerProviderExtractive:
+		length, format := "", ""
+		if feedConfig.SummaryPrompt != nil {
+			length, format = feedConfig.SummaryPrompt.Length, feedConfig.SummaryPrompt.Format
+		}
+		return newExtractiveSummarizer(length, format)
+	case summarizerProviderOpenAI:
+		apiKey := ""
+		if feedConfig.Summarizer.APIKey != nil {
+			apiKey = *feedConfig.Summarizer.APIKey
+		}
+		return newOpenAISummarizer(feedConfig.Summarizer.BaseURL, feedConfig.Summarizer.Model, apiKey, usage)
+	default:
+		if feedConfig.SummaryPrompt == nil {
+			return nil
+		}
+		return newGeminiSummarizer(usage)
+	}
+}
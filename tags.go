@@ -0,0 +1,295 @@
+// tags.go
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+
+	rf "github.com/meinside/rss-feeds-go"
+)
+
+const (
+	defaultMaxTags = 3
+
+	tagQueryParam = "tag" // (eg. `/tech?tag=security`)
+
+	tagsInstructionFormatAllowed  = `Also categorize the content with at most %d tag(s), chosen only from the following list: %s.`
+	tagsInstructionFormatFreeForm = `Also categorize the content with at most %d short tag(s), each of a word or two in lowercase.`
+
+	tagsPromptFormat = `Reply with tags of the following summarized content, as a JSON array of strings.
+%s
+
+Title: %s
+
+<content>
+%s
+</content>`
+)
+
+// tagging struct (tags of items of a feed)
+type tagging struct {
+	allowed []string // free-form if empty
+	max     int
+}
+
+// create a new tagging for given config (nil if not configured)
+func newTagging(conf *configTags) *tagging {
+	if conf == nil {
+		return nil
+	}
+
+	t := &tagging{
+		max: conf.MaxTags,
+	}
+	if t.max <= 0 {
+		t.max = defaultMaxTags
+	}
+	for _, tag := range conf.Allowed {
+		if tag = strings.TrimSpace(tag); !slices.ContainsFunc(t.allowed, func(allowed string) bool {
+			return strings.EqualFold(allowed, tag)
+		}) {
+			t.allowed = append(t.allowed, tag)
+		}
+	}
+	return t
+}
+
+// instruction for generating tags along with summaries
+func (t *tagging) instruction() string {
+	if len(t.allowed) > 0 {
+		return fmt.Sprintf(tagsInstructionFormatAllowed, t.max, strings.Join(t.allowed, ", "))
+	}
+	return fmt.Sprintf(tagsInstructionFormatFreeForm, t.max)
+}
+
+// normalize given (generated) tags: trimmed, deduplicated, limited to the allowed ones, and at most `max` of them
+func (t *tagging) normalize(tags []string) (normalized []string) {
+	normalized = []string{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+		if tag == "" {
+			continue
+		}
+		if len(t.allowed) > 0 {
+			idx := slices.IndexFunc(t.allowed, func(allowed string) bool {
+				return strings.EqualFold(allowed, tag)
+			})
+			if idx < 0 {
+				continue
+			}
+			tag = t.allowed[idx] // (as configured)
+		}
+		if slices.ContainsFunc(normalized, func(n string) bool {
+			return strings.EqualFold(n, tag)
+		}) {
+			continue
+		}
+		if normalized = append(normalized, tag); len(normalized) >= t.max {
+			break
+		}
+	}
+	return normalized
+}
+
+// pick the allowed tags which appear in given content, in the order of their occurrences (for summaries without generations)
+func (t *tagging) match(content string) []string {
+	words := strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	joined := " " + strings.Join(words, " ") + " "
+
+	counts := map[string]int{}
+	for _, tag := range t.allowed {
+		phrase := strings.Join(strings.FieldsFunc(strings.ToLower(tag), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		}), " ")
+		if phrase == "" {
+			continue
+		}
+		if count := strings.Count(joined, " "+phrase+" "); count > 0 {
+			counts[tag] = count
+		}
+	}
+
+	matched := []string{}
+	for tag := range counts {
+		matched = append(matched, tag)
+	}
+	slices.SortStableFunc(matched, func(a, b string) int {
+		if counts[a] != counts[b] {
+			return counts[b] - counts[a]
+		}
+		return slices.Index(t.allowed, a) - slices.Index(t.allowed, b)
+	})
+	return t.normalize(matched)
+}
+
+// itemTag struct (a tag of a cached item)
+type itemTag struct {
+	GUID     string `gorm:"primaryKey"`
+	Tag      string `gorm:"primaryKey;index"`
+	Position int    // (in the order of generation)
+
+	CreatedAt time.Time
+}
+
+// replace tags of the cached item with given `guid`
+func (s *feedStore) saveItemTags(guid string, tags []string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("guid = ?", guid).Delete(&itemTag{}).Error; err != nil {
+			return fmt.Errorf("failed to delete tags of '%s': %w", guid, err)
+		}
+		for i, tag := range tags {
+			if err := tx.Create(&itemTag{
+				GUID:     guid,
+				Tag:      tag,
+				Position: i,
+			}).Error; err != nil {
+				return fmt.Errorf("failed to save tag '%s' of '%s': %w", tag, guid, err)
+			}
+		}
+
+		// (for changing the ETags of served feeds)
+		return tx.Model(&rf.CachedItem{}).Where("guid = ?", guid).Update("updated_at", time.Now()).Error
+	})
+}
+
+// get tags of cached items with given `guids` (guid => tags)
+func (s *feedStore) tagsOf(guids []string) (tags map[string][]string, err error) {
+	tags = map[string][]string{}
+	if len(guids) == 0 {
+		return tags, nil
+	}
+
+	var rows []itemTag
+	if err = s.db.Where("guid IN ?", guids).Order("guid, position").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch tags: %w", err)
+	}
+	for _, row := range rows {
+		tags[row.GUID] = append(tags[row.GUID], row.Tag)
+	}
+	return tags, nil
+}
+
+// delete tags of items which were deleted from the cache
+func (s *feedStore) pruneItemTags() error {
+	return s.db.Where("guid NOT IN (SELECT guid FROM cached_items)").Delete(&itemTag{}).Error
+}
+
+// get tags of given items from the stores of `feeds` (guid => tags)
+func itemTagsOf(feeds []*feed, items []rf.CachedItem) map[string][]string {
+	guids := []string{}
+	for _, item := range items {
+		guids = append(guids, item.GUID)
+	}
+
+	tags := map[string][]string{}
+	for _, f := range feeds {
+		if f.conf.Tags == nil {
+			continue
+		}
+		if fetched, err := f.store.tagsOf(guids); err == nil {
+			for guid, t := range fetched {
+				tags[guid] = t
+			}
+		} else {
+			log.Printf("# failed to fetch tags of '%s': %s", f.conf.Name, err)
+		}
+	}
+	return tags
+}
+
+// keep items which have all of given `tags` (case-insensitive)
+func filterItemsByTags(items []rf.CachedItem, itemTags map[string][]string, tags []string) []rf.CachedItem {
+	if len(tags) == 0 {
+		return items
+	}
+
+	return slices.DeleteFunc(items, func(item rf.CachedItem) bool {
+		for _, tag := range tags {
+			if !slices.ContainsFunc(itemTags[item.GUID], func(t string) bool {
+				return strings.EqualFold(t, strings.TrimSpace(tag))
+			}) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// add tags of items as `<category>` elements to given RSS xml
+//
+// (rss-feeds-go does not publish categories of items, so they are inserted into its RSS xml,
+// at the ends of `<item>` elements located by parsing it)
+func withCategories(rss []byte, itemTags map[string][]string) ([]byte, error) {
+	if len(itemTags) == 0 {
+		return rss, nil
+	}
+
+	// locate the ends of items (and their guids),
+	type insertion struct {
+		offset int64
+		tags   []string
+	}
+	insertions := []insertion{}
+	dec := xml.NewDecoder(bytes.NewReader(rss))
+	var inItem, inGUID bool
+	var guid strings.Builder
+	for {
+		offset := dec.InputOffset()
+		token, err := dec.Token() // (checks that elements are matched)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse RSS xml: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Space == "" && t.Name.Local == "item" {
+				inItem = true
+				guid.Reset()
+			} else if inItem && t.Name.Space == "" && t.Name.Local == "guid" {
+				inGUID = true
+			}
+		case xml.CharData:
+			if inGUID {
+				guid.Write(t)
+			}
+		case xml.EndElement:
+			if t.Name.Space == "" && t.Name.Local == "guid" {
+				inGUID = false
+			} else if inItem && t.Name.Space == "" && t.Name.Local == "item" {
+				inItem = false
+				if tags := itemTags[strings.TrimSpace(guid.String())]; len(tags) > 0 {
+					insertions = append(insertions, insertion{offset: offset, tags: tags})
+				}
+			}
+		}
+	}
+
+	// and insert categories there
+	var buf bytes.Buffer
+	var written int64
+	for _, insertion := range insertions {
+		buf.Write(rss[written:insertion.offset])
+		for _, tag := range insertion.tags {
+			buf.WriteString("  <category>")
+			_ = xml.EscapeText(&buf, []byte(tag))
+			buf.WriteString("</category>\n    ")
+		}
+		written = insertion.offset
+	}
+	buf.Write(rss[written:])
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	rf "github.com/meinside/rss-feeds-go"
+)
+
+func TestTagging_Normalize(t *testing.T) {
+	tests := []struct {
+		conf configTags
+		tags []string
+		want []string
+	}{
+		{conf: configTags{}, tags: []string{" #go ", "Go", "", "rss", "ai", "security"}, want: []string{"go", "rss", "ai"}},
+		{conf: configTags{MaxTags: 1}, tags: []string{"go", "rss"}, want: []string{"go"}},
+		{conf: configTags{Allowed: []string{"Security", "AI", "ai"}}, tags: []string{"security", "cooking", "AI"}, want: []string{"Security", "AI"}},
+		{conf: configTags{Allowed: []string{"Security"}}, tags: nil, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := newTagging(&tt.conf).normalize(tt.tags); !slices.Equal(got, tt.want) {
+			t.Errorf("normalize(%v) with %+v = %v, want %v", tt.tags, tt.conf, got, tt.want)
+		}
+	}
+
+	if newTagging(nil) != nil {
+		t.Error("expected no tagging without config")
+	}
+	if instruction := newTagging(&configTags{Allowed: []string{"Go", "Rust"}}).instruction(); !strings.Contains(instruction, "Go, Rust") {
+		t.Errorf("expected allowed tags in the instruction, got: %s", instruction)
+	}
+}
+
+func TestTagging_Match(t *testing.T) {
+	tagging := newTagging(&configTags{Allowed: []string{"Go", "Machine Learning", "Rust", "Cooking"}, MaxTags: 2})
+
+	content := "Go 1.26 was released. Machine-learning libraries for Go are growing, and so is Rust. Going further..."
+	if got := tagging.match(content); !slices.Equal(got, []string{"Go", "Machine Learning"}) {
+		t.Errorf("unexpected matched tags: %v", got)
+	}
+	if got := tagging.match("nothing related"); len(got) != 0 {
+		t.Errorf("expected no matched tags, got %v", got)
+	}
+}
+
+func TestFeedStoreItemTags(t *testing.T) {
+	_, store := newTestFeedStore(t)
+
+	before := time.Now()
+	insertTestCachedItems(t, store,
+		rf.CachedItem{GUID: "a", Summary: "a", Model: gorm.Model{UpdatedAt: before.Add(-time.Hour)}},
+		rf.CachedItem{GUID: "b", Summary: "b", Model: gorm.Model{UpdatedAt: before.Add(-time.Hour)}},
+	)
+
+	if err := store.saveItemTags("a", []string{"security", "ai"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.saveItemTags("b", []string{"go"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.saveItemTags("b", []string{"rust", "go"}); err != nil { // (replaced)
+		t.Fatal(err)
+	}
+
+	tags, err := store.tagsOf([]string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || !slices.Equal(tags["a"], []string{"security", "ai"}) || !slices.Equal(tags["b"], []string{"rust", "go"}) {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+
+	// (items are touched, for changing the ETags of served feeds)
+	if items, err := store.cachedItemsOf([]string{"a", "b"}); err != nil || len(items) != 2 || items[0].UpdatedAt.Before(before) || items[1].UpdatedAt.Before(before) {
+		t.Errorf("expected the items to be touched, got %+v (%v)", items, err)
+	}
+
+	// pruned with their items
+	if err := store.db.Unscoped().Where("guid = ?", "a").Delete(&rf.CachedItem{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := store.pruneItemTags(); err != nil {
+		t.Fatal(err)
+	}
+	if tags, _ := store.tagsOf([]string{"a", "b"}); len(tags) != 1 {
+		t.Errorf("expected tags of 'a' to be pruned, got %v", tags)
+	}
+}
+
+func TestFilterItemsByTags(t *testing.T) {
+	items := []rf.CachedItem{{GUID: "a"}, {GUID: "b"}, {GUID: "c"}}
+	itemTags := map[string][]string{
+		"a": {"Security", "AI"},
+		"b": {"AI"},
+	}
+
+	tests := []struct {
+		tags []string
+		want []string
+	}{
+		{tags: nil, want: []string{"a", "b", "c"}},
+		{tags: []string{"ai"}, want: []string{"a", "b"}},
+		{tags: []string{"ai", "security"}, want: []string{"a"}},
+		{tags: []string{"cooking"}, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		guids := []string{}
+		for _, item := range filterItemsByTags(slices.Clone(items), itemTags, tt.tags) {
+			guids = append(guids, item.GUID)
+		}
+		if !slices.Equal(guids, tt.want) {
+			t.Errorf("filterItemsByTags(%v) = %v, want %v", tt.tags, guids, tt.want)
+		}
+	}
+}
+
+func TestServeItems_Tags(t *testing.T) {
+	client, store := newTestFeedStore(t)
+
+	items := []rf.CachedItem{
+		{GUID: "https://example.com/a", Link: "https://example.com/a", Title: "A", Summary: "summary of a"},
+		{GUID: "https://example.com/b?x=1&y=2", Link: "https://example.com/b", Title: "B", Summary: "summary of b"},
+	}
+	if err := store.saveItemTags(items[0].GUID, []string{"security", "R&D"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.saveItemTags(items[1].GUID, []string{"go"}); err != nil {
+		t.Fatal(err)
+	}
+	f := &feed{
+		conf:  configRSSFeed{Name: "test", Tags: &configTags{}},
+		store: store,
+	}
+
+	serve := func(target string) (categories map[string][]string) {
+		w := httptest.NewRecorder()
+		serveItems(w, httptest.NewRequest(http.MethodGet, target, nil), client, configPublish{}, slices.Clone(items), []*feed{f})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected %d, got %d", http.StatusOK, w.Code)
+		}
+
+		var rss struct {
+			Items []struct {
+				GUID       string   `xml:"guid"`
+				Categories []string `xml:"category"`
+			} `xml:"channel>item"`
+		}
+		if err := xml.Unmarshal(w.Body.Bytes(), &rss); err != nil {
+			t.Fatalf("invalid xml: %s\n%s", err, w.Body.String())
+		}
+		categories = map[string][]string{}
+		for _, item := range rss.Items {
+			categories[item.GUID] = item.Categories
+		}
+		return categories
+	}
+
+	categories := serve("/test")
+	if len(categories) != 2 || !slices.Equal(categories[items[0].GUID], []string{"security", "R&D"}) || !slices.Equal(categories[items[1].GUID], []string{"go"}) {
+		t.Errorf("unexpected categories: %v", categories)
+	}
+	if categories := serve("/test?tag=Go"); len(categories) != 1 || categories[items[1].GUID] == nil {
+		t.Errorf("unexpected categories of filtered items: %v", categories)
+	}
+
+	// (not tagged without config)
+	f.conf.Tags = nil
+	if categories := serve("/test"); len(categories) != 2 || categories[items[0].GUID] != nil {
+		t.Errorf("expected no categories, got %v", categories)
+	}
+}
+
+func TestWithCategories(t *testing.T) {
+	rss := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">
+  <channel>
+    <atom:link href="https://example.com/feed" rel="self"></atom:link>
+    <item>
+      <title>A &lt;item&gt;</title>
+      <guid isPermaLink="true">https://example.com/a?x=1&amp;y=2</guid>
+      <description><![CDATA[<p>a</item> inside</p>]]></description>
+    </item>
+    <item>
+      <guid><![CDATA[b]]></guid>
+    </item>
+    <item>
+      <guid>c</guid>
+    </item>
+  </channel>
+</rss>`)
+
+	withTags, err := withCategories(rss, map[string][]string{
+		"https://example.com/a?x=1&y=2": {"security", "R&D"},
+		"b":                             {"go"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var parsed struct {
+		Items []struct {
+			GUID        string   `xml:"guid"`
+			Description string   `xml:"description"`
+			Categories  []string `xml:"category"`
+		} `xml:"channel>item"`
+	}
+	if err := xml.Unmarshal(withTags, &parsed); err != nil {
+		t.Fatalf("invalid xml: %s\n%s", err, withTags)
+	}
+	if len(parsed.Items) != 3 ||
+		!slices.Equal(parsed.Items[0].Categories, []string{"security", "R&D"}) || parsed.Items[0].Description != "<p>a</item> inside</p>" ||
+		!slices.Equal(parsed.Items[1].Categories, []string{"go"}) ||
+		parsed.Items[2].Categories != nil {
+		t.Errorf("unexpected items: %+v", parsed.Items)
+	}
+	if !strings.Contains(string(withTags), `<atom:link href="https://example.com/feed" rel="self"></atom:link>`) {
+		t.Errorf("expected other elements to be kept as they are: %s", withTags)
+	}
+
+	// (not modified without tags)
+	if unmodified, err := withCategories(rss, nil); err != nil || string(unmodified) != string(rss) {
+		t.Errorf("expected the xml as it is, got %s (%v)", unmodified, err)
+	}
+
+	// malformed xml
+	if _, err := withCategories([]byte("<rss><item><guid>a</guid></rss>"), map[string][]string{"a": {"go"}}); err == nil {
+		t.Error("expected error for malformed xml, got nil")
+	}
+}
+
+func TestGeminiSummarizer_GenerateTags(t *testing.T) {
+	conf := config{GoogleAIModels: []string{"model1"}}
+	usage := newUsageAccountant(conf, []string{"key1"})
+	server := newTestGeminiServer(t)
+	server.reply("model1", http.StatusOK, `{
+		"candidates": [{"content": {"role": "model", "parts": [{"text": "[\"Go\", \"cooking\", \"#security\"]"}]}, "finishReason": "STOP"}],
+		"usageMetadata": {"promptTokenCount": 10, "candidatesTokenCount": 5}
+	}`)
+	g := newTestGeminiSummarizer(usage, server)
+
+	tagging := newTagging(&configTags{Allowed: []string{"go", "security"}})
+	tags, err := g.generateTags(context.Background(), "Title", "Summary of the item.", tagging)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(tags, []string{"go", "security"}) {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+	if len(server.bodies) != 1 || !strings.Contains(server.bodies[0], "Summary of the item.") || !strings.Contains(server.bodies[0], `"responseMimeType":"application/json"`) {
+		t.Errorf("unexpected request: %v", server.bodies)
+	}
+
+	// (not a json array)
+	server.reply("model1", http.StatusOK, testGeminiSuccessBody)
+	if _, err := g.generateTags(context.Background(), "Title", "Summary of the item.", tagging); err == nil {
+		t.Error("expected error for unparsable tags, got nil")
+	}
+}
+
+func TestExtractiveSummarizer_Tags(t *testing.T) {
+	tagging := newTagging(&configTags{Allowed: []string{"Go", "Cooking"}})
+
+	_, _, _, tags, err := newExtractiveSummarizer("", "").generate(context.Background(), summaryRequest{
+		title:   "Title",
+		content: testExtractiveText,
+		tagging: tagging,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(tags, []string{"Go"}) {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+}
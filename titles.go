@@ -0,0 +1,187 @@
+// titles.go
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"gorm.io/gorm/clause"
+
+	rf "github.com/meinside/rss-feeds-go"
+)
+
+const (
+	titleTranslationPromptFormat = `Translate the following title into %s language.
+If the title is already in the same language, or too vague to be translated, just keep it as it is.
+Reply with the translated title only, without any quotes, labels, or explanations.
+
+Title: %s`
+
+	originalTitleFormat = `<p>Original title: %s</p>` // (prepended to descriptions of items)
+)
+
+// titleTranslator interface (summarizers which can translate titles)
+type titleTranslator interface {
+	// translate given title into `language`
+	translateTitle(ctx context.Context, title, language string) (translated string, err error)
+}
+
+// clean up given translated title (eg. quotes, labels, or trailing lines)
+func cleanTranslatedTitle(translated string) string {
+	translated = strings.TrimSpace(translated)
+	if line, _, found := strings.Cut(translated, "\n"); found {
+		translated = strings.TrimSpace(line)
+	}
+	translated = strings.TrimSpace(strings.TrimPrefix(translated, "Title:"))
+	if len(translated) >= 2 && (strings.HasPrefix(translated, `"`) && strings.HasSuffix(translated, `"`) ||
+		strings.HasPrefix(translated, "'") && strings.HasSuffix(translated, "'")) {
+		translated = strings.TrimSpace(translated[1 : len(translated)-1])
+	}
+	return translated
+}
+
+// originalTitle struct (original title of a cached item, before translation)
+type originalTitle struct {
+	GUID  string `gorm:"primaryKey"`
+	Title string
+
+	CreatedAt time.Time
+}
+
+// save original titles of given items (kept if already saved, eg. when resummarized)
+func (s *feedStore) saveOriginalTitles(items []*gofeed.Item) error {
+	for _, item := range items {
+		if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&originalTitle{
+			GUID:  item.GUID,
+			Title: strings.TrimSpace(item.Title),
+		}).Error; err != nil {
+			return fmt.Errorf("failed to save original title of '%s': %w", item.GUID, err)
+		}
+	}
+	return nil
+}
+
+// get original titles of cached items with given `guids` (guid => title)
+func (s *feedStore) originalTitlesOf(guids []string) (titles map[string]string, err error) {
+	titles = map[string]string{}
+	if len(guids) == 0 {
+		return titles, nil
+	}
+
+	var rows []originalTitle
+	if err = s.db.Where("guid IN ?", guids).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch original titles: %w", err)
+	}
+	for _, row := range rows {
+		titles[row.GUID] = row.Title
+	}
+	return titles, nil
+}
+
+// update the (translated) title of the cached item with given `guid`
+func (s *feedStore) updateTitle(guid, title string) error {
+	if err := s.db.Model(&rf.CachedItem{}).Where("guid = ?", guid).Updates(map[string]any{
+		"title":      title,
+		"updated_at": time.Now(),
+	}).Error; err != nil {
+		return err
+	}
+	return s.indexItems([]string{guid})
+}
+
+// delete original titles of items which were deleted from the cache
+func (s *feedStore) pruneOriginalTitles() error {
+	return s.db.Where("guid NOT IN (SELECT guid FROM cached_items)").Delete(&originalTitle{}).Error
+}
+
+// translate titles of given (summarized) feeds `fs` of feed `f`, which were left untranslated by their summaries
+//
+// original titles are kept in the store. (items with failed summaries are not translated)
+func translateTitles(ctx context.Context, f *feed, fs []gofeed.Feed, conf config) {
+	if f.translator == nil {
+		return
+	}
+
+	items := []*gofeed.Item{}
+	guids := []string{}
+	for _, feed := range fs {
+		for _, item := range feed.Items {
+			items = append(items, item)
+			guids = append(guids, item.GUID)
+		}
+	}
+	if len(items) == 0 {
+		return
+	}
+
+	if err := f.store.saveOriginalTitles(items); err != nil {
+		log.Printf("# failed to save original titles: %s", err)
+		return
+	}
+	originals, err := f.store.originalTitlesOf(guids)
+	if err != nil {
+		log.Printf("# failed to fetch original titles: %s", err)
+		return
+	}
+	cached, err := f.store.cachedItemsOf(guids)
+	if err != nil {
+		log.Printf("# failed to fetch cached items: %s", err)
+		return
+	}
+
+	for _, item := range cached {
+		original, exists := originals[item.GUID]
+		if !exists || original == "" || isFailedSummary(item.Summary) || strings.TrimSpace(item.Title) != original {
+			continue // (already translated by its summary)
+		}
+
+		translated, err := f.translator.translateTitle(ctx, original, *conf.DesiredLanguage)
+		if err != nil {
+			log.Printf("# failed to translate title '%s': %s", original, err)
+			continue
+		}
+		if translated == original {
+			continue
+		}
+		if err := f.store.updateTitle(item.GUID, translated); err != nil {
+			log.Printf("# failed to update title of '%s': %s", item.GUID, err)
+		} else if conf.Verbose {
+			log.Printf(">>> translated title '%s' to '%s'.", original, translated)
+		}
+	}
+}
+
+// prepend original titles to descriptions of given items which have translated titles, in the stores of `feeds`
+func withOriginalTitles(feeds []*feed, items []rf.CachedItem) []rf.CachedItem {
+	guids := []string{}
+	for _, item := range items {
+		guids = append(guids, item.GUID)
+	}
+
+	originals := map[string]string{}
+	for _, f := range feeds {
+		if !f.conf.TranslateTitles {
+			continue
+		}
+		if fetched, err := f.store.originalTitlesOf(guids); err == nil {
+			for guid, title := range fetched {
+				originals[guid] = title
+			}
+		} else {
+			log.Printf("# failed to fetch original titles of '%s': %s", f.conf.Name, err)
+		}
+	}
+
+	for i, item := range items {
+		if original, exists := originals[item.GUID]; exists && original != "" && original != strings.TrimSpace(item.Title) {
+			items[i].Description = fmt.Sprintf(originalTitleFormat, html.EscapeString(original)) + "\n" + item.Description
+		}
+	}
+	return items
+}
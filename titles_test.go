@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+
+	rf "github.com/meinside/rss-feeds-go"
+)
+
+// testTranslator is a stub title translator which prefixes titles with their language
+type testTranslator struct {
+	titles []string // translated ones
+}
+
+// translateTitle implements titleTranslator
+func (t *testTranslator) translateTitle(ctx context.Context, title, language string) (string, error) {
+	if title == "fails" {
+		return "", fmt.Errorf("translation failed")
+	}
+	t.titles = append(t.titles, title)
+	return "[" + language + "] " + title, nil
+}
+
+func TestCleanTranslatedTitle(t *testing.T) {
+	tests := []struct {
+		translated string
+		want       string
+	}{
+		{translated: "  번역된 제목 ", want: "번역된 제목"},
+		{translated: `"번역된 제목"`, want: "번역된 제목"},
+		{translated: "Title: 번역된 제목\n\n(translated from English)", want: "번역된 제목"},
+		{translated: `"`, want: `"`},
+		{translated: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := cleanTranslatedTitle(tt.translated); got != tt.want {
+			t.Errorf("cleanTranslatedTitle(%q) = %q, want %q", tt.translated, got, tt.want)
+		}
+	}
+}
+
+func TestTranslateTitles(t *testing.T) {
+	_, store := newTestFeedStore(t)
+
+	insertTestCachedItems(t, store,
+		rf.CachedItem{GUID: "untranslated", Title: "Original", Summary: "summary"},
+		rf.CachedItem{GUID: "translated", Title: "번역된 제목", Summary: "summary"},
+		rf.CachedItem{GUID: "failed", Title: "Failed", Summary: rf.ErrorPrefixSummaryFailedWithError + ": error"},
+		rf.CachedItem{GUID: "error", Title: "fails", Summary: "summary"},
+	)
+
+	translator := &testTranslator{}
+	f := &feed{
+		conf:       configRSSFeed{Name: "test", TranslateTitles: true},
+		store:      store,
+		translator: translator,
+	}
+	conf := config{DesiredLanguage: new("Korean")}
+	fs := []gofeed.Feed{{Items: []*gofeed.Item{
+		{GUID: "untranslated", Title: "Original"},
+		{GUID: "translated", Title: "Translated <by> summary"},
+		{GUID: "failed", Title: "Failed"},
+		{GUID: "error", Title: "fails"},
+	}}}
+
+	translateTitles(context.Background(), f, fs, conf)
+
+	if len(translator.titles) != 1 || translator.titles[0] != "Original" {
+		t.Errorf("expected only 'Original' to be translated, got %v", translator.titles)
+	}
+	items, err := store.cachedItemsOf([]string{"untranslated", "translated"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range items {
+		if item.GUID == "untranslated" && item.Title != "[Korean] Original" {
+			t.Errorf("expected the title to be translated, got '%s'", item.Title)
+		}
+	}
+
+	// original titles are kept, even when translated ones are summarized again
+	translateTitles(context.Background(), f, []gofeed.Feed{{Items: []*gofeed.Item{{GUID: "untranslated", Title: "[Korean] Original"}}}}, conf)
+	originals, err := store.originalTitlesOf([]string{"untranslated", "translated"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(originals) != 2 || originals["untranslated"] != "Original" || originals["translated"] != "Translated <by> summary" {
+		t.Errorf("unexpected original titles: %v", originals)
+	}
+	if len(translator.titles) != 1 {
+		t.Errorf("expected no more translations, got %v", translator.titles)
+	}
+
+	// (served in descriptions)
+	served := withOriginalTitles([]*feed{f}, []rf.CachedItem{
+		{GUID: "translated", Title: "번역된 제목", Description: "description"},
+		{GUID: "failed", Title: "Failed", Description: "description"},
+	})
+	if served[0].Description != "<p>Original title: Translated &lt;by&gt; summary</p>\ndescription" || served[1].Description != "description" {
+		t.Errorf("unexpected descriptions: %q, %q", served[0].Description, served[1].Description)
+	}
+	f.conf.TranslateTitles = false
+	if served := withOriginalTitles([]*feed{f}, []rf.CachedItem{{GUID: "translated", Title: "번역된 제목"}}); served[0].Description != "" {
+		t.Errorf("expected no original titles without config, got %q", served[0].Description)
+	}
+}
+
+func TestOpenAISummarizer_TranslateTitle(t *testing.T) {
+	requests := make(chan testOpenAIRequest, 1)
+	server := newTestOpenAIServer(t, http.StatusOK, "\"번역된 제목\"", requests)
+
+	translated, err := newOpenAISummarizer(server.URL+"/v1", "local-model", "", nil).translateTitle(context.Background(), "Original title", "Korean")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if translated != "번역된 제목" {
+		t.Errorf("unexpected translated title: %s", translated)
+	}
+	if req := <-requests; req.body.ResponseFormat != nil || !strings.Contains(req.body.Messages[1].Content, "Korean") || !strings.Contains(req.body.Messages[1].Content, "Original title") {
+		t.Errorf("unexpected request: %+v", req)
+	}
+
+	empty := newTestOpenAIServer(t, http.StatusOK, " ", nil)
+	if _, err := newOpenAISummarizer(empty.URL+"/v1", "local-model", "", nil).translateTitle(context.Background(), "Original title", "Korean"); err == nil {
+		t.Error("expected error for an empty translation, got nil")
+	}
+}
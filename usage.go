@@ -0,0 +1,451 @@
+// usage.go
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	usageDayFormat     = "2006-01-02"
+	usageRetentionDays = 400 // (for monthly reports of about a year)
+)
+
+// usageFeedKey is the context key of the name of the feed which makes api requests
+type usageFeedKey struct{}
+
+// apiCallsKey is the context key of the counter of api requests (made with the context)
+type apiCallsKey struct{}
+
+// usageCounts struct (counters of api usages)
+type usageCounts struct {
+	Requests     int64 `json:"requests"`
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"` // (including thoughts)
+	Errors       int64 `json:"errors"`        // (including quota errors)
+	QuotaErrors  int64 `json:"quota_errors"`  // (http status 429)
+}
+
+// apiUsage struct (daily usage of an api key and a model by a feed)
+type apiUsage struct {
+	Day   string `gorm:"primaryKey"` // YYYY-MM-DD (local)
+	KeyID string `gorm:"primaryKey"` // (hashed, not the api key itself)
+	Model string `gorm:"primaryKey"`
+
+	Requests     int64
+	InputTokens  int64
+	OutputTokens int64
+	Errors       int64
+	QuotaErrors  int64
+
+	UpdatedAt time.Time
+}
+
+// get the counters of the usage
+func (u apiUsage) counts() usageCounts {
+	return usageCounts{
+		Requests:     u.Requests,
+		InputTokens:  u.InputTokens,
+		OutputTokens: u.OutputTokens,
+		Errors:       u.Errors,
+		QuotaErrors:  u.QuotaErrors,
+	}
+}
+
+// add given counts
+func (c *usageCounts) add(other usageCounts) {
+	c.Requests += other.Requests
+	c.InputTokens += other.InputTokens
+	c.OutputTokens += other.OutputTokens
+	c.Errors += other.Errors
+	c.QuotaErrors += other.QuotaErrors
+}
+
+// number of all tokens
+func (c usageCounts) tokens() int64 {
+	return c.InputTokens + c.OutputTokens
+}
+
+// check if given counts exceed the budget (zero values for no limits)
+func (b configBudget) exceededBy(c usageCounts) bool {
+	return (b.MaxRequests > 0 && c.Requests >= b.MaxRequests) ||
+		(b.MaxTokens > 0 && c.tokens() >= b.MaxTokens)
+}
+
+// usageKey struct (a feed, an api key, and a model)
+type usageKey struct {
+	feed  string
+	keyID string
+	model string
+}
+
+// keyModel struct (an api key and a model)
+type keyModel struct {
+	keyID string
+	model string
+}
+
+// usageAccountant struct
+//
+// counts requests, tokens, and errors of Google Gemini API for each api key, model, and feed,
+// cools down api keys which hit their quotas, and pauses summarization when daily budgets are exceeded.
+// (generations are tried with its (api key, model) pairs with `try`)
+type usageAccountant struct {
+	apiKeys     []string
+	keyIDs      []string          // (in the order of api keys)
+	keyLabels   map[string]string // key id => masked api key
+	models      []string
+	keyBudget   configBudget
+	feedBudgets map[string]configBudget
+	health      *modelHealth
+
+	mu            sync.Mutex
+	day           string
+	today         map[usageKey]*usageCounts
+	stores        map[string]*feedStore
+	cooldownUntil map[keyModel]time.Time
+}
+
+// create a new usage accountant for given config and api keys
+func newUsageAccountant(conf config, apiKeys []string) *usageAccountant {
+	a := &usageAccountant{
+		keyLabels:     map[string]string{},
+		models:        conf.GoogleAIModels,
+		feedBudgets:   map[string]configBudget{},
+		today:         map[usageKey]*usageCounts{},
+		stores:        map[string]*feedStore{},
+		cooldownUntil: map[keyModel]time.Time{},
+		health:        newModelHealth(conf.GoogleAIModels, conf.ModelFailureThreshold, time.Duration(conf.ModelCooldownSeconds)*time.Second),
+	}
+	for _, apiKey := range apiKeys {
+		keyID := apiKeyIDOf(apiKey)
+		a.apiKeys = append(a.apiKeys, apiKey)
+		a.keyIDs = append(a.keyIDs, keyID)
+		a.keyLabels[keyID] = maskAPIKey(apiKey)
+	}
+	if conf.APIKeyDailyBudget != nil {
+		a.keyBudget = *conf.APIKeyDailyBudget
+	}
+	for _, feedConfig := range conf.RSSFeeds {
+		if feedConfig.DailyBudget != nil {
+			a.feedBudgets[feedConfig.Name] = *feedConfig.DailyBudget
+		}
+	}
+	return a
+}
+
+// get the id of given api key (for not saving or showing the api key itself)
+func apiKeyIDOf(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// mask given api key, leaving its last 4 characters only
+func maskAPIKey(apiKey string) string {
+	if len(apiKey) <= 8 {
+		return "****"
+	}
+	return "****" + apiKey[len(apiKey)-4:]
+}
+
+// get a context for requests of feed `name`
+func withUsageFeed(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, usageFeedKey{}, name)
+}
+
+// get the name of the feed from given context
+func usageFeedOf(ctx context.Context) string {
+	name, _ := ctx.Value(usageFeedKey{}).(string)
+	return name
+}
+
+// get a context which counts api requests made with it into `calls`
+func withAPICallCounter(ctx context.Context, calls *atomic.Int64) context.Context {
+	return context.WithValue(ctx, apiCallsKey{}, calls)
+}
+
+// register the store of feed `name`, and load its usages of today
+func (a *usageAccountant) register(name string, store *feedStore) error {
+	if a == nil {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.rollover(time.Now())
+	a.stores[name] = store
+
+	usages, err := store.usagesOf(a.day)
+	if err != nil {
+		return err
+	}
+	for _, u := range usages {
+		a.countsOf(usageKey{feed: name, keyID: u.KeyID, model: u.Model}).add(u.counts())
+	}
+	return nil
+}
+
+// reset counters if the day has changed at `now` (should be called with the lock held)
+func (a *usageAccountant) rollover(now time.Time) {
+	if day := now.Format(usageDayFormat); day != a.day {
+		a.day = day
+		a.today = map[usageKey]*usageCounts{}
+	}
+}
+
+// get the counters of today for given key (should be called with the lock held)
+func (a *usageAccountant) countsOf(key usageKey) *usageCounts {
+	counts, exists := a.today[key]
+	if !exists {
+		counts = &usageCounts{}
+		a.today[key] = counts
+	}
+	return counts
+}
+
+// sum the counters of today which match given `fn` (should be called with the lock held)
+func (a *usageAccountant) sum(fn func(key usageKey) bool) (sum usageCounts) {
+	for key, counts := range a.today {
+		if fn(key) {
+			sum.add(*counts)
+		}
+	}
+	return sum
+}
+
+// get the reason why requests of feed `name` with given api key and model should not be made at `now`
+// (empty if they can be made)
+func (a *usageAccountant) blocked(name, keyID, model string, now time.Time) (reason string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.rollover(now)
+
+	if a.feedBudgets[name].exceededBy(a.sum(func(key usageKey) bool { return key.feed == name })) {
+		return fmt.Sprintf("daily budget of feed '%s' was exceeded", name)
+	}
+	if a.keyBudget.exceededBy(a.sum(func(key usageKey) bool { return key.keyID == keyID })) {
+		return fmt.Sprintf("daily budget of api key %s was exceeded", a.keyLabels[keyID])
+	}
+	if until, exists := a.cooldownUntil[keyModel{keyID, model}]; exists && until.After(now) {
+		return fmt.Sprintf("api key %s is cooling down for model %s", a.keyLabels[keyID], model)
+	}
+	if _, skipped := a.health.skipped(model, now); skipped {
+		return fmt.Sprintf("model %s is skipped after repeated failures", model)
+	}
+	return ""
+}
+
+// get the first model in the fallbacks which is not skipped, and not cooling down or over budgets with any api key
+// (should be called with the lock held)
+func (a *usageAccountant) preferredModel(now time.Time) string {
+	for _, model := range a.models {
+		if _, skipped := a.health.skipped(model, now); skipped {
+			continue
+		}
+		for _, keyID := range a.keyIDs {
+			if a.keyBudget.exceededBy(a.sum(func(key usageKey) bool { return key.keyID == keyID })) {
+				continue
+			}
+			if until, exists := a.cooldownUntil[keyModel{keyID, model}]; !exists || !until.After(now) {
+				return model
+			}
+		}
+	}
+	return ""
+}
+
+// check if feed `name` can be summarized at `now` (reason is returned if not)
+//
+// (not available if its budget was exceeded, or all api keys are cooling down or over their budgets)
+func (a *usageAccountant) available(name string, now time.Time) (ok bool, reason string) {
+	if a == nil {
+		return true, ""
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.rollover(now)
+
+	if a.feedBudgets[name].exceededBy(a.sum(func(key usageKey) bool { return key.feed == name })) {
+		return false, "over the daily budget"
+	}
+	for _, keyID := range a.keyIDs {
+		if a.keyBudget.exceededBy(a.sum(func(key usageKey) bool { return key.keyID == keyID })) {
+			continue
+		}
+		for _, model := range a.models {
+			if _, skipped := a.health.skipped(model, now); skipped {
+				continue
+			}
+			if until, exists := a.cooldownUntil[keyModel{keyID, model}]; !exists || !until.After(now) {
+				return true, ""
+			}
+		}
+	}
+	return false, "while all api keys are cooling down or over their budgets, or all models are skipped"
+}
+
+// record given usage of the feed of given context at `now`, and save it in the store of the feed
+//
+// (requests are also counted into the counter of the context, if any)
+func (a *usageAccountant) record(ctx context.Context, keyID, model string, counts usageCounts, now time.Time) {
+	if calls, ok := ctx.Value(apiCallsKey{}).(*atomic.Int64); ok {
+		calls.Add(counts.Requests)
+	}
+	if a == nil {
+		return
+	}
+
+	name := usageFeedOf(ctx)
+
+	a.mu.Lock()
+	a.rollover(now)
+	a.countsOf(usageKey{feed: name, keyID: keyID, model: model}).add(counts)
+	day, store := a.day, a.stores[name]
+	a.mu.Unlock()
+
+	if store != nil {
+		if err := store.addUsage(apiUsage{
+			Day:          day,
+			KeyID:        keyID,
+			Model:        model,
+			Requests:     counts.Requests,
+			InputTokens:  counts.InputTokens,
+			OutputTokens: counts.OutputTokens,
+			Errors:       counts.Errors,
+			QuotaErrors:  counts.QuotaErrors,
+		}); err != nil {
+			log.Printf("# failed to save api usage: %s", err)
+		}
+	}
+}
+
+// cool down given api key and model until `now` + `duration`
+func (a *usageAccountant) cooldown(keyID, model string, duration time.Duration, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.cooldownUntil[keyModel{keyID, model}] = now.Add(duration)
+}
+
+// apiKeyUsageReport struct (usage of an api key today)
+type apiKeyUsageReport struct {
+	KeyID string `json:"key_id"`
+	Key   string `json:"key"` // (masked)
+
+	usageCounts
+
+	OverBudget  bool                 `json:"over_budget,omitempty"`
+	CoolingDown map[string]time.Time `json:"cooling_down,omitempty"` // model => until
+}
+
+// build the usage reports of api keys at `now`
+func (a *usageAccountant) keyReports(now time.Time) []apiKeyUsageReport {
+	reports := []apiKeyUsageReport{}
+	if a == nil {
+		return reports
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.rollover(now)
+
+	for _, keyID := range a.keyIDs {
+		report := apiKeyUsageReport{
+			KeyID:       keyID,
+			Key:         a.keyLabels[keyID],
+			usageCounts: a.sum(func(key usageKey) bool { return key.keyID == keyID }),
+		}
+		report.OverBudget = a.keyBudget.exceededBy(report.usageCounts)
+		for _, model := range a.models {
+			if until, exists := a.cooldownUntil[keyModel{keyID, model}]; exists && until.After(now) {
+				if report.CoolingDown == nil {
+					report.CoolingDown = map[string]time.Time{}
+				}
+				report.CoolingDown[model] = until
+			}
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// build the health reports of models at `now`
+func (a *usageAccountant) modelReports(now time.Time) []modelHealthReport {
+	if a == nil {
+		return []modelHealthReport{}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.rollover(now)
+
+	reports := a.health.reports(now)
+	preferred := a.preferredModel(now)
+	for i := range reports {
+		reports[i].Preferred = reports[i].Model == preferred
+	}
+	return reports
+}
+
+// get the usage of feed `name` today at `now`, and whether it exceeded the budget
+func (a *usageAccountant) feedUsage(name string, now time.Time) (counts usageCounts, overBudget bool) {
+	if a == nil {
+		return counts, false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.rollover(now)
+
+	counts = a.sum(func(key usageKey) bool { return key.feed == name })
+	return counts, a.feedBudgets[name].exceededBy(counts)
+}
+
+// add given usage to the one of the same day, api key, and model
+func (s *feedStore) addUsage(u apiUsage) error {
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "day"}, {Name: "key_id"}, {Name: "model"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"requests":      gorm.Expr("requests + ?", u.Requests),
+			"input_tokens":  gorm.Expr("input_tokens + ?", u.InputTokens),
+			"output_tokens": gorm.Expr("output_tokens + ?", u.OutputTokens),
+			"errors":        gorm.Expr("errors + ?", u.Errors),
+			"quota_errors":  gorm.Expr("quota_errors + ?", u.QuotaErrors),
+			"updated_at":    time.Now(),
+		}),
+	}).Create(&u).Error; err != nil {
+		return fmt.Errorf("failed to add usage of %s: %w", u.Day, err)
+	}
+	return nil
+}
+
+// list usages of given `day`
+func (s *feedStore) usagesOf(day string) (usages []apiUsage, err error) {
+	if err = s.db.Where("day = ?", day).Find(&usages).Error; err != nil {
+		return nil, fmt.Errorf("failed to list usages of %s: %w", day, err)
+	}
+	return usages, nil
+}
+
+// delete usages older than the retention days
+func (s *feedStore) pruneUsages() error {
+	before := time.Now().AddDate(0, 0, -usageRetentionDays).Format(usageDayFormat)
+	return s.db.Where("day < ?", before).Delete(&apiUsage{}).Error
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// testGeminiServer is a stub server of Google Gemini API which replies with the status and body of each model
+type testGeminiServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	replies  map[string]testGeminiReply // model => reply
+	requests []string                   // "api key/model" of requests
+	bodies   []string                   // bodies of requests
+}
+
+// testGeminiReply struct (a reply of the stub server)
+type testGeminiReply struct {
+	status int
+	body   string
+}
+
+// reply of a successful generation (with a function call)
+const testGeminiSuccessBody = `{
+	"candidates": [{"content": {"role": "model", "parts": [{"functionCall": {"name": "translateTitleAndSummarizeContent", "args": {"translatedTitle": "Translated", "summarizedContent": "Summarized."}}}]}, "finishReason": "STOP"}],
+	"usageMetadata": {"promptTokenCount": 100, "candidatesTokenCount": 20, "thoughtsTokenCount": 5}
+}`
+
+// reply of a quota error
+const testGeminiQuotaBody = `{"error": {"code": 429, "message": "You exceeded your current quota.", "status": "RESOURCE_EXHAUSTED", "details": [{"@type": "type.googleapis.com/google.rpc.RetryInfo", "retryDelay": "30s"}]}}`
+
+// create a new stub server of Google Gemini API
+func newTestGeminiServer(t *testing.T) *testGeminiServer {
+	t.Helper()
+
+	s := &testGeminiServer{replies: map[string]testGeminiReply{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		model := strings.TrimSuffix(r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:], ":generateContent")
+
+		body, _ := io.ReadAll(r.Body)
+
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Header.Get("x-goog-api-key")+"/"+model)
+		s.bodies = append(s.bodies, string(body))
+		reply, exists := s.replies[model]
+		s.mu.Unlock()
+		if !exists {
+			reply = testGeminiReply{status: http.StatusOK, body: testGeminiSuccessBody}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(reply.status)
+		_, _ = w.Write([]byte(reply.body))
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// set the reply for given model
+func (s *testGeminiServer) reply(model string, status int, body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.replies[model] = testGeminiReply{status: status, body: body}
+}
+
+// get (and reset) the requests so far
+func (s *testGeminiServer) takeRequests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests := s.requests
+	s.requests = nil
+	return requests
+}
+
+// create a new gemini summarizer which requests the stub server
+func newTestGeminiSummarizer(usage *usageAccountant, server *testGeminiServer) *geminiSummarizer {
+	g := newGeminiSummarizer(usage)
+	g.baseURL = server.URL
+	return g
+}
+
+func TestGeminiSummarizer_Generate(t *testing.T) {
+	_, store := newTestFeedStore(t)
+
+	conf := config{GoogleAIModels: []string{"model1"}}
+	usage := newUsageAccountant(conf, []string{"key1", "key2"})
+	if err := usage.register("test", store); err != nil {
+		t.Fatal(err)
+	}
+
+	server := newTestGeminiServer(t)
+	g := newTestGeminiSummarizer(usage, server)
+	ctx := withUsageFeed(context.Background(), "test")
+
+	// successful generation
+	model, title, summary, _, err := g.generate(ctx, summaryRequest{prompt: "prompt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model != "model1" || title != "Translated" || summary != "Summarized." {
+		t.Errorf("unexpected generation: %s, %s, %s", model, title, summary)
+	}
+
+	// quota error, so retried with the other api key
+	server.reply("model1", http.StatusTooManyRequests, testGeminiQuotaBody)
+	server.takeRequests()
+	if _, _, _, _, err := g.generate(ctx, summaryRequest{prompt: "prompt"}); !errors.Is(err, errNoAvailableGeminiKey) {
+		t.Errorf("expected no available api key, got %v", err)
+	}
+	if requests := server.takeRequests(); len(requests) != 2 || requests[0] != "key1/model1" || requests[1] != "key2/model1" {
+		t.Errorf("unexpected requests: %v", requests)
+	}
+
+	counts, _ := usage.feedUsage("test", time.Now())
+	if counts != (usageCounts{Requests: 3, InputTokens: 100, OutputTokens: 25, Errors: 2, QuotaErrors: 2}) {
+		t.Errorf("unexpected usage: %+v", counts)
+	}
+
+	// (cooling down, so not requested at all)
+	server.reply("model1", http.StatusOK, testGeminiSuccessBody)
+	if _, _, _, _, err := g.generate(ctx, summaryRequest{prompt: "prompt"}); !errors.Is(err, errNoAvailableGeminiKey) {
+		t.Errorf("expected no available api key, got %v", err)
+	}
+	if requests := server.takeRequests(); len(requests) != 0 {
+		t.Errorf("expected no requests while cooling down, got %v", requests)
+	}
+	if ok, reason := usage.available("test", time.Now()); ok || reason == "" {
+		t.Error("expected to be unavailable while all api keys are cooling down")
+	}
+
+	// saved in the store, and loaded again
+	usages, err := store.usagesOf(time.Now().Format(usageDayFormat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usages) != 2 {
+		t.Errorf("unexpected saved usages: %+v", usages)
+	}
+	reloaded := newUsageAccountant(conf, []string{"key1", "key2"})
+	if err := reloaded.register("test", store); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, _ := reloaded.feedUsage("test", time.Now()); loaded != counts {
+		t.Errorf("expected loaded usage %+v, got %+v", counts, loaded)
+	}
+}
+
+func TestUsageAccountant_Budgets(t *testing.T) {
+	conf := config{
+		GoogleAIModels:    []string{"model1"},
+		APIKeyDailyBudget: &configBudget{MaxTokens: 200},
+		RSSFeeds: []configRSSFeed{
+			{Name: "limited", DailyBudget: &configBudget{MaxRequests: 1}},
+			{Name: "unlimited"},
+		},
+	}
+	usage := newUsageAccountant(conf, []string{"key1"})
+
+	attempts := 0
+	generate := func(combo geminiCombo) (usageCounts, error) {
+		attempts++
+		return usageCounts{InputTokens: 100, OutputTokens: 50}, nil
+	}
+
+	// budget of a feed
+	limited := withUsageFeed(context.Background(), "limited")
+	if _, err := usage.try(limited, generate); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := usage.try(limited, generate); !errors.Is(err, errNoAvailableGeminiKey) {
+		t.Errorf("expected no available api key over the budget, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("expected 1 attempt, got %d", attempts)
+	}
+	if _, overBudget := usage.feedUsage("limited", time.Now()); !overBudget {
+		t.Error("expected the feed to be over its budget")
+	}
+	if ok, _ := usage.available("limited", time.Now()); ok {
+		t.Error("expected the feed over its budget to be unavailable")
+	}
+	if ok, _ := usage.available("unlimited", time.Now()); !ok {
+		t.Error("expected the other feed to be available")
+	}
+
+	// budget of an api key (shared by feeds)
+	unlimited := withUsageFeed(context.Background(), "unlimited")
+	if _, err := usage.try(unlimited, generate); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := usage.try(unlimited, generate); !errors.Is(err, errNoAvailableGeminiKey) {
+		t.Errorf("expected no available api key over the budget, got %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("expected 2 attempts, got %d", attempts)
+	}
+
+	reports := usage.keyReports(time.Now())
+	if len(reports) != 1 || !reports[0].OverBudget || reports[0].Requests != 2 || reports[0].Key != "****" || strings.Contains(reports[0].KeyID, "key1") {
+		t.Errorf("unexpected reports: %+v", reports)
+	}
+}
+
+func TestSummarizeItems_Deferred(t *testing.T) {
+	_, store := newTestFeedStore(t)
+
+	conf := config{
+		GoogleAIModels:  []string{"model1"},
+		DesiredLanguage: new("Korean"),
+		RSSFeeds:        []configRSSFeed{{Name: "test", DailyBudget: &configBudget{MaxRequests: 1}}},
+	}
+	usage := newUsageAccountant(conf, []string{"key1"})
+	if err := usage.register("test", store); err != nil {
+		t.Fatal(err)
+	}
+	prompt, err := newSummaryPrompt(configSummaryPrompt{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := newTestGeminiServer(t)
+	f := &feed{
+		conf:       conf.RSSFeeds[0],
+		store:      store,
+		usage:      usage,
+		prompt:     prompt,
+		summarizer: newTestGeminiSummarizer(usage, server),
+	}
+
+	items := []*gofeed.Item{}
+	for i := range 3 {
+		items = append(items, &gofeed.Item{
+			GUID:        fmt.Sprintf("%d", i),
+			Title:       "Original",
+			Description: "description of the item",
+		})
+	}
+
+	// (only the first one is summarized within the budget, and the others are not cached as failures)
+	deferred, err := summarizeItems(withUsageFeed(context.Background(), "test"), f, items, nil, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deferred) != 2 || deferred[0].GUID != "1" {
+		t.Errorf("expected 2 deferred items, got %+v", deferred)
+	}
+	cached, err := store.cachedItemsOf([]string{"0", "1", "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cached) != 1 || cached[0].Title != "Translated" || !strings.HasPrefix(cached[0].Summary, "Summarized.\n\n(summarized with **model1**") {
+		t.Errorf("unexpected cached items: %+v", cached)
+	}
+	if requests := server.takeRequests(); len(requests) != 1 {
+		t.Errorf("expected 1 request, got %v", requests)
+	}
+}